@@ -0,0 +1,450 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/kaanserin/go-reads/internal/auth"
+	"github.com/kaanserin/go-reads/internal/blobstore"
+	"github.com/kaanserin/go-reads/internal/bookimport"
+	"github.com/kaanserin/go-reads/internal/books"
+	"github.com/kaanserin/go-reads/internal/config"
+	"github.com/kaanserin/go-reads/internal/database"
+	"github.com/kaanserin/go-reads/internal/export"
+	"github.com/kaanserin/go-reads/internal/logging"
+	"gopkg.in/validator.v2"
+)
+
+// commandEnv holds what every operational command shares with the server
+type commandEnv struct {
+	cfg     *config.Config
+	logger  *slog.Logger
+	storage *database.PostgresqlStorage
+	ctx     context.Context
+}
+
+// setup parses the command flags together with the config flags and connects to the database
+func setup(flags *flag.FlagSet, args []string) (*commandEnv, error) {
+	loadConfig := config.AddFlags(flags)
+	if err := flags.Parse(args); err != nil {
+		return nil, err
+	}
+
+	cfg, err := loadConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	// Logs go to stderr so command output on stdout stays machine readable
+	logger := logging.New(os.Stderr, logging.ParseLevel(cfg.Log.Level))
+	slog.SetDefault(logger)
+
+	storage, err := database.NewPostgresStorage(cfg.Database.URL)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx := logging.WithContext(context.Background(), logger)
+	if err := storage.WaitForConnection(ctx, cfg.Database.ConnectRetries, cfg.Database.ConnectRetryPeriod); err != nil {
+		return nil, err
+	}
+
+	return &commandEnv{
+		cfg:     cfg,
+		logger:  logger,
+		storage: storage.WithContext(ctx),
+		ctx:     ctx,
+	}, nil
+}
+
+func runMigrate(args []string) error {
+	flags := flag.NewFlagSet("migrate", flag.ContinueOnError)
+	status := flags.Bool("status", false, "list applied and pending migrations without applying them")
+	env, err := setup(flags, args)
+	if err != nil {
+		return err
+	}
+
+	if *status {
+		return printMigrationStatus(env)
+	}
+
+	applied, err := env.storage.Migrate(env.ctx)
+	for _, version := range applied {
+		fmt.Printf("applied %s\n", version)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	if len(applied) == 0 {
+		fmt.Println("database is up to date")
+	}
+
+	return nil
+}
+
+func printMigrationStatus(env *commandEnv) error {
+	migrations, err := database.Migrations()
+	if err != nil {
+		return err
+	}
+
+	applied, err := env.storage.AppliedMigrations(env.ctx)
+	if err != nil {
+		return err
+	}
+
+	appliedAt := make(map[string]time.Time, len(applied))
+	for _, migration := range applied {
+		appliedAt[migration.Version] = migration.AppliedAt
+	}
+
+	for _, migration := range migrations {
+		if at, ok := appliedAt[migration.Version]; ok {
+			fmt.Printf("%-40s applied %s\n", migration.Version, at.Format(time.RFC3339))
+		} else {
+			fmt.Printf("%-40s pending\n", migration.Version)
+		}
+	}
+
+	return nil
+}
+
+func runCreateAdmin(args []string) error {
+	flags := flag.NewFlagSet("create-admin", flag.ContinueOnError)
+	firstName := flags.String("first-name", "", "first name of the admin")
+	lastName := flags.String("last-name", "", "last name of the admin")
+	email := flags.String("email", "", "email the admin signs in with")
+	password := flags.String("password", "", "password of the admin, read from GO_READS_ADMIN_PASSWORD when empty")
+	env, err := setup(flags, args)
+	if err != nil {
+		return err
+	}
+
+	if *password == "" {
+		*password = os.Getenv("GO_READS_ADMIN_PASSWORD")
+	}
+
+	createUserDto := auth.CreateUserDto{
+		FirstName: *firstName,
+		LastName:  *lastName,
+		Email:     *email,
+		Password:  *password,
+	}
+
+	if err := validator.Validate(createUserDto); err != nil {
+		return err
+	}
+
+	role, err := env.storage.GetRoleByName("admin")
+	if err != nil {
+		return fmt.Errorf("admin role not found, run migrate first: %w", err)
+	}
+
+	hashedPassword, err := auth.HashPassword(createUserDto.Password)
+	if err != nil {
+		return err
+	}
+
+	createUserDto.Password = hashedPassword
+	user, err := auth.SignUpWithRole(createUserDto, role.ID, env.storage)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("created admin %s with id %d\n", user.Email, user.ID)
+	return nil
+}
+
+func runSetRole(args []string) error {
+	flags := flag.NewFlagSet("set-role", flag.ContinueOnError)
+	email := flags.String("email", "", "email of the user")
+	roleName := flags.String("role", "", "name of the role, for example admin or user")
+	env, err := setup(flags, args)
+	if err != nil {
+		return err
+	}
+
+	if *email == "" || *roleName == "" {
+		return errors.New("both -email and -role are required")
+	}
+
+	user, err := env.storage.GetUserByEmail(*email)
+	if err != nil {
+		return fmt.Errorf("user %s not found: %w", *email, err)
+	}
+
+	role, err := env.storage.GetRoleByName(*roleName)
+	if err != nil {
+		return fmt.Errorf("role %s not found: %w", *roleName, err)
+	}
+
+	if err := env.storage.UpdateUserRole(user.ID, role.ID); err != nil {
+		return err
+	}
+
+	fmt.Printf("user %s now has the %s role\n", user.Email, role.Name)
+	return nil
+}
+
+func runSeed(args []string) error {
+	flags := flag.NewFlagSet("seed", flag.ContinueOnError)
+	env, err := setup(flags, args)
+	if err != nil {
+		return err
+	}
+
+	for _, book := range seedBooks {
+		created, err := env.storage.CreateBook(book)
+		if errors.Is(err, database.ErrDuplicateISBN) {
+			fmt.Printf("skipped %q, a book with ISBN %s already exists\n", book.Title, book.ISBN)
+			continue
+		} else if err != nil {
+			return err
+		}
+
+		fmt.Printf("created book %d %q\n", created.ID, created.Title)
+	}
+
+	return nil
+}
+
+func runImportBooks(args []string) error {
+	flags := flag.NewFlagSet("import-books", flag.ContinueOnError)
+	file := flags.String("file", "", "CSV or newline delimited JSON file in the book field layout, or an ONIX 3.0 or MARC21 feed, - reads stdin")
+	format := flags.String("format", "", "csv, ndjson, onix, marc or marcxml, guessed from the file name when empty")
+	dryRun := flags.Bool("dry-run", false, "validate and match the books without saving them")
+	batchSize := flags.Int("batch-size", 0, "rows per transaction, IMPORT_BATCH_SIZE when 0")
+	reportFile := flags.String("report", "", "write the per row report as JSON to this file")
+	env, err := setup(flags, args)
+	if err != nil {
+		return err
+	}
+
+	if *format == "" {
+		*format = bookimport.FormatFromName(*file)
+	}
+
+	if *batchSize <= 0 {
+		*batchSize = env.cfg.Import.BatchSize
+	}
+
+	input, closeInput, err := openInput(*file)
+	if err != nil {
+		return err
+	}
+	defer closeInput()
+
+	rows, err := bookimport.Parse(input, *format)
+	if err != nil {
+		return err
+	}
+
+	report := bookimport.Run(env.storage, rows, *batchSize, *dryRun)
+	if *reportFile != "" {
+		data, err := json.MarshalIndent(report, "", "  ")
+		if err != nil {
+			return err
+		}
+
+		if err := os.WriteFile(*reportFile, data, 0o644); err != nil {
+			return err
+		}
+	}
+
+	for _, row := range report.Rows {
+		if row.Status == bookimport.StatusFailed {
+			fmt.Printf("line %d: %s\n", row.Line, strings.Join(row.Errors, "; "))
+		}
+	}
+
+	verb := "imported"
+	if *dryRun {
+		verb = "would import"
+	}
+	fmt.Printf("%s %d books: %d created, %d updated, %d failed\n", verb, report.Total-report.Failed, report.Created, report.Updated, report.Failed)
+
+	if report.Failed > 0 {
+		return fmt.Errorf("%d of %d rows failed", report.Failed, report.Total)
+	}
+
+	return nil
+}
+
+// runImportCovers uploads every <isbn>.<ext> image in a directory as the cover of the books with that ISBN
+func runImportCovers(args []string) error {
+	flags := flag.NewFlagSet("import-covers", flag.ContinueOnError)
+	dir := flags.String("dir", "", "directory with cover images named after the ISBN of their book, for example 9780261103573.jpg")
+	replace := flags.Bool("replace", false, "replace covers of books that already have one")
+	env, err := setup(flags, args)
+	if err != nil {
+		return err
+	}
+
+	if *dir == "" {
+		return errors.New("-dir is required")
+	}
+
+	entries, err := os.ReadDir(*dir)
+	if err != nil {
+		return err
+	}
+
+	blobStore, err := blobstore.New(env.ctx, env.cfg.BlobStore)
+	if err != nil {
+		return err
+	}
+	covers := books.NewBookCovers(env.cfg, blobStore)
+
+	imported, skipped := 0, 0
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+
+		isbn := strings.TrimSuffix(entry.Name(), filepath.Ext(entry.Name()))
+		matches, err := env.storage.GetBooksByISBN(isbn)
+		if err != nil {
+			return err
+		}
+
+		if len(matches) == 0 {
+			env.logger.Warn("no book found for cover", "file", entry.Name())
+			skipped++
+			continue
+		}
+
+		for _, book := range matches {
+			if book.CoverImageKey != "" && !*replace {
+				skipped++
+				continue
+			}
+
+			if err := importCover(env, covers, book, filepath.Join(*dir, entry.Name())); err != nil {
+				env.logger.Warn("failed to import cover", "file", entry.Name(), "book_id", book.ID, "error", err)
+				skipped++
+				continue
+			}
+
+			fmt.Printf("imported cover of book %d from %s\n", book.ID, entry.Name())
+			imported++
+		}
+	}
+
+	fmt.Printf("imported %d covers, skipped %d\n", imported, skipped)
+	return nil
+}
+
+func importCover(env *commandEnv, covers *books.BookCovers, book *database.Book, path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	objectKey, err := covers.Upload(env.ctx, covers.Prefix(book.ID), f)
+	if err != nil {
+		return err
+	}
+
+	if err := env.storage.UpdateBookCoverKey(book.ID, objectKey); err != nil {
+		covers.DeleteVariants(env.ctx, objectKey)
+		return err
+	}
+
+	if book.CoverImageKey != "" {
+		covers.DeleteVariants(env.ctx, book.CoverImageKey)
+	}
+
+	return nil
+}
+
+func runExport(args []string) error {
+	flags := flag.NewFlagSet("export", flag.ContinueOnError)
+	what := flags.String("what", "books", "comma separated tables to export: books, reviews, users or all, several tables are written as a zip archive")
+	format := flags.String("format", export.FormatNDJSON, "output format: ndjson or csv")
+	file := flags.String("out", "-", "output file, - writes to stdout")
+	env, err := setup(flags, args)
+	if err != nil {
+		return err
+	}
+
+	tables, err := export.ParseTables(*what)
+	if err != nil {
+		return err
+	}
+
+	output, closeOutput, err := openOutput(*file)
+	if err != nil {
+		return err
+	}
+	defer closeOutput()
+
+	exporter, err := export.New(output, *format, tables)
+	if err != nil {
+		return err
+	}
+
+	if err := env.storage.Export(tables, exporter); err != nil {
+		return err
+	}
+
+	return exporter.Close()
+}
+
+func runReindex(args []string) error {
+	flags := flag.NewFlagSet("reindex", flag.ContinueOnError)
+	env, err := setup(flags, args)
+	if err != nil {
+		return err
+	}
+
+	start := time.Now()
+	if err := env.storage.Reindex(); err != nil {
+		return err
+	}
+
+	fmt.Printf("reindexed in %s\n", time.Since(start).Round(time.Millisecond))
+	return nil
+}
+
+func openInput(path string) (io.Reader, func() error, error) {
+	if path == "" {
+		return nil, nil, errors.New("-file is required")
+	}
+
+	if path == "-" {
+		return os.Stdin, func() error { return nil }, nil
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return f, f.Close, nil
+}
+
+func openOutput(path string) (io.Writer, func() error, error) {
+	if path == "" || path == "-" {
+		return os.Stdout, func() error { return nil }, nil
+	}
+
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return f, f.Close, nil
+}
@@ -1,60 +1,74 @@
 package main
 
 import (
-	"context"
-	"log"
+	"errors"
+	"flag"
+	"fmt"
 	"os"
-	"os/signal"
-	"syscall"
-	"time"
-
-	"github.com/joho/godotenv"
-	api "github.com/kaanserin/go-reads/internal/api"
+	"strings"
 )
 
+type command struct {
+	name        string
+	description string
+	run         func(args []string) error
+}
+
+var commands = []command{
+	{"serve", "Start the HTTP server (default)", runServe},
+	{"migrate", "Apply pending database migrations", runMigrate},
+	{"create-admin", "Create a new user with the admin role", runCreateAdmin},
+	{"set-role", "Change the role of an existing user", runSetRole},
+	{"seed", "Insert the sample books that are missing for local development", runSeed},
+	{"import-books", "Upsert books by ISBN from CSV, newline delimited JSON, ONIX or MARC21 files", runImportBooks},
+	{"import-covers", "Upload book covers from a directory of images named after their ISBN", runImportCovers},
+	{"export", "Export books, reviews and users from one snapshot as newline delimited JSON or CSV", runExport},
+	{"reindex", "Rebuild table indexes and refresh planner statistics", runReindex},
+}
+
 func main() {
-	// Load environment variables
-	err := godotenv.Load()
-	if err != nil {
-		log.Fatal(err)
-	}
+	args := os.Args[1:]
 
-	// Initialize an http server
-	apiUrl := os.Getenv("API_HOST")
-	if apiUrl == "" {
-		apiUrl = ":8080"
+	// Without a subcommand the binary keeps behaving like the plain server
+	name := "serve"
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		name, args = args[0], args[1:]
 	}
 
-	server, err := api.NewServer(apiUrl)
-	if err != nil {
-		log.Fatal(err)
+	if name == "help" {
+		usage()
+		return
 	}
 
-	// Listening inside a go-routine to not block main thread
-	go func() {
-		log.Printf("Server running on %s\n", apiUrl)
-		server.ListenAndServe()
-	}()
+	for _, cmd := range commands {
+		if cmd.name != name {
+			continue
+		}
 
-	// Initialize a channel to receive termination signals
-	sigChan := make(chan os.Signal, 1)
+		if err := cmd.run(args); err != nil {
+			if !errors.Is(err, flag.ErrHelp) {
+				fmt.Fprintf(os.Stderr, "%s: %v\n", name, err)
+			}
 
-	// Relay Interrupt and SIGTERM signals to channel
-	signal.Notify(sigChan, os.Interrupt)
-	signal.Notify(sigChan, syscall.SIGTERM)
+			os.Exit(1)
+		}
 
-	// Receive from signal channel
-	// This expression blocks
-	sig := <-sigChan
+		return
+	}
 
-	// Only reachable if a termination signal is received from sigChan
-	log.Println("Received terminate, gracefully shutting down...", sig)
+	fmt.Fprintf(os.Stderr, "unknown command %q\n\n", name)
+	usage()
+	os.Exit(2)
+}
 
-	// Create a context with 30 second timeout
-	tcContext, cancel := context.WithTimeout(context.Background(), 30*time.Second)
-	defer cancel()
+func usage() {
+	fmt.Fprintln(os.Stderr, "Usage: go_reads <command> [flags]")
+	fmt.Fprintln(os.Stderr)
+	fmt.Fprintln(os.Stderr, "Commands:")
+	for _, cmd := range commands {
+		fmt.Fprintf(os.Stderr, "  %-14s %s\n", cmd.name, cmd.description)
+	}
 
-	// Shut down the server
-	// If the current connections are not handled in 30 seconds(tcContext), forcefully close them
-	server.Shutdown(tcContext)
+	fmt.Fprintln(os.Stderr)
+	fmt.Fprintln(os.Stderr, "Run 'go_reads <command> -h' for the flags of a command.")
 }
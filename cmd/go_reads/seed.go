@@ -0,0 +1,70 @@
+package main
+
+import (
+	"time"
+
+	"github.com/kaanserin/go-reads/internal/database"
+)
+
+func date(year int, month time.Month, day int) time.Time {
+	return time.Date(year, month, day, 0, 0, 0, 0, time.UTC)
+}
+
+// Sample catalog used by the seed command
+var seedBooks = []*database.CreateBookDto{
+	{
+		Title:           "The Left Hand of Darkness",
+		Author:          "Ursula K. Le Guin",
+		Genre:           "Science Fiction",
+		PublicationDate: date(1969, time.March, 1),
+		Publisher:       "Ace Books",
+		ISBN:            "9780441478125",
+		PageCount:       "304",
+		Language:        "English",
+		Format:          "Paperback",
+	},
+	{
+		Title:           "Leviathan Wakes",
+		Author:          "James S. A. Corey",
+		Genre:           "Science Fiction",
+		PublicationDate: date(2011, time.June, 2),
+		Publisher:       "Orbit",
+		ISBN:            "9780316129084",
+		PageCount:       "592",
+		Language:        "English",
+		Format:          "Paperback",
+	},
+	{
+		Title:           "The Name of the Rose",
+		Author:          "Umberto Eco",
+		Genre:           "Historical Fiction",
+		PublicationDate: date(1980, time.September, 1),
+		Publisher:       "Bompiani",
+		ISBN:            "9788845278655",
+		PageCount:       "503",
+		Language:        "Italian",
+		Format:          "Hardcover",
+	},
+	{
+		Title:           "Beloved",
+		Author:          "Toni Morrison",
+		Genre:           "Literary Fiction",
+		PublicationDate: date(1987, time.September, 2),
+		Publisher:       "Alfred A. Knopf",
+		ISBN:            "9781400033416",
+		PageCount:       "324",
+		Language:        "English",
+		Format:          "Paperback",
+	},
+	{
+		Title:           "A Wizard of Earthsea",
+		Author:          "Ursula K. Le Guin",
+		Genre:           "Fantasy",
+		PublicationDate: date(1968, time.November, 1),
+		Publisher:       "Parnassus Press",
+		ISBN:            "9780547773742",
+		PageCount:       "183",
+		Language:        "English",
+		Format:          "Paperback",
+	},
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+
+	api "github.com/kaanserin/go-reads/internal/api"
+	"github.com/kaanserin/go-reads/internal/config"
+	"github.com/kaanserin/go-reads/internal/logging"
+	"github.com/kaanserin/go-reads/internal/tracing"
+)
+
+func runServe(args []string) error {
+	// Load and validate the configuration
+	flags := flag.NewFlagSet("serve", flag.ContinueOnError)
+	loadConfig := config.AddFlags(flags)
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	cfg, err := loadConfig()
+	if err != nil {
+		return err
+	}
+
+	// Initialize the structured logger used by every component
+	logger := logging.New(os.Stdout, logging.ParseLevel(cfg.Log.Level))
+	slog.SetDefault(logger)
+
+	// Initialize tracing, spans are dropped unless an exporter is configured
+	shutdownTracing, err := tracing.Setup(context.Background(), cfg.Tracing.Exporter)
+	if err != nil {
+		return err
+	}
+
+	// Initialize an http server
+	server, err := api.NewServer(cfg, logger)
+	if err != nil {
+		return err
+	}
+
+	// Listening inside a go-routine to not block main thread
+	serverErr := make(chan error, 1)
+	go func() {
+		logger.Info("server running", "addr", cfg.Server.Addr)
+		if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			serverErr <- err
+		}
+	}()
+
+	// Initialize a channel to receive termination signals
+	sigChan := make(chan os.Signal, 1)
+
+	// Relay Interrupt and SIGTERM signals to channel
+	signal.Notify(sigChan, os.Interrupt)
+	signal.Notify(sigChan, syscall.SIGTERM)
+
+	// Receive from signal channel or stop if the server could not listen
+	// This expression blocks
+	select {
+	case err := <-serverErr:
+		return err
+	case sig := <-sigChan:
+		// Only reachable if a termination signal is received from sigChan
+		logger.Info("received terminate, gracefully shutting down", "signal", sig.String())
+	}
+
+	// Create a context with the configured shutdown timeout
+	tcContext, cancel := context.WithTimeout(context.Background(), cfg.Server.ShutdownTimeout)
+	defer cancel()
+
+	// Shut down the server
+	// If the current connections are not handled in time(tcContext), forcefully close them
+	if err := server.Shutdown(tcContext); err != nil {
+		logger.Error("graceful shutdown failed", "error", err)
+	}
+
+	// Flush the remaining spans
+	if err := shutdownTracing(tcContext); err != nil {
+		logger.Error("failed to flush traces", "error", err)
+	}
+
+	return nil
+}
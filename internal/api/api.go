@@ -2,23 +2,55 @@ package api
 
 import (
 	"context"
+	"log/slog"
 	"net"
 	"net/http"
 
+	"github.com/kaanserin/go-reads/internal/blobstore"
+	"github.com/kaanserin/go-reads/internal/config"
 	"github.com/kaanserin/go-reads/internal/database"
+	"github.com/kaanserin/go-reads/internal/health"
+	"github.com/kaanserin/go-reads/internal/logging"
+	"github.com/kaanserin/go-reads/internal/metrics"
+	"github.com/prometheus/client_golang/prometheus"
 )
 
-func NewServer(listenAddr string) (*http.Server, error) {
-	router := CreateNewRouter()
+func NewServer(cfg *config.Config, logger *slog.Logger) (*http.Server, error) {
+	db, err := database.NewPostgresStorage(cfg.Database.URL)
+	if err != nil {
+		return nil, err
+	}
+
+	// Fail fast if the database can not be reached
+	ctx := logging.WithContext(context.Background(), logger)
+	if err := db.WaitForConnection(ctx, cfg.Database.ConnectRetries, cfg.Database.ConnectRetryPeriod); err != nil {
+		return nil, err
+	}
+
+	if cfg.Database.MigrateOnStart {
+		applied, err := db.Migrate(ctx)
+		if err != nil {
+			return nil, err
+		}
 
-	db, err := database.NewPostgresStorage()
+		logger.Info("database migrated", "applied", applied)
+	}
+
+	if err := prometheus.Register(metrics.NewDBStatsCollector(db)); err != nil {
+		return nil, err
+	}
+
+	blobStore, err := blobstore.New(ctx, cfg.BlobStore)
 	if err != nil {
 		return nil, err
 	}
 
+	router := CreateNewRouter(cfg, logger, blobStore, getReadinessChecks(cfg, db, blobStore)...)
+
 	server := &http.Server{
-		Addr:    listenAddr,
-		Handler: router,
+		Addr:     cfg.Server.Addr,
+		Handler:  router,
+		ErrorLog: slog.NewLogLogger(logger.Handler(), slog.LevelError),
 		BaseContext: func(l net.Listener) context.Context {
 			return context.WithValue(context.Background(), database.DBContextKey, db)
 		},
@@ -26,3 +58,15 @@ func NewServer(listenAddr string) (*http.Server, error) {
 
 	return server, nil
 }
+
+func getReadinessChecks(cfg *config.Config, db *database.PostgresqlStorage, blobStore blobstore.BlobStore) []health.Check {
+	checks := []health.Check{
+		{Name: "database", Check: db.Ping},
+	}
+
+	if cfg.Readiness.CheckObjectStore {
+		checks = append(checks, health.Check{Name: "object_store", Check: blobStore.Ping})
+	}
+
+	return checks
+}
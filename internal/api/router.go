@@ -1,26 +1,53 @@
 package api
 
 import (
+	"log/slog"
 	"net/http"
 
 	"github.com/gin-gonic/gin"
 	"github.com/kaanserin/go-reads/internal/auth"
+	"github.com/kaanserin/go-reads/internal/authors"
+	"github.com/kaanserin/go-reads/internal/blobstore"
 	bookreviews "github.com/kaanserin/go-reads/internal/book_reviews"
 	"github.com/kaanserin/go-reads/internal/books"
+	"github.com/kaanserin/go-reads/internal/config"
+	"github.com/kaanserin/go-reads/internal/export"
+	"github.com/kaanserin/go-reads/internal/genres"
+	"github.com/kaanserin/go-reads/internal/goodreads"
+	"github.com/kaanserin/go-reads/internal/health"
+	"github.com/kaanserin/go-reads/internal/middleware"
+	"github.com/kaanserin/go-reads/internal/series"
+	"github.com/kaanserin/go-reads/internal/tracing"
 	"github.com/kaanserin/go-reads/internal/users"
+	"github.com/kaanserin/go-reads/internal/works"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"go.opentelemetry.io/contrib/instrumentation/github.com/gin-gonic/gin/otelgin"
 )
 
-func CreateNewRouter() *gin.Engine {
-	r := gin.Default()
+func CreateNewRouter(cfg *config.Config, logger *slog.Logger, blobStore blobstore.BlobStore, readinessChecks ...health.Check) *gin.Engine {
+	r := gin.New()
+	r.Use(otelgin.Middleware(tracing.ServiceName))
+	r.Use(middleware.RequestID(logger), middleware.RequestLogger(), middleware.Recovery(), middleware.Metrics())
+
+	profileImages := users.NewProfileImages(cfg, blobStore)
+	bookCovers := books.NewBookCovers(cfg, blobStore)
 
 	// Register routes here
-	users.AddUserRoutes(r)
-	auth.AddAuthRoutes(r)
-	books.AddBooksRoutes(r)
-	bookreviews.AddBookReviewsRoutes(r)
+	users.AddUserRoutes(r, cfg, profileImages)
+	auth.AddAuthRoutes(r, cfg, profileImages)
+	books.AddBooksRoutes(r, cfg, bookCovers)
+	authors.AddAuthorsRoutes(r, cfg, authors.NewAuthorPhotos(cfg, blobStore), bookCovers)
+	works.AddWorksRoutes(r, cfg, bookCovers)
+	series.AddSeriesRoutes(r, cfg)
+	genres.AddGenresRoutes(r, cfg, bookCovers)
+	goodreads.AddGoodreadsRoutes(r, cfg)
+	export.AddExportRoutes(r, cfg)
+	bookreviews.AddBookReviewsRoutes(r, cfg)
 	r.GET("/ping", func(c *gin.Context) {
 		c.String(http.StatusOK, "pong")
 	})
+	r.GET("/metrics", gin.WrapH(promhttp.Handler()))
+	health.AddHealthRoutes(r, cfg.Readiness.Timeout, readinessChecks...)
 
 	return r
 }
@@ -5,13 +5,16 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
-	"os"
 	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/golang-jwt/jwt/v5"
+	"github.com/kaanserin/go-reads/internal/config"
 	"github.com/kaanserin/go-reads/internal/database"
+	"github.com/kaanserin/go-reads/internal/logging"
+	"github.com/kaanserin/go-reads/internal/metrics"
 	"github.com/kaanserin/go-reads/internal/middleware"
+	"github.com/kaanserin/go-reads/internal/users"
 	"github.com/kaanserin/go-reads/internal/utils"
 	"golang.org/x/crypto/bcrypt"
 	"gopkg.in/validator.v2"
@@ -32,66 +35,60 @@ type AuthUserResponse struct {
 }
 
 // Register Handlers
-func AddAuthRoutes(c *gin.Engine) {
+func AddAuthRoutes(c *gin.Engine, cfg *config.Config, profileImages *users.ProfileImages) {
 	router := c.Group("/auth")
-	router.POST("/sign_up", makeHandlerFunc(signUpHandler))
-	router.POST("/sign_in", makeHandlerFunc(signInHandler))
+	router.POST("/sign_up", makeHandlerFunc(signUpHandler(cfg.Auth)))
+	router.POST("/sign_in", makeHandlerFunc(signInHandler(cfg.Auth, profileImages)))
 
 	// Authenticated Routes
-	router.Use(middleware.Authentication())
-	router.GET("/user", makeHandlerFunc(getSignedInUser))
+	router.Use(middleware.Authentication(cfg.Auth.AppKey))
+	router.GET("/user", makeHandlerFunc(getSignedInUser(profileImages)))
 }
 
 // Handlers
-func signUpHandler(c *gin.Context) error {
-	var createUserDto CreateUserDto
-	err := json.NewDecoder(c.Request.Body).Decode(&createUserDto)
-	if err != nil {
-		return err
-	}
-
-	if errs := validator.Validate(createUserDto); errs != nil {
-		return errs
-	}
-
-	db, err := database.GetPgStorageFromRequest(c.Request)
-	if err != nil {
-		return err
-	}
-
-	hashedPassword, err := hashPassword(createUserDto.Password)
-	if err != nil {
-		return err
-	}
-
-	createUserDto.Password = hashedPassword
-
-	user, err := SignUp(createUserDto, db)
-	if err != nil {
-		return err
-	}
-
-	accessToken, err := getAccessTokenStringForUser(user)
-	if err != nil {
-		c.JSON(200, nil)
-	}
-
-	fmt.Printf("Access token %s\n", accessToken)
-
-	c.JSON(200, AuthUserResponse{
-		User:        user,
-		AccessToken: accessToken,
-	})
-	return nil
-}
-
-func hashPassword(password string) (string, error) {
-	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
-	if err != nil {
-		return "", err
+func signUpHandler(authConfig config.AuthConfig) func(c *gin.Context) error {
+	return func(c *gin.Context) error {
+		var createUserDto CreateUserDto
+		err := json.NewDecoder(c.Request.Body).Decode(&createUserDto)
+		if err != nil {
+			return err
+		}
+
+		if errs := validator.Validate(createUserDto); errs != nil {
+			return errs
+		}
+
+		db, err := database.GetPgStorageFromRequest(c.Request)
+		if err != nil {
+			return err
+		}
+
+		hashedPassword, err := HashPassword(createUserDto.Password)
+		if err != nil {
+			return err
+		}
+
+		createUserDto.Password = hashedPassword
+
+		user, err := SignUp(createUserDto, db)
+		if err != nil {
+			return err
+		}
+
+		accessToken, err := getAccessTokenStringForUser(user, authConfig)
+		if err != nil {
+			return err
+		}
+
+		metrics.SignUpsTotal.Inc()
+		logging.FromContext(c.Request.Context()).Info("user signed up", "user_id", user.ID)
+
+		c.JSON(200, AuthUserResponse{
+			User:        user,
+			AccessToken: accessToken,
+		})
+		return nil
 	}
-
-	return string(hashedPassword), nil
 }
 
 type SignInDto struct {
@@ -99,69 +96,77 @@ type SignInDto struct {
 	Password string `validate:"nonzero"`
 }
 
-func signInHandler(c *gin.Context) error {
-	var signIn SignInDto
-	if err := json.NewDecoder(c.Request.Body).Decode(&signIn); err != nil {
-		return err
-	}
-
-	if err := validator.Validate(signIn); err != nil {
-		return err
-	}
-
-	storage, err := database.GetPgStorageFromRequest(c.Request)
-	if err != nil {
-		return err
-	}
-
-	user, err := storage.GetUserByEmail(signIn.Email)
-	if err == sql.ErrNoRows {
-		c.JSON(http.StatusUnauthorized, &utils.CustomError{
-			Message: "Invalid email or password",
-		})
-
-		return nil
-	} else if err != nil {
-		return err
-	}
-
-	err = bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(signIn.Password))
-	if err != nil {
-		fmt.Println(err)
-		c.JSON(http.StatusUnauthorized, &utils.CustomError{
-			Message: "Invalid email or password",
+func signInHandler(authConfig config.AuthConfig, profileImages *users.ProfileImages) func(c *gin.Context) error {
+	return func(c *gin.Context) error {
+		var signIn SignInDto
+		if err := json.NewDecoder(c.Request.Body).Decode(&signIn); err != nil {
+			return err
+		}
+
+		if err := validator.Validate(signIn); err != nil {
+			return err
+		}
+
+		storage, err := database.GetPgStorageFromRequest(c.Request)
+		if err != nil {
+			return err
+		}
+
+		user, err := storage.GetUserByEmail(signIn.Email)
+		if err == sql.ErrNoRows {
+			metrics.SignInFailuresTotal.WithLabelValues("unknown_email").Inc()
+			c.JSON(http.StatusUnauthorized, &utils.CustomError{
+				Message: "Invalid email or password",
+			})
+
+			return nil
+		} else if err != nil {
+			return err
+		}
+
+		err = bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(signIn.Password))
+		if err != nil {
+			metrics.SignInFailuresTotal.WithLabelValues("invalid_password").Inc()
+			logging.FromContext(c.Request.Context()).Info("sign in failed", "user_id", user.ID, "reason", "password mismatch")
+			c.JSON(http.StatusUnauthorized, &utils.CustomError{
+				Message: "Invalid email or password",
+			})
+			return nil
+		}
+
+		accessToken, err := getAccessTokenStringForUser(user, authConfig)
+		if err != nil {
+			return err
+		}
+
+		user.Password = ""
+		profileImages.Resolve(c.Request.Context(), user)
+
+		c.JSON(http.StatusOK, AuthUserResponse{
+			User:        user,
+			AccessToken: accessToken,
 		})
 		return nil
 	}
-
-	accessToken, err := getAccessTokenStringForUser(user)
-	if err != nil {
-		return err
-	}
-
-	user.Password = ""
-
-	c.JSON(http.StatusOK, AuthUserResponse{
-		User:        user,
-		AccessToken: accessToken,
-	})
-	return nil
 }
 
-func getAccessTokenStringForUser(user *database.User) (string, error) {
+func getAccessTokenStringForUser(user *database.User, authConfig config.AuthConfig) (string, error) {
 	claims := &jwt.RegisteredClaims{
 		ID:        fmt.Sprint(user.ID),
 		IssuedAt:  jwt.NewNumericDate(time.Now()),
-		ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour)),
+		ExpiresAt: jwt.NewNumericDate(time.Now().Add(authConfig.TokenTTL)),
 	}
 
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	appKey := os.Getenv("APP_KEY")
-	return token.SignedString([]byte(appKey))
+	return token.SignedString([]byte(authConfig.AppKey))
 }
 
-func getSignedInUser(c *gin.Context) error {
-	user, _ := c.Get("user")
-	c.JSON(200, user)
-	return nil
+func getSignedInUser(profileImages *users.ProfileImages) func(c *gin.Context) error {
+	return func(c *gin.Context) error {
+		userTmp, _ := c.Get("user")
+		user := userTmp.(*database.User)
+		profileImages.Resolve(c.Request.Context(), user)
+		c.JSON(200, user)
+		return nil
+	}
 }
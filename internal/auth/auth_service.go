@@ -3,20 +3,48 @@ package auth
 import (
 	"github.com/kaanserin/go-reads/internal/database"
 	"github.com/kaanserin/go-reads/internal/utils"
+	"golang.org/x/crypto/bcrypt"
 )
 
 func SignUp(createUserDto CreateUserDto, storage database.Storage) (*database.User, error) {
-	sameUser, err := storage.GetUserByEmail(createUserDto.Email)
-	if sameUser != nil && err != nil {
+	if err := requireFreeEmail(createUserDto.Email, storage); err != nil {
+		return nil, err
+	}
+
+	return storage.CreateUser(createUserDto.FirstName, createUserDto.LastName,
+		createUserDto.Email, createUserDto.Password)
+}
+
+// SignUpWithRole creates a user who holds the role from the start, a failure leaves no user behind
+func SignUpWithRole(createUserDto CreateUserDto, roleId int, storage database.Storage) (*database.User, error) {
+	if err := requireFreeEmail(createUserDto.Email, storage); err != nil {
 		return nil, err
 	}
 
+	return storage.CreateUserWithRole(createUserDto.FirstName, createUserDto.LastName,
+		createUserDto.Email, createUserDto.Password, roleId)
+}
+
+func requireFreeEmail(email string, storage database.Storage) error {
+	sameUser, err := storage.GetUserByEmail(email)
+	if sameUser != nil && err != nil {
+		return err
+	}
+
 	if sameUser != nil {
-		return nil, &utils.CustomError{
+		return &utils.CustomError{
 			Message: "User with same email already exists",
 		}
 	}
 
-	return storage.CreateUser(createUserDto.FirstName, createUserDto.LastName,
-		createUserDto.Email, createUserDto.Password)
+	return nil
+}
+
+func HashPassword(password string) (string, error) {
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return "", err
+	}
+
+	return string(hashedPassword), nil
 }
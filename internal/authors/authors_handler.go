@@ -0,0 +1,390 @@
+package authors
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kaanserin/go-reads/internal/blobstore"
+	"github.com/kaanserin/go-reads/internal/books"
+	"github.com/kaanserin/go-reads/internal/config"
+	"github.com/kaanserin/go-reads/internal/database"
+	"github.com/kaanserin/go-reads/internal/images"
+	"github.com/kaanserin/go-reads/internal/imageset"
+	"github.com/kaanserin/go-reads/internal/middleware"
+	"github.com/kaanserin/go-reads/internal/render"
+	"github.com/kaanserin/go-reads/internal/utils"
+	"gopkg.in/validator.v2"
+)
+
+// AuthorPhotos stores author photos below authors/<id>/photo/ and resolves their URLs on authors.
+// The authors.photo_key column holds the key of the original.
+type AuthorPhotos = imageset.Images[database.Author]
+
+func NewAuthorPhotos(cfg *config.Config, blobStore blobstore.BlobStore) *AuthorPhotos {
+	return imageset.NewImages(cfg, blobStore, imageset.Entity[database.Author]{
+		Kind:            "author_photo",
+		PrefixFormat:    "authors/%d/photo",
+		ProxyPathFormat: "/authors/%d/photo",
+		Options: images.Options{
+			MaxBytes:       cfg.Images.MaxUploadBytes,
+			ThumbnailSizes: cfg.Images.ThumbnailSizes,
+		},
+		Image: func(author *database.Author) (int, string) {
+			return author.ID, author.PhotoKey
+		},
+		SetURLs: func(author *database.Author, urls map[string]string) {
+			author.PhotoUrls = urls
+		},
+	})
+}
+
+func AddAuthorsRoutes(r *gin.Engine, cfg *config.Config, photos *AuthorPhotos, covers *books.BookCovers) {
+	// Loaded by browsers through signed URLs, so it can not require the authorization header
+	r.GET("/authors/:id/photo", utils.MakeHandlerFunc(getAuthorPhoto(photos)))
+
+	authorsGroup := r.Group("authors")
+
+	authorsGroup.Use(middleware.Authentication(cfg.Auth.AppKey))
+
+	authorsGroup.GET("/", utils.MakeHandlerFunc(getAuthors(photos)))
+	authorsGroup.POST("/", middleware.AuthorizeRoles("admin", "librarian"), utils.MakeHandlerFunc(createAuthor(photos)))
+	authorsGroup.GET("/:id", utils.MakeHandlerFunc(getAuthorById(photos)))
+	authorsGroup.GET("/:id/books", utils.MakeHandlerFunc(getAuthorBooks(covers)))
+	authorsGroup.PUT("/:id", middleware.AuthorizeRoles("admin", "librarian"), utils.MakeHandlerFunc(updateAuthorById(photos)))
+	authorsGroup.DELETE("/:id", middleware.AuthorizeAdmin(), utils.MakeHandlerFunc(deleteAuthorById(photos)))
+	authorsGroup.POST("/:id/photo", middleware.AuthorizeRoles("admin", "librarian"), utils.MakeHandlerFunc(updateAuthorPhoto(photos)))
+	authorsGroup.DELETE("/:id/photo", middleware.AuthorizeRoles("admin", "librarian"), utils.MakeHandlerFunc(deleteAuthorPhoto(photos)))
+}
+
+// validateAuthorDto checks the fields validator tags can not express
+func validateAuthorDto(authorDto *database.AuthorDto) error {
+	if err := validator.Validate(authorDto); err != nil {
+		return err
+	}
+
+	authorDto.Name = strings.TrimSpace(authorDto.Name)
+	if authorDto.Name == "" {
+		return &utils.CustomError{
+			Message: "Name can not be blank",
+		}
+	}
+
+	if authorDto.BirthDate != nil && authorDto.DeathDate != nil && authorDto.DeathDate.Before(*authorDto.BirthDate) {
+		return &utils.CustomError{
+			Message: "Death date can not be before the birth date",
+		}
+	}
+
+	return nil
+}
+
+func parseAuthorId(c *gin.Context) (int, error) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return 0, &utils.CustomError{
+			Message: "Please enter a valid integer for id",
+		}
+	}
+
+	return id, nil
+}
+
+func getAuthors(photos *AuthorPhotos) func(c *gin.Context) error {
+	return func(c *gin.Context) error {
+		storage, err := database.GetPgStorageFromRequest(c.Request)
+		if err != nil {
+			return err
+		}
+
+		authors, err := storage.GetAuthors(c.Request)
+		if err != nil {
+			return err
+		}
+
+		photos.ResolveAll(c.Request.Context(), authors)
+		return render.Respond(c, http.StatusOK, authors)
+	}
+}
+
+func getAuthorById(photos *AuthorPhotos) func(c *gin.Context) error {
+	return func(c *gin.Context) error {
+		storage, err := database.GetPgStorageFromRequest(c.Request)
+		if err != nil {
+			return err
+		}
+
+		id, err := parseAuthorId(c)
+		if err != nil {
+			return err
+		}
+
+		author, err := storage.GetAuthorById(id)
+		if errors.Is(err, sql.ErrNoRows) {
+			c.JSON(http.StatusNotFound, utils.CustomError{
+				Message: "Author not found",
+			})
+
+			return nil
+		} else if err != nil {
+			return err
+		}
+
+		photos.Resolve(c.Request.Context(), author)
+		return render.Respond(c, http.StatusOK, author)
+	}
+}
+
+func getAuthorBooks(covers *books.BookCovers) func(c *gin.Context) error {
+	return func(c *gin.Context) error {
+		storage, err := database.GetPgStorageFromRequest(c.Request)
+		if err != nil {
+			return err
+		}
+
+		id, err := parseAuthorId(c)
+		if err != nil {
+			return err
+		}
+
+		if _, err := storage.GetAuthorById(id); errors.Is(err, sql.ErrNoRows) {
+			c.JSON(http.StatusNotFound, utils.CustomError{
+				Message: "Author not found",
+			})
+
+			return nil
+		} else if err != nil {
+			return err
+		}
+
+		authorBooks, err := storage.GetBooksByAuthorId(id, c.Request)
+		if err != nil {
+			return err
+		}
+
+		covers.ResolveAll(c.Request.Context(), authorBooks)
+		return render.Respond(c, http.StatusOK, authorBooks)
+	}
+}
+
+func createAuthor(photos *AuthorPhotos) func(c *gin.Context) error {
+	return func(c *gin.Context) error {
+		authorDto := &database.AuthorDto{}
+		if err := json.NewDecoder(c.Request.Body).Decode(authorDto); err != nil {
+			return err
+		}
+
+		if err := validateAuthorDto(authorDto); err != nil {
+			return err
+		}
+
+		storage, err := database.GetPgStorageFromRequest(c.Request)
+		if err != nil {
+			return err
+		}
+
+		author, err := storage.CreateAuthor(authorDto)
+		if err != nil {
+			return err
+		}
+
+		photos.Resolve(c.Request.Context(), author)
+		c.JSON(http.StatusCreated, author)
+		return nil
+	}
+}
+
+func updateAuthorById(photos *AuthorPhotos) func(c *gin.Context) error {
+	return func(c *gin.Context) error {
+		authorDto := &database.AuthorDto{}
+		if err := json.NewDecoder(c.Request.Body).Decode(authorDto); err != nil {
+			return err
+		}
+
+		if err := validateAuthorDto(authorDto); err != nil {
+			return err
+		}
+
+		storage, err := database.GetPgStorageFromRequest(c.Request)
+		if err != nil {
+			return err
+		}
+
+		id, err := parseAuthorId(c)
+		if err != nil {
+			return err
+		}
+
+		author, err := storage.UpdateAuthorById(id, authorDto)
+		if err != nil {
+			return err
+		}
+
+		photos.Resolve(c.Request.Context(), author)
+		c.JSON(http.StatusOK, author)
+		return nil
+	}
+}
+
+func deleteAuthorById(photos *AuthorPhotos) func(c *gin.Context) error {
+	return func(c *gin.Context) error {
+		storage, err := database.GetPgStorageFromRequest(c.Request)
+		if err != nil {
+			return err
+		}
+
+		id, err := parseAuthorId(c)
+		if err != nil {
+			return err
+		}
+
+		author, err := storage.GetAuthorById(id)
+		if errors.Is(err, sql.ErrNoRows) {
+			c.JSON(http.StatusNotFound, utils.CustomError{
+				Message: "Author not found",
+			})
+
+			return nil
+		} else if err != nil {
+			return err
+		}
+
+		if err := storage.DeleteAuthorById(id); err != nil {
+			return err
+		}
+
+		photos.DeleteVariants(c.Request.Context(), author.PhotoKey)
+		c.JSON(http.StatusOK, utils.MessageResponse{
+			Message: "Author deleted successfully",
+		})
+
+		return nil
+	}
+}
+
+func updateAuthorPhoto(photos *AuthorPhotos) func(c *gin.Context) error {
+	return func(c *gin.Context) error {
+		storage, err := database.GetPgStorageFromRequest(c.Request)
+		if err != nil {
+			return err
+		}
+
+		id, err := parseAuthorId(c)
+		if err != nil {
+			return err
+		}
+
+		author, err := storage.GetAuthorById(id)
+		if errors.Is(err, sql.ErrNoRows) {
+			c.JSON(http.StatusNotFound, utils.CustomError{
+				Message: "Author not found",
+			})
+
+			return nil
+		} else if err != nil {
+			return err
+		}
+
+		objectKey, err := photos.UploadFromRequest(c, photos.Prefix(author.ID))
+		if err != nil || objectKey == "" {
+			return err
+		}
+
+		ctx := c.Request.Context()
+		if err := storage.UpdateAuthorPhotoKey(author.ID, objectKey); err != nil {
+			photos.DeleteVariants(ctx, objectKey)
+			return err
+		}
+
+		// The previous photo is replaced, its variants are no longer referenced
+		if author.PhotoKey != "" && author.PhotoKey != objectKey {
+			photos.DeleteVariants(ctx, author.PhotoKey)
+		}
+
+		author.PhotoKey = objectKey
+		photos.Resolve(ctx, author)
+		c.JSON(http.StatusOK, author)
+		return nil
+	}
+}
+
+func deleteAuthorPhoto(photos *AuthorPhotos) func(c *gin.Context) error {
+	return func(c *gin.Context) error {
+		storage, err := database.GetPgStorageFromRequest(c.Request)
+		if err != nil {
+			return err
+		}
+
+		id, err := parseAuthorId(c)
+		if err != nil {
+			return err
+		}
+
+		author, err := storage.GetAuthorById(id)
+		if errors.Is(err, sql.ErrNoRows) || (err == nil && author.PhotoKey == "") {
+			c.JSON(http.StatusNotFound, utils.CustomError{
+				Message: "Author has no photo",
+			})
+
+			return nil
+		} else if err != nil {
+			return err
+		}
+
+		if err := storage.UpdateAuthorPhotoKey(author.ID, ""); err != nil {
+			return err
+		}
+
+		ctx := c.Request.Context()
+		photos.DeleteVariants(ctx, author.PhotoKey)
+
+		author.PhotoKey = ""
+		photos.Resolve(ctx, author)
+		c.JSON(http.StatusOK, author)
+		return nil
+	}
+}
+
+// getAuthorPhoto serves an author photo variant through a signed, time limited URL
+func getAuthorPhoto(photos *AuthorPhotos) func(c *gin.Context) error {
+	return func(c *gin.Context) error {
+		id, err := strconv.Atoi(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, utils.CustomError{
+				Message: "Id is not a number",
+			})
+
+			return nil
+		}
+
+		if !photos.VerifyRequest(c, id) {
+			c.JSON(http.StatusForbidden, utils.CustomError{
+				Message: "Invalid or expired signature",
+			})
+
+			return nil
+		}
+
+		storage, err := database.GetPgStorageFromRequest(c.Request)
+		if err != nil {
+			return err
+		}
+
+		author, err := storage.GetAuthorById(id)
+		if errors.Is(err, sql.ErrNoRows) {
+			c.JSON(http.StatusNotFound, utils.CustomError{
+				Message: "Author not found",
+			})
+
+			return nil
+		} else if err != nil {
+			return err
+		}
+
+		return photos.Serve(c, author.PhotoKey)
+	}
+}
@@ -0,0 +1,41 @@
+package authors
+
+import (
+	"testing"
+	"time"
+
+	"github.com/kaanserin/go-reads/internal/database"
+)
+
+func date(year int, month time.Month, day int) *time.Time {
+	t := time.Date(year, month, day, 0, 0, 0, 0, time.UTC)
+	return &t
+}
+
+func TestValidateAuthorDto(t *testing.T) {
+	tests := []struct {
+		name      string
+		authorDto database.AuthorDto
+		valid     bool
+	}{
+		{"name only", database.AuthorDto{Name: "Ursula K. Le Guin"}, true},
+		{"lifespan", database.AuthorDto{Name: "Ursula K. Le Guin", BirthDate: date(1929, 10, 21), DeathDate: date(2018, 1, 22)}, true},
+		{"living author", database.AuthorDto{Name: "N. K. Jemisin", BirthDate: date(1972, 9, 19)}, true},
+		{"missing name", database.AuthorDto{Bio: "Unknown"}, false},
+		{"blank name", database.AuthorDto{Name: "   "}, false},
+		{"death before birth", database.AuthorDto{Name: "Someone", BirthDate: date(2000, 1, 1), DeathDate: date(1999, 1, 1)}, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := validateAuthorDto(&test.authorDto)
+			if test.valid && err != nil {
+				t.Errorf("Expected valid author, got %v", err)
+			}
+
+			if !test.valid && err == nil {
+				t.Error("Expected validation error")
+			}
+		})
+	}
+}
@@ -0,0 +1,55 @@
+package blobstore
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/kaanserin/go-reads/internal/config"
+)
+
+const (
+	BackendS3     = "s3"
+	BackendLocal  = "local"
+	BackendMemory = "memory"
+)
+
+var ErrNotFound = errors.New("object not found")
+
+type ObjectInfo struct {
+	Key         string
+	ContentType string
+	Size        int64
+}
+
+// BlobStore stores binary objects such as profile images under string keys
+type BlobStore interface {
+	Put(ctx context.Context, key string, body io.Reader, contentType string) error
+	// Get returns ErrNotFound if no object exists for the key
+	Get(ctx context.Context, key string) (io.ReadCloser, *ObjectInfo, error)
+	// Delete does not fail if the object does not exist
+	Delete(ctx context.Context, key string) error
+	// Ping verifies that the store is reachable
+	Ping(ctx context.Context) error
+}
+
+// Presigner is implemented by stores that can hand out time limited URLs to read an object directly
+type Presigner interface {
+	PresignGet(ctx context.Context, key string, ttl time.Duration) (string, error)
+}
+
+// New creates the blob store selected in the configuration
+func New(ctx context.Context, cfg config.BlobStoreConfig) (BlobStore, error) {
+	switch cfg.Backend {
+	case BackendS3:
+		return NewS3Store(ctx, cfg.S3)
+	case BackendLocal:
+		return NewLocalStore(cfg.LocalDir)
+	case BackendMemory:
+		return NewMemoryStore(), nil
+	default:
+		return nil, fmt.Errorf("unknown blob store backend %q", cfg.Backend)
+	}
+}
@@ -0,0 +1,87 @@
+package blobstore
+
+import (
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+)
+
+func testBlobStore(t *testing.T, store BlobStore) {
+	ctx := context.Background()
+	key := "profile/user/1/profile_image.png"
+
+	if err := store.Put(ctx, key, strings.NewReader("image bytes"), "image/png"); err != nil {
+		t.Fatal(err)
+	}
+
+	body, info, err := store.Get(ctx, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	content, err := io.ReadAll(body)
+	body.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if string(content) != "image bytes" {
+		t.Errorf("Expected stored content, got %q", content)
+	}
+
+	if info.ContentType != "image/png" {
+		t.Errorf("Expected content type image/png, got %s", info.ContentType)
+	}
+
+	if info.Size != int64(len("image bytes")) {
+		t.Errorf("Expected size %d, got %d", len("image bytes"), info.Size)
+	}
+
+	if err := store.Delete(ctx, key); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, _, err := store.Get(ctx, key); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected ErrNotFound after delete, got %v", err)
+	}
+
+	if err := store.Delete(ctx, key); err != nil {
+		t.Errorf("Expected deleting a missing object to succeed, got %v", err)
+	}
+
+	if err := store.Ping(ctx); err != nil {
+		t.Errorf("Expected ping to succeed, got %v", err)
+	}
+}
+
+func TestMemoryStore(t *testing.T) {
+	testBlobStore(t, NewMemoryStore())
+}
+
+func TestLocalStore(t *testing.T) {
+	store, err := NewLocalStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	testBlobStore(t, store)
+}
+
+func TestLocalStoreKeepsKeysInsideRoot(t *testing.T) {
+	root := t.TempDir()
+	store, err := NewLocalStore(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	path, err := store.path("../../etc/passwd")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.HasPrefix(path, root) {
+		t.Errorf("Expected %s to be inside %s", path, root)
+	}
+}
@@ -0,0 +1,77 @@
+package blobstore
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"sync"
+)
+
+type memoryObject struct {
+	data        []byte
+	contentType string
+}
+
+// MemoryStore keeps objects in memory, intended for tests
+type MemoryStore struct {
+	mu      sync.RWMutex
+	objects map[string]memoryObject
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		objects: make(map[string]memoryObject),
+	}
+}
+
+func (store *MemoryStore) Put(ctx context.Context, key string, body io.Reader, contentType string) error {
+	data, err := io.ReadAll(body)
+	if err != nil {
+		return err
+	}
+
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	store.objects[key] = memoryObject{data: data, contentType: contentType}
+	return nil
+}
+
+func (store *MemoryStore) Get(ctx context.Context, key string) (io.ReadCloser, *ObjectInfo, error) {
+	store.mu.RLock()
+	defer store.mu.RUnlock()
+
+	object, ok := store.objects[key]
+	if !ok {
+		return nil, nil, ErrNotFound
+	}
+
+	return io.NopCloser(bytes.NewReader(object.data)), &ObjectInfo{
+		Key:         key,
+		ContentType: object.contentType,
+		Size:        int64(len(object.data)),
+	}, nil
+}
+
+func (store *MemoryStore) Delete(ctx context.Context, key string) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	delete(store.objects, key)
+	return nil
+}
+
+func (store *MemoryStore) Ping(ctx context.Context) error {
+	return nil
+}
+
+// Keys lists the stored keys
+func (store *MemoryStore) Keys() []string {
+	store.mu.RLock()
+	defer store.mu.RUnlock()
+
+	keys := make([]string, 0, len(store.objects))
+	for key := range store.objects {
+		keys = append(keys, key)
+	}
+
+	return keys
+}
@@ -0,0 +1,133 @@
+package blobstore
+
+import (
+	"context"
+	"errors"
+	"io"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awsconfig "github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/kaanserin/go-reads/internal/config"
+	"github.com/kaanserin/go-reads/internal/tracing"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+type S3Store struct {
+	client *s3.Client
+	bucket string
+}
+
+// NewS3Store creates a store backed by an S3 bucket.
+// A custom endpoint with path style addressing makes it work with MinIO and other S3 compatible servers.
+func NewS3Store(ctx context.Context, cfg config.S3Config) (*S3Store, error) {
+	awsCfg, err := awsconfig.LoadDefaultConfig(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	client := s3.NewFromConfig(awsCfg, func(o *s3.Options) {
+		if cfg.Endpoint != "" {
+			o.BaseEndpoint = aws.String(cfg.Endpoint)
+		}
+
+		o.UsePathStyle = cfg.UsePathStyle
+	})
+
+	return &S3Store{
+		client: client,
+		bucket: cfg.BucketName,
+	}, nil
+}
+
+func (store *S3Store) startSpan(ctx context.Context, operation, key string) (context.Context, trace.Span) {
+	return tracing.Tracer().Start(ctx, "s3."+operation,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(attribute.String("aws.s3.bucket", store.bucket), attribute.String("aws.s3.key", key)))
+}
+
+func (store *S3Store) Put(ctx context.Context, key string, body io.Reader, contentType string) error {
+	ctx, span := store.startSpan(ctx, "PutObject", key)
+	defer span.End()
+
+	input := &s3.PutObjectInput{
+		Bucket: &store.bucket,
+		Key:    &key,
+		Body:   body,
+	}
+
+	if contentType != "" {
+		input.ContentType = &contentType
+	}
+
+	if _, err := store.client.PutObject(ctx, input); err != nil {
+		tracing.RecordError(ctx, err)
+		return err
+	}
+
+	return nil
+}
+
+func (store *S3Store) Get(ctx context.Context, key string) (io.ReadCloser, *ObjectInfo, error) {
+	ctx, span := store.startSpan(ctx, "GetObject", key)
+	defer span.End()
+
+	output, err := store.client.GetObject(ctx, &s3.GetObjectInput{
+		Bucket: &store.bucket,
+		Key:    &key,
+	})
+
+	var noSuchKey *types.NoSuchKey
+	if errors.As(err, &noSuchKey) {
+		return nil, nil, ErrNotFound
+	}
+
+	if err != nil {
+		tracing.RecordError(ctx, err)
+		return nil, nil, err
+	}
+
+	return output.Body, &ObjectInfo{
+		Key:         key,
+		ContentType: aws.ToString(output.ContentType),
+		Size:        aws.ToInt64(output.ContentLength),
+	}, nil
+}
+
+func (store *S3Store) Delete(ctx context.Context, key string) error {
+	ctx, span := store.startSpan(ctx, "DeleteObject", key)
+	defer span.End()
+
+	_, err := store.client.DeleteObject(ctx, &s3.DeleteObjectInput{
+		Bucket: &store.bucket,
+		Key:    &key,
+	})
+
+	if err != nil {
+		tracing.RecordError(ctx, err)
+	}
+
+	return err
+}
+
+func (store *S3Store) PresignGet(ctx context.Context, key string, ttl time.Duration) (string, error) {
+	request, err := s3.NewPresignClient(store.client).PresignGetObject(ctx, &s3.GetObjectInput{
+		Bucket: &store.bucket,
+		Key:    &key,
+	}, s3.WithPresignExpires(ttl))
+	if err != nil {
+		return "", err
+	}
+
+	return request.URL, nil
+}
+
+func (store *S3Store) Ping(ctx context.Context) error {
+	_, err := store.client.HeadBucket(ctx, &s3.HeadBucketInput{
+		Bucket: &store.bucket,
+	})
+	return err
+}
@@ -1,27 +1,41 @@
 package bookreviews
 
 import (
+	"database/sql"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"net/http"
 	"strconv"
 
 	"github.com/gin-gonic/gin"
+	"github.com/kaanserin/go-reads/internal/config"
 	"github.com/kaanserin/go-reads/internal/database"
+	"github.com/kaanserin/go-reads/internal/metrics"
 	"github.com/kaanserin/go-reads/internal/middleware"
+	"github.com/kaanserin/go-reads/internal/render"
+	"github.com/kaanserin/go-reads/internal/reviewtext"
 	"github.com/kaanserin/go-reads/internal/utils"
 	"gopkg.in/validator.v2"
 )
 
-func AddBookReviewsRoutes(c *gin.Engine) {
+func AddBookReviewsRoutes(c *gin.Engine, cfg *config.Config) {
 	router := c.Group("/book_reviews")
 
-	router.Use(middleware.Authentication())
+	router.Use(middleware.Authentication(cfg.Auth.AppKey))
 
 	router.GET("/", middleware.AuthorizeAdmin(), utils.MakeHandlerFunc(getBookReviews))
-	router.POST("/", utils.MakeHandlerFunc(createBookReview))
+	router.POST("/", utils.MakeHandlerFunc(createBookReview(cfg)))
 	router.GET("/:id", utils.MakeHandlerFunc(getBookReviewById))
 	router.DELETE("/:id", utils.MakeHandlerFunc(deleteBookReviewById))
-	router.PUT("/:id", utils.MakeHandlerFunc(updateBookReview))
+	router.PUT("/:id", utils.MakeHandlerFunc(updateBookReview(cfg)))
+	router.POST("/:id/likes", utils.MakeHandlerFunc(likeBookReview))
+	router.DELETE("/:id/likes", utils.MakeHandlerFunc(unlikeBookReview))
+	router.GET("/:id/comments", utils.MakeHandlerFunc(getReviewComments))
+	router.POST("/:id/comments", utils.MakeHandlerFunc(createReviewComment))
+	router.PUT("/:id/comments/:commentId", utils.MakeHandlerFunc(updateReviewComment))
+	router.DELETE("/:id/comments/:commentId", utils.MakeHandlerFunc(deleteReviewComment))
+	router.GET("/:id/revisions", utils.MakeHandlerFunc(getReviewRevisions))
 }
 
 func getBookReviews(c *gin.Context) error {
@@ -35,8 +49,8 @@ func getBookReviews(c *gin.Context) error {
 		return err
 	}
 
-	c.JSON(http.StatusOK, bookReviews)
-	return nil
+	reviewtext.Prepare(true, bookReviews...)
+	return render.Respond(c, http.StatusOK, bookReviews)
 }
 
 func getBookReviewById(c *gin.Context) error {
@@ -66,34 +80,57 @@ func getBookReviewById(c *gin.Context) error {
 		return err
 	}
 
-	c.JSON(http.StatusOK, bookReview)
-	return nil
+	reviewtext.Prepare(c.Query("reveal_spoilers") == "true", bookReview)
+	return render.Respond(c, http.StatusOK, bookReview)
 }
 
-func createBookReview(c *gin.Context) error {
-	var createBookReviewDto *database.CreateBookReviewDto = &database.CreateBookReviewDto{}
-	json.NewDecoder(c.Request.Body).Decode(createBookReviewDto)
+func createBookReview(cfg *config.Config) func(c *gin.Context) error {
+	return func(c *gin.Context) error {
+		var createBookReviewDto *database.CreateBookReviewDto = &database.CreateBookReviewDto{}
+		json.NewDecoder(c.Request.Body).Decode(createBookReviewDto)
 
-	if err := validator.Validate(createBookReviewDto); err != nil {
-		return err
-	}
+		if err := validator.Validate(createBookReviewDto); err != nil {
+			return err
+		}
 
-	storage, err := database.GetPgStorageFromRequest(c.Request)
-	if err != nil {
-		return err
-	}
+		review, err := reviewtext.Sanitize(createBookReviewDto.Review, cfg.Reviews.MaxLength)
+		if err != nil {
+			return err
+		}
+		createBookReviewDto.Review = review
 
-	userVal, _ := c.Get("user")
-	user := userVal.(*database.User)
-	createBookReviewDto.UserID = user.ID
+		storage, err := database.GetPgStorageFromRequest(c.Request)
+		if err != nil {
+			return err
+		}
 
-	bookReview, err := storage.CreateBookReview(createBookReviewDto)
-	if err != nil {
-		return err
-	}
+		userVal, _ := c.Get("user")
+		user := userVal.(*database.User)
+		createBookReviewDto.UserID = user.ID
+
+		bookReview, err := storage.CreateBookReview(createBookReviewDto)
+		if errors.Is(err, sql.ErrNoRows) {
+			c.JSON(http.StatusNotFound, utils.CustomError{
+				Message: "Book not found",
+			})
+
+			return nil
+		} else if errors.Is(err, database.ErrDuplicateReview) {
+			c.JSON(http.StatusConflict, utils.CustomError{
+				Message: fmt.Sprintf("You already reviewed this book, update your review with PUT /books/%d/reviews/mine", createBookReviewDto.BookID),
+			})
+
+			return nil
+		} else if err != nil {
+			return err
+		}
 
-	c.JSON(http.StatusOK, bookReview)
-	return nil
+		metrics.ReviewsCreatedTotal.Inc()
+
+		reviewtext.Prepare(true, bookReview)
+		c.JSON(http.StatusOK, bookReview)
+		return nil
+	}
 }
 
 func deleteBookReviewById(c *gin.Context) error {
@@ -142,48 +179,87 @@ func deleteBookReviewById(c *gin.Context) error {
 	return nil
 }
 
-func updateBookReview(c *gin.Context) error {
-	var updateBookReviewDto *database.UpdateBookReviewDto = &database.UpdateBookReviewDto{}
-	json.NewDecoder(c.Request.Body).Decode(updateBookReviewDto)
+func updateBookReview(cfg *config.Config) func(c *gin.Context) error {
+	return func(c *gin.Context) error {
+		var updateBookReviewDto *database.UpdateBookReviewDto = &database.UpdateBookReviewDto{}
+		json.NewDecoder(c.Request.Body).Decode(updateBookReviewDto)
 
-	err := validator.Validate(updateBookReviewDto)
-	if err != nil {
-		return err
-	}
+		err := validator.Validate(updateBookReviewDto)
+		if err != nil {
+			return err
+		}
 
-	idParam, _ := c.Params.Get("id")
-	id, err := strconv.Atoi(idParam)
-	if err != nil {
-		c.JSON(http.StatusBadRequest, utils.CustomError{
-			Message: "Id is not a number",
-		})
+		updateBookReviewDto.Review, err = reviewtext.Sanitize(updateBookReviewDto.Review, cfg.Reviews.MaxLength)
+		if err != nil {
+			return err
+		}
+
+		idParam, _ := c.Params.Get("id")
+		id, err := strconv.Atoi(idParam)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, utils.CustomError{
+				Message: "Id is not a number",
+			})
 
+			return nil
+		}
+
+		storage, err := database.GetPgStorageFromRequest(c.Request)
+		if err != nil {
+			return err
+		}
+
+		bookReview, err := storage.GetBookReviewById(id)
+		if err != nil {
+			return err
+		}
+
+		userTmp, _ := c.Get("user")
+		user := userTmp.(*database.User)
+		if bookReview.UserID != user.ID {
+			return &utils.CustomError{
+				Message: "Forbidden",
+			}
+		}
+
+		updateBookReviewDto.EditorID = user.ID
+		bookReview, err = storage.UpdateBookReview(id, *updateBookReviewDto)
+		if err != nil {
+			return err
+		}
+
+		reviewtext.Prepare(true, bookReview)
+		c.JSON(http.StatusOK, bookReview)
 		return nil
 	}
+}
 
+// getReviewRevisions returns the earlier versions of a review to its author and to moderators
+func getReviewRevisions(c *gin.Context) error {
 	storage, err := database.GetPgStorageFromRequest(c.Request)
 	if err != nil {
 		return err
 	}
 
-	bookReview, err := storage.GetBookReviewById(id)
-	if err != nil {
+	bookReview, err := reviewParam(c, storage)
+	if err != nil || bookReview == nil {
 		return err
 	}
 
 	userTmp, _ := c.Get("user")
 	user := userTmp.(*database.User)
-	if bookReview.UserID != user.ID {
-		return &utils.CustomError{
-			Message: "Forbidden",
-		}
+	if bookReview.UserID != user.ID && !middleware.HasRole(c, moderatorRoles...) {
+		c.JSON(http.StatusForbidden, utils.CustomError{
+			Message: "Only the author or a moderator can see the revisions of a review",
+		})
+
+		return nil
 	}
 
-	bookReview, err = storage.UpdateBookReview(id, *updateBookReviewDto)
+	revisions, err := storage.GetReviewRevisions(bookReview.ID)
 	if err != nil {
 		return err
 	}
 
-	c.JSON(http.StatusOK, bookReview)
-	return nil
+	return render.Respond(c, http.StatusOK, revisions)
 }
@@ -0,0 +1,283 @@
+package bookreviews
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kaanserin/go-reads/internal/database"
+	"github.com/kaanserin/go-reads/internal/middleware"
+	"github.com/kaanserin/go-reads/internal/render"
+	"github.com/kaanserin/go-reads/internal/reviewtext"
+	"github.com/kaanserin/go-reads/internal/utils"
+	"gopkg.in/validator.v2"
+)
+
+// Roles that can remove the comments of other users and read the revisions of their reviews
+var moderatorRoles = []string{"admin", "moderator"}
+
+// buildThreads nests comments below the comments they reply to and returns the top level comments
+func buildThreads(comments []*database.ReviewComment) []*database.ReviewComment {
+	byId := make(map[int]*database.ReviewComment, len(comments))
+	for _, comment := range comments {
+		byId[comment.ID] = comment
+	}
+
+	threads := make([]*database.ReviewComment, 0)
+	for _, comment := range comments {
+		var parent *database.ReviewComment
+		if comment.ParentID != nil {
+			parent = byId[*comment.ParentID]
+		}
+
+		if parent != nil {
+			parent.Replies = append(parent.Replies, comment)
+		} else {
+			threads = append(threads, comment)
+		}
+	}
+
+	return threads
+}
+
+// reviewParam reads the review id of the route and answers 404 when the review does not exist
+func reviewParam(c *gin.Context, storage *database.PostgresqlStorage) (*database.BookReview, error) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return nil, &utils.CustomError{
+			Message: "Id is not a number",
+		}
+	}
+
+	bookReview, err := storage.GetBookReviewById(id)
+	if errors.Is(err, sql.ErrNoRows) {
+		c.JSON(http.StatusNotFound, utils.CustomError{
+			Message: "Book review not found",
+		})
+
+		return nil, nil
+	}
+
+	return bookReview, err
+}
+
+// commentParam reads the comment id of the route and answers 404 when the review has no such comment
+func commentParam(c *gin.Context, storage *database.PostgresqlStorage) (*database.ReviewComment, error) {
+	reviewId, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return nil, &utils.CustomError{
+			Message: "Id is not a number",
+		}
+	}
+
+	id, err := strconv.Atoi(c.Param("commentId"))
+	if err != nil {
+		return nil, &utils.CustomError{
+			Message: "Comment id is not a number",
+		}
+	}
+
+	comment, err := storage.GetReviewCommentById(id)
+	if errors.Is(err, sql.ErrNoRows) || (err == nil && (comment.ReviewID != reviewId || comment.Deleted)) {
+		c.JSON(http.StatusNotFound, utils.CustomError{
+			Message: "Comment not found",
+		})
+
+		return nil, nil
+	}
+
+	return comment, err
+}
+
+func likeBookReview(c *gin.Context) error {
+	storage, err := database.GetPgStorageFromRequest(c.Request)
+	if err != nil {
+		return err
+	}
+
+	bookReview, err := reviewParam(c, storage)
+	if err != nil || bookReview == nil {
+		return err
+	}
+
+	userTmp, _ := c.Get("user")
+	user := userTmp.(*database.User)
+
+	if err := storage.LikeBookReview(bookReview.ID, user.ID); err != nil {
+		return err
+	}
+
+	bookReview, err = storage.GetBookReviewById(bookReview.ID)
+	if err != nil {
+		return err
+	}
+
+	reviewtext.Prepare(c.Query("reveal_spoilers") == "true", bookReview)
+	c.JSON(http.StatusOK, bookReview)
+	return nil
+}
+
+func unlikeBookReview(c *gin.Context) error {
+	storage, err := database.GetPgStorageFromRequest(c.Request)
+	if err != nil {
+		return err
+	}
+
+	bookReview, err := reviewParam(c, storage)
+	if err != nil || bookReview == nil {
+		return err
+	}
+
+	userTmp, _ := c.Get("user")
+	user := userTmp.(*database.User)
+
+	if err := storage.UnlikeBookReview(bookReview.ID, user.ID); err != nil {
+		return err
+	}
+
+	bookReview, err = storage.GetBookReviewById(bookReview.ID)
+	if err != nil {
+		return err
+	}
+
+	reviewtext.Prepare(c.Query("reveal_spoilers") == "true", bookReview)
+	c.JSON(http.StatusOK, bookReview)
+	return nil
+}
+
+// getReviewComments returns the comments of a review as threads, ?flat=true returns them as a list oldest first
+func getReviewComments(c *gin.Context) error {
+	storage, err := database.GetPgStorageFromRequest(c.Request)
+	if err != nil {
+		return err
+	}
+
+	bookReview, err := reviewParam(c, storage)
+	if err != nil || bookReview == nil {
+		return err
+	}
+
+	comments, err := storage.GetReviewComments(bookReview.ID)
+	if err != nil {
+		return err
+	}
+
+	if c.Query("flat") == "true" {
+		return render.Respond(c, http.StatusOK, comments)
+	}
+
+	return render.Respond(c, http.StatusOK, buildThreads(comments))
+}
+
+// createReviewComment comments on a review, or replies to one of its comments with parent_id
+func createReviewComment(c *gin.Context) error {
+	var commentDto *database.ReviewCommentDto = &database.ReviewCommentDto{}
+	if err := json.NewDecoder(c.Request.Body).Decode(commentDto); err != nil {
+		return &utils.CustomError{
+			Message: "Please send the comment as a JSON object",
+		}
+	}
+
+	if err := validator.Validate(commentDto); err != nil {
+		return err
+	}
+
+	storage, err := database.GetPgStorageFromRequest(c.Request)
+	if err != nil {
+		return err
+	}
+
+	bookReview, err := reviewParam(c, storage)
+	if err != nil || bookReview == nil {
+		return err
+	}
+
+	userTmp, _ := c.Get("user")
+	user := userTmp.(*database.User)
+
+	comment, err := storage.CreateReviewComment(bookReview.ID, user.ID, commentDto)
+	if err != nil {
+		return err
+	}
+
+	c.JSON(http.StatusCreated, comment)
+	return nil
+}
+
+// updateReviewComment lets the author of a comment change its text
+func updateReviewComment(c *gin.Context) error {
+	var commentDto *database.ReviewCommentDto = &database.ReviewCommentDto{}
+	if err := json.NewDecoder(c.Request.Body).Decode(commentDto); err != nil {
+		return &utils.CustomError{
+			Message: "Please send the comment as a JSON object",
+		}
+	}
+
+	if err := validator.Validate(commentDto); err != nil {
+		return err
+	}
+
+	storage, err := database.GetPgStorageFromRequest(c.Request)
+	if err != nil {
+		return err
+	}
+
+	comment, err := commentParam(c, storage)
+	if err != nil || comment == nil {
+		return err
+	}
+
+	userTmp, _ := c.Get("user")
+	user := userTmp.(*database.User)
+	if comment.UserID != user.ID {
+		c.JSON(http.StatusForbidden, utils.CustomError{
+			Message: "Only the author can edit a comment",
+		})
+
+		return nil
+	}
+
+	comment, err = storage.UpdateReviewComment(comment.ID, commentDto.Body)
+	if err != nil {
+		return err
+	}
+
+	c.JSON(http.StatusOK, comment)
+	return nil
+}
+
+// deleteReviewComment removes a comment, authors remove their own comments and moderators any comment
+func deleteReviewComment(c *gin.Context) error {
+	storage, err := database.GetPgStorageFromRequest(c.Request)
+	if err != nil {
+		return err
+	}
+
+	comment, err := commentParam(c, storage)
+	if err != nil || comment == nil {
+		return err
+	}
+
+	userTmp, _ := c.Get("user")
+	user := userTmp.(*database.User)
+	if comment.UserID != user.ID && !middleware.HasRole(c, moderatorRoles...) {
+		c.JSON(http.StatusForbidden, utils.CustomError{
+			Message: "Only the author or a moderator can remove a comment",
+		})
+
+		return nil
+	}
+
+	if err := storage.DeleteReviewComment(comment.ID); err != nil {
+		return err
+	}
+
+	c.JSON(http.StatusOK, utils.MessageResponse{
+		Message: "Comment deleted successfully",
+	})
+
+	return nil
+}
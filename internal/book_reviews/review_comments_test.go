@@ -0,0 +1,35 @@
+package bookreviews
+
+import (
+	"testing"
+
+	"github.com/kaanserin/go-reads/internal/database"
+)
+
+func TestBuildThreads(t *testing.T) {
+	parentId := func(id int) *int {
+		return &id
+	}
+
+	comments := []*database.ReviewComment{
+		{ID: 1, Body: "Great review"},
+		{ID: 2, Body: "Agreed", ParentID: parentId(1)},
+		{ID: 3, Body: "Not at all"},
+		{ID: 4, Body: "Why?", ParentID: parentId(2)},
+		{ID: 5, Body: "Reply to a comment of another review", ParentID: parentId(99)},
+	}
+
+	threads := buildThreads(comments)
+	if len(threads) != 3 || threads[0].ID != 1 || threads[1].ID != 3 || threads[2].ID != 5 {
+		t.Fatalf("Expected comments 1, 3 and 5 at the top, got %v", threads)
+	}
+
+	replies := threads[0].Replies
+	if len(replies) != 1 || replies[0].ID != 2 {
+		t.Fatalf("Expected comment 2 to reply to comment 1, got %v", replies)
+	}
+
+	if len(replies[0].Replies) != 1 || replies[0].Replies[0].ID != 4 {
+		t.Errorf("Expected comment 4 to reply to comment 2, got %v", replies[0].Replies)
+	}
+}
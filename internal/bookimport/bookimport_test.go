@@ -0,0 +1,344 @@
+package bookimport
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kaanserin/go-reads/internal/database"
+)
+
+func TestNormalizeISBN(t *testing.T) {
+	valid := map[string]string{
+		"978-0-261-10357-3": "9780261103573",
+		"0 261 10357 1":     "0261103571",
+		"0-8044-2957-x":     "080442957X",
+	}
+
+	for isbn, expected := range valid {
+		normalized, err := NormalizeISBN(isbn)
+		if err != nil {
+			t.Errorf("Expected %q to be valid, got %v", isbn, err)
+		} else if normalized != expected {
+			t.Errorf("Expected %q to become %q, got %q", isbn, expected, normalized)
+		}
+	}
+
+	for _, isbn := range []string{"", "9780261103574", "0261103572", "12345", "97802611035X3"} {
+		if _, err := NormalizeISBN(isbn); err == nil {
+			t.Errorf("Expected %q to be rejected", isbn)
+		}
+	}
+}
+
+func TestParsePublicationDate(t *testing.T) {
+	now := time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)
+	for _, value := range []string{"1954-07-29", "1954-07-29T00:00:00Z", "1954", "2025-05-01"} {
+		if _, err := parsePublicationDate(value, now); err != nil {
+			t.Errorf("Expected %q to be valid, got %v", value, err)
+		}
+	}
+
+	for _, value := range []string{"", "29.07.1954", "2025-07-01"} {
+		if _, err := parsePublicationDate(value, now); err == nil {
+			t.Errorf("Expected %q to be rejected", value)
+		}
+	}
+}
+
+func TestParseCSV(t *testing.T) {
+	file := `Title,Author,Genre,publication_date,Publisher,ISBN,Page Count,Language,Format,Rating
+The Hobbit,J.R.R. Tolkien,Fantasy,1937-09-21,Allen & Unwin,978-0-261-10357-3,310,English,Hardcover,5
+Broken,,Fantasy,1937-09-21,Allen & Unwin,0261103572,many,English,Hardcover,1
+`
+	rows, err := Parse(strings.NewReader(file), FormatCSV)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(rows) != 2 {
+		t.Fatalf("Expected 2 rows, got %d", len(rows))
+	}
+
+	if rows[0].Line != 2 || len(rows[0].Errors) != 0 {
+		t.Errorf("Expected line 2 to be valid, got line %d with %v", rows[0].Line, rows[0].Errors)
+	}
+
+	if rows[0].Book.ISBN != "9780261103573" || rows[0].Book.PageCount != "310" {
+		t.Errorf("Expected the normalized ISBN and page count, got %q and %q", rows[0].Book.ISBN, rows[0].Book.PageCount)
+	}
+
+	if rows[1].Line != 3 || len(rows[1].Errors) != 3 {
+		t.Errorf("Expected line 3 to fail on author, isbn and pageCount, got line %d with %v", rows[1].Line, rows[1].Errors)
+	}
+}
+
+func TestParseMalformedCSV(t *testing.T) {
+	file := `Title,Author,ISBN
+"a"b,J.R.R. Tolkien,978-0-261-10357-3
+The Hobbit,J.R.R. Tolkien,978-0-261-10357-3
+`
+	rows, err := Parse(strings.NewReader(file), FormatCSV)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(rows) != 2 {
+		t.Fatalf("Expected 2 rows, got %d", len(rows))
+	}
+
+	if rows[0].Line != 2 || len(rows[0].Errors) != 1 {
+		t.Errorf("Expected line 2 to fail on its quote, got line %d with %v", rows[0].Line, rows[0].Errors)
+	}
+
+	if rows[1].Line != 3 || rows[1].Book == nil || rows[1].Book.Title != "The Hobbit" {
+		t.Errorf("Expected line 3 to be read after the broken row, got %+v", rows[1])
+	}
+}
+
+func TestParseNDJSON(t *testing.T) {
+	file := `{"title":"The Hobbit","author":"J.R.R. Tolkien","genre":"Fantasy","publicationDate":"1937-09-21T00:00:00Z","publisher":"Allen & Unwin","isbn":9780261103573,"pageCount":310,"language":"English","format":"Hardcover"}
+
+{"title": "Broken"
+`
+	rows, err := Parse(strings.NewReader(file), FormatNDJSON)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(rows) != 2 {
+		t.Fatalf("Expected 2 rows, got %d", len(rows))
+	}
+
+	if len(rows[0].Errors) != 0 || rows[0].Book.ISBN != "9780261103573" {
+		t.Errorf("Expected line 1 to be valid, got %v", rows[0].Errors)
+	}
+
+	if rows[1].Line != 3 || len(rows[1].Errors) != 1 {
+		t.Errorf("Expected line 3 to fail as invalid JSON, got line %d with %v", rows[1].Line, rows[1].Errors)
+	}
+}
+
+type fakeImporter struct {
+	batches [][]*database.ImportBookRow
+	fail    int
+}
+
+func (importer *fakeImporter) ImportBooks(rows []*database.ImportBookRow, dryRun bool) ([]*database.ImportBookResult, error) {
+	importer.batches = append(importer.batches, rows)
+	if len(importer.batches) == importer.fail {
+		return nil, errors.New("batch failed")
+	}
+
+	results := make([]*database.ImportBookResult, 0, len(rows))
+	for _, row := range rows {
+		results = append(results, &database.ImportBookResult{Line: row.Line, BookID: row.Line * 10, Created: row.Line%2 == 0})
+	}
+
+	return results, nil
+}
+
+func validRow(line int, isbn string) *Row {
+	return &Row{Line: line, Book: &database.CreateBookDto{ISBN: isbn}}
+}
+
+func TestRun(t *testing.T) {
+	rows := []*Row{
+		validRow(2, "9780261103573"),
+		validRow(3, "0261103571"),
+		{Line: 4, Errors: []string{"title is required"}},
+		validRow(5, "9780261103573"),
+		validRow(6, "080442957X"),
+	}
+
+	importer := &fakeImporter{fail: 2}
+	report := Run(importer, rows, 2, true)
+
+	if len(importer.batches) != 2 {
+		t.Fatalf("Expected 2 batches, got %d", len(importer.batches))
+	}
+
+	if report.Total != 5 || report.Created != 1 || report.Updated != 1 || report.Failed != 3 {
+		t.Errorf("Unexpected counts %+v", report)
+	}
+
+	expected := []struct {
+		status string
+		bookId int
+	}{
+		{StatusCreated, 0},
+		{StatusUpdated, 30},
+		{StatusFailed, 0},
+		{StatusFailed, 0},
+		{StatusFailed, 0},
+	}
+
+	for i, result := range report.Rows {
+		if result.Status != expected[i].status || result.BookID != expected[i].bookId {
+			t.Errorf("Line %d: expected %s %d, got %s %d", result.Line, expected[i].status, expected[i].bookId, result.Status, result.BookID)
+		}
+	}
+
+	if !strings.Contains(report.Rows[3].Errors[0], "duplicate of line 2") {
+		t.Errorf("Expected line 5 to be reported as duplicate, got %v", report.Rows[3].Errors)
+	}
+
+	if report.Rows[4].Errors[0] != "batch failed" {
+		t.Errorf("Expected line 6 to carry the batch error, got %v", report.Rows[4].Errors)
+	}
+}
+
+const onixMessage = `<?xml version="1.0" encoding="UTF-8"?>
+<ONIXMessage release="3.0" xmlns="http://ns.editeur.org/onix/3.0/reference">
+  <Header><Sender><SenderName>HarperCollins</SenderName></Sender></Header>
+  <Product>
+    <RecordReference>hc-9780261103573</RecordReference>
+    <ProductIdentifier><ProductIDType>15</ProductIDType><IDValue>9780261103573</IDValue></ProductIdentifier>
+    <DescriptiveDetail>
+      <ProductForm>BC</ProductForm>
+      <TitleDetail><TitleType>01</TitleType><TitleElement><TitleElementLevel>01</TitleElementLevel>
+        <TitlePrefix>The</TitlePrefix><TitleWithoutPrefix>Hobbit</TitleWithoutPrefix></TitleElement></TitleDetail>
+      <Contributor><SequenceNumber>2</SequenceNumber><ContributorRole>A12</ContributorRole><PersonName>Alan Lee</PersonName></Contributor>
+      <Contributor><SequenceNumber>1</SequenceNumber><ContributorRole>A01</ContributorRole><NamesBeforeKey>J.R.R.</NamesBeforeKey><KeyNames>Tolkien</KeyNames></Contributor>
+      <Language><LanguageRole>01</LanguageRole><LanguageCode>eng</LanguageCode></Language>
+      <Extent><ExtentType>00</ExtentType><ExtentValue>310</ExtentValue><ExtentUnit>03</ExtentUnit></Extent>
+      <Subject><MainSubject/><SubjectSchemeIdentifier>10</SubjectSchemeIdentifier><SubjectCode>FIC009000</SubjectCode></Subject>
+    </DescriptiveDetail>
+    <PublishingDetail>
+      <Publisher><PublishingRole>01</PublishingRole><PublisherName>HarperCollins</PublisherName></Publisher>
+      <PublishingDate><PublishingDateRole>01</PublishingDateRole><Date dateformat="00">19991004</Date></PublishingDate>
+    </PublishingDetail>
+  </Product>
+</ONIXMessage>`
+
+func TestParseONIX(t *testing.T) {
+	rows, err := Parse(strings.NewReader(onixMessage), FormatONIX)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(rows) != 1 || len(rows[0].Errors) != 0 {
+		t.Fatalf("Expected one valid product, got %+v", rows)
+	}
+
+	row := rows[0]
+	book := row.Book
+	if row.Source != FormatONIX || row.Line != 4 {
+		t.Errorf("Expected an onix row on line 4, got %s on line %d", row.Source, row.Line)
+	}
+
+	if book.Title != "The Hobbit" || book.Author != "J.R.R. Tolkien" || book.Genre != "Fiction" || book.Format != "Paperback" ||
+		book.Language != "English" || book.PageCount != "310" || book.Publisher != "HarperCollins" || book.PublicationDate.Year() != 1999 {
+		t.Errorf("Unexpected book %+v", book)
+	}
+
+	if len(row.Contributors) != 2 || row.Contributors[0].Name != "J.R.R. Tolkien" || row.Contributors[1].Role != database.AuthorRoleIllustrator {
+		t.Errorf("Expected the author before the illustrator, got %+v %+v", row.Contributors[0], row.Contributors[1])
+	}
+}
+
+const marcXML = `<collection xmlns="http://www.loc.gov/MARC21/slim">
+<record>
+  <leader>00000cam a2200000 a 4500</leader>
+  <controlfield tag="008">990101s1937    enk           000 1 eng d</controlfield>
+  <datafield tag="020" ind1=" " ind2=" "><subfield code="a">0261103571 (pbk.)</subfield></datafield>
+  <datafield tag="100" ind1="1" ind2=" "><subfield code="a">Tolkien, J. R. R.,</subfield><subfield code="e">author.</subfield></datafield>
+  <datafield tag="245" ind1="1" ind2="4"><subfield code="a">The hobbit /</subfield><subfield code="c">J.R.R. Tolkien.</subfield></datafield>
+  <datafield tag="264" ind1=" " ind2="1"><subfield code="a">London :</subfield><subfield code="b">Allen &amp; Unwin,</subfield><subfield code="c">[1937]</subfield></datafield>
+  <datafield tag="300" ind1=" " ind2=" "><subfield code="a">310 pages :</subfield></datafield>
+  <datafield tag="655" ind1=" " ind2="7"><subfield code="a">Fantasy fiction.</subfield></datafield>
+  <datafield tag="700" ind1="1" ind2=" "><subfield code="a">Anderson, Douglas A.,</subfield><subfield code="e">editor.</subfield></datafield>
+</record>
+</collection>`
+
+func TestParseHostileMARC(t *testing.T) {
+	valid := encodeMARC([][2]string{{"245", "10$aDune /"}})
+	// Signed or otherwise non numeric lengths, starts and base addresses
+	for _, patch := range []struct {
+		offset int
+		value  string
+	}{{27, "-001"}, {31, "-0001"}, {27, "+001"}, {31, "   01"}, {12, "-0025"}} {
+		record := bytes.Clone(valid)
+		copy(record[patch.offset:], patch.value)
+
+		rows, err := Parse(bytes.NewReader(record), FormatMARC)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(rows) != 1 || len(rows[0].Errors) != 1 {
+			t.Errorf("Expected %q at %d to be rejected, got %+v", patch.value, patch.offset, rows)
+		}
+	}
+}
+
+func TestParseMARCXML(t *testing.T) {
+	rows, err := Parse(strings.NewReader(marcXML), FormatMARCXML)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(rows) != 1 || len(rows[0].Errors) != 0 {
+		t.Fatalf("Expected one valid record, got %+v", rows)
+	}
+
+	book := rows[0].Book
+	if book.Title != "The hobbit" || book.Author != "J. R. R. Tolkien" || book.Publisher != "Allen & Unwin" || book.ISBN != "0261103571" ||
+		book.Format != "Paperback" || book.Genre != "Fantasy fiction" || book.Language != "English" || book.PageCount != "310" ||
+		book.PublicationDate.Year() != 1937 {
+		t.Errorf("Unexpected book %+v", book)
+	}
+
+	if len(rows[0].Contributors) != 2 || rows[0].Contributors[1].Name != "Douglas A. Anderson" || rows[0].Contributors[1].Role != database.AuthorRoleEditor {
+		t.Errorf("Unexpected contributors %+v", rows[0].Contributors)
+	}
+}
+
+// encodeMARC writes fields, tag followed by indicators and $-prefixed subfields, as an ISO 2709 record
+func encodeMARC(fields [][2]string) []byte {
+	var directory, data bytes.Buffer
+	for _, field := range fields {
+		value := strings.ReplaceAll(field[1], "$", string(rune(marcSubfieldMark))) + string(rune(marcFieldTerminator))
+		fmt.Fprintf(&directory, "%s%04d%05d", field[0], len(value), data.Len())
+		data.WriteString(value)
+	}
+	directory.WriteByte(marcFieldTerminator)
+
+	baseAddress := 24 + directory.Len()
+	leader := fmt.Sprintf("%05dnam a22%05d a 4500", baseAddress+data.Len()+1, baseAddress)
+	return append([]byte(leader+directory.String()+data.String()), marcRecordTerminator)
+}
+
+func TestParseMARC(t *testing.T) {
+	file := append(encodeMARC([][2]string{
+		{"008", "990101s1965    nyu           000 1 eng d"},
+		{"020", "  $a9780441013593$q(hardcover)"},
+		{"100", "1 $aHerbert, Frank."},
+		{"245", "10$aDune /"},
+		{"260", "  $aNew York :$bAce Books,$cc1990."},
+		{"300", "  $a604 p. ;"},
+		{"650", " 0$aScience fiction."},
+	}), []byte("not a marc record")...)
+
+	rows, err := Parse(bytes.NewReader(file), FormatMARC)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(rows) != 2 {
+		t.Fatalf("Expected 2 records, got %d", len(rows))
+	}
+
+	book := rows[0].Book
+	if len(rows[0].Errors) != 0 || book.Title != "Dune" || book.Author != "Frank Herbert" || book.Publisher != "Ace Books" ||
+		book.Format != "Hardcover" || book.PageCount != "604" || book.PublicationDate.Year() != 1990 || book.Genre != "Science fiction" {
+		t.Errorf("Unexpected book %+v with %v", book, rows[0].Errors)
+	}
+
+	if rows[1].Line != 2 || len(rows[1].Errors) != 1 {
+		t.Errorf("Expected record 2 to be invalid, got %+v", rows[1])
+	}
+}
@@ -0,0 +1,128 @@
+package bookimport
+
+import (
+	"fmt"
+
+	"github.com/kaanserin/go-reads/internal/database"
+)
+
+// Statuses of an imported row
+const (
+	StatusCreated = "created"
+	StatusUpdated = "updated"
+	StatusFailed  = "failed"
+)
+
+// BookImporter upserts a batch of validated rows, implemented by the database storage
+type BookImporter interface {
+	ImportBooks(rows []*database.ImportBookRow, dryRun bool) ([]*database.ImportBookResult, error)
+}
+
+type RowResult struct {
+	Line   int    `json:"line"`
+	ISBN   string `json:"isbn,omitempty"`
+	Status string `json:"status"`
+	// Omitted for books a dry run would create
+	BookID int      `json:"book_id,omitempty"`
+	Errors []string `json:"errors,omitempty"`
+	// Fields of an updated book that kept the value a librarian gave them
+	Kept []string `json:"kept,omitempty"`
+}
+
+// Report is the per row outcome of an import, ordered by line
+type Report struct {
+	DryRun  bool         `json:"dry_run"`
+	Total   int          `json:"total"`
+	Created int          `json:"created"`
+	Updated int          `json:"updated"`
+	Failed  int          `json:"failed"`
+	Rows    []*RowResult `json:"rows"`
+}
+
+func (report *Report) add(result *RowResult) {
+	switch result.Status {
+	case StatusCreated:
+		report.Created++
+	case StatusUpdated:
+		report.Updated++
+	default:
+		report.Failed++
+	}
+
+	report.Rows = append(report.Rows, result)
+}
+
+// Run imports the valid rows in batches of batchSize, each batch in its own transaction.
+// Invalid rows and later rows repeating an ISBN are reported as failed without reaching the database.
+// When a batch fails every row of it is reported with the error and the import goes on with the next batch.
+func Run(importer BookImporter, rows []*Row, batchSize int, dryRun bool) *Report {
+	if batchSize <= 0 {
+		batchSize = len(rows)
+	}
+
+	report := &Report{DryRun: dryRun, Total: len(rows), Rows: make([]*RowResult, 0, len(rows))}
+	results := make(map[int]*RowResult, len(rows))
+	firstLine := make(map[string]int, len(rows))
+	batch := make([]*database.ImportBookRow, 0, batchSize)
+
+	flush := func() {
+		if len(batch) == 0 {
+			return
+		}
+
+		imported, err := importer.ImportBooks(batch, dryRun)
+		if err != nil {
+			for _, row := range batch {
+				results[row.Line].Errors = []string{err.Error()}
+			}
+		}
+
+		for _, result := range imported {
+			rowResult := results[result.Line]
+			rowResult.Status = StatusUpdated
+			if result.Created {
+				rowResult.Status = StatusCreated
+			}
+
+			if !dryRun || !result.Created {
+				rowResult.BookID = result.BookID
+			}
+
+			if len(result.Kept) > 0 {
+				rowResult.Kept = result.Kept
+			}
+		}
+
+		batch = batch[:0]
+	}
+
+	for _, row := range rows {
+		result := &RowResult{Line: row.Line, Status: StatusFailed, Errors: row.Errors}
+		if row.Book != nil {
+			result.ISBN = row.Book.ISBN
+		}
+		results[row.Line] = result
+
+		if len(row.Errors) > 0 {
+			continue
+		}
+
+		if line, ok := firstLine[row.Book.ISBN]; ok {
+			result.Errors = []string{fmt.Sprintf("isbn %s is a duplicate of line %d", row.Book.ISBN, line)}
+			continue
+		}
+		firstLine[row.Book.ISBN] = row.Line
+
+		batch = append(batch, &database.ImportBookRow{Line: row.Line, Source: row.Source, Book: row.Book, Contributors: row.Contributors})
+		if len(batch) == batchSize {
+			flush()
+		}
+	}
+	flush()
+
+	for _, row := range rows {
+		report.add(results[row.Line])
+	}
+
+	return report
+}
@@ -0,0 +1,322 @@
+package bookimport
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/kaanserin/go-reads/internal/database"
+)
+
+// Separators of ISO 2709 records
+const (
+	marcRecordTerminator = 0x1D
+	marcFieldTerminator  = 0x1E
+	marcSubfieldMark     = 0x1F
+)
+
+// marcRecord is a MARC21 bibliographic record, whether read from ISO 2709 or MARCXML
+type marcRecord struct {
+	Leader        string
+	ControlFields map[string]string
+	DataFields    []*marcField
+}
+
+type marcField struct {
+	Tag       string
+	Ind1      string
+	Ind2      string
+	Subfields []marcSubfield
+}
+
+type marcSubfield struct {
+	Code  string
+	Value string
+}
+
+// subfield returns the first subfield with the code
+func (field *marcField) subfield(code string) string {
+	for _, subfield := range field.Subfields {
+		if subfield.Code == code {
+			return strings.TrimSpace(subfield.Value)
+		}
+	}
+
+	return ""
+}
+
+func (rec *marcRecord) fields(tag string) []*marcField {
+	fields := make([]*marcField, 0)
+	for _, field := range rec.DataFields {
+		if field.Tag == tag {
+			fields = append(fields, field)
+		}
+	}
+
+	return fields
+}
+
+// parseMARC reads binary MARC21 records, Line counts records since the format has no lines.
+// Records are expected in UTF-8, MARC-8 only keeps its ASCII characters.
+func parseMARC(r io.Reader) ([]*Row, error) {
+	reader := bufio.NewReader(r)
+	rows := make([]*Row, 0)
+	for number := 1; ; number++ {
+		data, err := reader.ReadBytes(marcRecordTerminator)
+		if err != nil && !errors.Is(err, io.EOF) {
+			return nil, err
+		}
+
+		if len(bytes.TrimSpace(data)) > 0 {
+			rec, decodeErr := decodeMARC(data)
+			if decodeErr != nil {
+				rows = append(rows, &Row{Line: number, Errors: []string{decodeErr.Error()}})
+			} else {
+				rows = append(rows, newRow(number, rec.record()))
+			}
+		}
+
+		if errors.Is(err, io.EOF) {
+			break
+		}
+	}
+
+	return rows, nil
+}
+
+// decodeMARC decodes an ISO 2709 record, the leader and directory locate every field
+func decodeMARC(data []byte) (*marcRecord, error) {
+	data = bytes.TrimLeft(data, "\r\n ")
+	if len(data) < 25 {
+		return nil, errors.New("invalid MARC record: too short")
+	}
+
+	baseAddress, err := marcNumber(data[12:17])
+	if err != nil || baseAddress < 25 || baseAddress > len(data) {
+		return nil, errors.New("invalid MARC record: bad base address")
+	}
+
+	rec := &marcRecord{Leader: string(data[:24]), ControlFields: map[string]string{}}
+	directory := data[24 : baseAddress-1]
+	for i := 0; i+12 <= len(directory); i += 12 {
+		entry := directory[i : i+12]
+		length, lengthErr := marcNumber(entry[3:7])
+		start, startErr := marcNumber(entry[7:12])
+		if lengthErr != nil || startErr != nil || baseAddress+start+length > len(data) {
+			return nil, fmt.Errorf("invalid MARC record: bad directory entry %q", entry)
+		}
+
+		tag := string(entry[:3])
+		value := bytes.TrimRight(data[baseAddress+start:baseAddress+start+length], string([]byte{marcFieldTerminator, marcRecordTerminator}))
+		if tag < "010" {
+			rec.ControlFields[tag] = string(value)
+			continue
+		}
+
+		if len(value) < 2 {
+			continue
+		}
+
+		field := &marcField{Tag: tag, Ind1: string(value[0]), Ind2: string(value[1])}
+		for _, subfield := range bytes.Split(value[2:], []byte{marcSubfieldMark}) {
+			if len(subfield) > 0 {
+				field.Subfields = append(field.Subfields, marcSubfield{Code: string(subfield[0]), Value: string(subfield[1:])})
+			}
+		}
+		rec.DataFields = append(rec.DataFields, field)
+	}
+
+	return rec, nil
+}
+
+// marcNumber parses the fixed width numbers of the leader and directory, which are plain digits without a sign
+func marcNumber(digits []byte) (int, error) {
+	for _, digit := range digits {
+		if digit < '0' || digit > '9' {
+			return 0, fmt.Errorf("%q is not a number", digits)
+		}
+	}
+
+	return strconv.Atoi(string(digits))
+}
+
+type marcXMLRecord struct {
+	Leader        string `xml:"leader"`
+	ControlFields []struct {
+		Tag   string `xml:"tag,attr"`
+		Value string `xml:",chardata"`
+	} `xml:"controlfield"`
+	DataFields []struct {
+		Tag       string `xml:"tag,attr"`
+		Ind1      string `xml:"ind1,attr"`
+		Ind2      string `xml:"ind2,attr"`
+		Subfields []struct {
+			Code  string `xml:"code,attr"`
+			Value string `xml:",chardata"`
+		} `xml:"subfield"`
+	} `xml:"datafield"`
+}
+
+// parseMARCXML reads the records of a MARCXML collection, Line is the line a record starts on
+func parseMARCXML(r io.Reader) ([]*Row, error) {
+	decoder := xml.NewDecoder(r)
+	rows := make([]*Row, 0)
+	for {
+		token, err := decoder.Token()
+		if errors.Is(err, io.EOF) {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+
+		start, ok := token.(xml.StartElement)
+		if !ok || start.Name.Local != "record" {
+			continue
+		}
+
+		line, _ := decoder.InputPos()
+		xmlRecord := &marcXMLRecord{}
+		if err := decoder.DecodeElement(xmlRecord, &start); err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+
+		rec := &marcRecord{Leader: xmlRecord.Leader, ControlFields: map[string]string{}}
+		for _, controlField := range xmlRecord.ControlFields {
+			rec.ControlFields[controlField.Tag] = controlField.Value
+		}
+
+		for _, dataField := range xmlRecord.DataFields {
+			field := &marcField{Tag: dataField.Tag, Ind1: dataField.Ind1, Ind2: dataField.Ind2}
+			for _, subfield := range dataField.Subfields {
+				field.Subfields = append(field.Subfields, marcSubfield{Code: subfield.Code, Value: subfield.Value})
+			}
+			rec.DataFields = append(rec.DataFields, field)
+		}
+
+		rows = append(rows, newRow(line, rec.record()))
+	}
+
+	return rows, nil
+}
+
+var pagesPattern = regexp.MustCompile(`(\d+)\s*(?:p\b|pages)`)
+
+// record maps the MARC21 bibliographic fields onto a catalog row
+func (marc *marcRecord) record() *record {
+	rec := &record{}
+
+	// 020 International Standard Book Number, $a may carry its qualifier as in "0261103571 (pbk.)"
+	qualifier := ""
+	for _, field := range marc.fields("020") {
+		isbn, rest, _ := strings.Cut(field.subfield("a"), " ")
+		if _, err := NormalizeISBN(isbn); err != nil || rec.ISBN != "" {
+			continue
+		}
+
+		rec.ISBN = flexString(isbn)
+		qualifier = field.subfield("q")
+		if qualifier == "" {
+			qualifier = rest
+		}
+	}
+
+	// 245 Title Statement
+	for _, field := range marc.fields("245") {
+		rec.Title = flexString(trimPunctuation(field.subfield("a")))
+	}
+
+	// 100 Main Entry and 700 Added Entries of personal names, with their relator term or code
+	for _, tag := range []string{"100", "700"} {
+		for _, field := range marc.fields(tag) {
+			name := invertName(field.subfield("a"))
+			if name == "" {
+				continue
+			}
+
+			role := contributorRole(field.subfield("4"))
+			if role == "" {
+				role = contributorRole(field.subfield("e"))
+			}
+
+			if role == "" && (field.subfield("e") == "" && field.subfield("4") == "") {
+				role = database.AuthorRoleAuthor
+			}
+
+			if role != "" {
+				rec.contributors = append(rec.contributors, &database.ImportContributor{Name: name, Role: role})
+			}
+		}
+	}
+
+	// 264 Publication statement, or 260 in older records
+	for _, tag := range []string{"264", "260"} {
+		for _, field := range marc.fields(tag) {
+			if rec.Publisher != "" || (tag == "264" && field.Ind2 != "1") {
+				continue
+			}
+
+			rec.Publisher = flexString(strings.Trim(trimPunctuation(field.subfield("b")), "[]"))
+			rec.PublicationDate = flexString(year(field.subfield("c")))
+		}
+	}
+
+	fixed := marc.ControlFields["008"]
+	if rec.PublicationDate == "" && len(fixed) >= 11 {
+		rec.PublicationDate = flexString(year(fixed[7:11]))
+	}
+
+	// 300 Physical Description, as in "xii, 310 p. :"
+	for _, field := range marc.fields("300") {
+		if match := pagesPattern.FindStringSubmatch(field.subfield("a")); match != nil {
+			rec.PageCount = flexString(match[1])
+		}
+	}
+
+	// 008/35-37 Language, or 041 Language Code
+	if len(fixed) >= 38 && strings.TrimSpace(fixed[35:38]) != "" {
+		rec.Language = flexString(languageName(fixed[35:38]))
+	}
+
+	for _, field := range marc.fields("041") {
+		if rec.Language == "" {
+			rec.Language = flexString(languageName(field.subfield("a")))
+		}
+	}
+
+	// 655 Genre/Form, or else the first 650 Topical Term
+	for _, tag := range []string{"655", "650"} {
+		for _, field := range marc.fields(tag) {
+			if rec.Genre == "" {
+				rec.Genre = flexString(strings.TrimRight(trimPunctuation(field.subfield("a")), "."))
+			}
+		}
+	}
+
+	rec.Format = flexString(marc.format(qualifier))
+	return rec
+}
+
+// format names the format from the ISBN qualifier, 338 Carrier Type or leader/06 Type of record
+func (marc *marcRecord) format(qualifier string) string {
+	if format := formatName(qualifier); format != "" {
+		return format
+	}
+
+	for _, field := range marc.fields("338") {
+		if strings.Contains(field.subfield("a"), "online resource") {
+			return "Ebook"
+		}
+	}
+
+	if len(marc.Leader) > 6 && marc.Leader[6] == 'i' {
+		return "Audiobook"
+	}
+
+	return "Print"
+}
@@ -0,0 +1,137 @@
+package bookimport
+
+import (
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/kaanserin/go-reads/internal/database"
+)
+
+// Helpers shared by the library and publisher formats, which use code lists where our books use names
+
+// languageNames maps ISO 639-2 codes, both bibliographic and terminology ones, onto the names books use
+var languageNames = map[string]string{
+	"ara": "Arabic", "chi": "Chinese", "zho": "Chinese", "cze": "Czech", "ces": "Czech", "dan": "Danish",
+	"dut": "Dutch", "nld": "Dutch", "eng": "English", "fin": "Finnish", "fre": "French", "fra": "French",
+	"ger": "German", "deu": "German", "gre": "Greek", "ell": "Greek", "heb": "Hebrew", "hin": "Hindi",
+	"hun": "Hungarian", "ita": "Italian", "jpn": "Japanese", "kor": "Korean", "lat": "Latin", "nor": "Norwegian",
+	"per": "Persian", "fas": "Persian", "pol": "Polish", "por": "Portuguese", "rus": "Russian", "spa": "Spanish",
+	"swe": "Swedish", "tur": "Turkish", "ukr": "Ukrainian",
+}
+
+// languageName names a language code, unknown codes are kept as they are
+func languageName(code string) string {
+	code = strings.ToLower(strings.TrimSpace(code))
+	if name, ok := languageNames[code]; ok {
+		return name
+	}
+
+	return code
+}
+
+// bisacSections names the sections of BISAC subject codes, FIC009000 is filed under Fiction
+var bisacSections = map[string]string{
+	"ANT": "Antiques & Collectibles", "ARC": "Architecture", "ART": "Art", "BIB": "Bibles", "BIO": "Biography & Autobiography",
+	"BUS": "Business & Economics", "CGN": "Comics & Graphic Novels", "CKB": "Cooking", "COM": "Computers", "CRA": "Crafts & Hobbies",
+	"DRA": "Drama", "EDU": "Education", "FAM": "Family & Relationships", "FIC": "Fiction", "FOR": "Foreign Language Study",
+	"GAM": "Games & Activities", "GAR": "Gardening", "HEA": "Health & Fitness", "HIS": "History", "HOM": "House & Home",
+	"HUM": "Humor", "JNF": "Juvenile Nonfiction", "JUV": "Juvenile Fiction", "LAN": "Language Arts & Disciplines", "LAW": "Law",
+	"LCO": "Literary Collections", "LIT": "Literary Criticism", "MAT": "Mathematics", "MED": "Medical", "MUS": "Music",
+	"NAT": "Nature", "OCC": "Body, Mind & Spirit", "PER": "Performing Arts", "PET": "Pets", "PHI": "Philosophy",
+	"PHO": "Photography", "POE": "Poetry", "POL": "Political Science", "PSY": "Psychology", "REF": "Reference",
+	"REL": "Religion", "SCI": "Science", "SEL": "Self-Help", "SOC": "Social Science", "SPO": "Sports & Recreation",
+	"STU": "Study Aids", "TEC": "Technology & Engineering", "TRA": "Transportation", "TRU": "True Crime", "TRV": "Travel",
+	"YAF": "Young Adult Fiction", "YAN": "Young Adult Nonfiction",
+}
+
+func bisacSection(code string) string {
+	if len(code) < 3 {
+		return ""
+	}
+
+	return bisacSections[strings.ToUpper(code[:3])]
+}
+
+// contributorRoles maps ONIX contributor role codes and MARC relator codes and terms onto author roles
+var contributorRoles = map[string]string{
+	"A01": database.AuthorRoleAuthor, "B06": database.AuthorRoleTranslator, "A12": database.AuthorRoleIllustrator, "B01": database.AuthorRoleEditor,
+	"aut": database.AuthorRoleAuthor, "trl": database.AuthorRoleTranslator, "ill": database.AuthorRoleIllustrator, "edt": database.AuthorRoleEditor,
+}
+
+// contributorRole maps a role code or a relator term such as "translator." onto an author role, other roles are empty
+func contributorRole(code string) string {
+	code = strings.TrimRight(strings.TrimSpace(code), ".,")
+	if role, ok := contributorRoles[code]; ok {
+		return role
+	}
+
+	if slices.Contains(database.AuthorRoles, strings.ToLower(code)) {
+		return strings.ToLower(code)
+	}
+
+	return ""
+}
+
+// formatNames maps ONIX product forms and the qualifiers of MARC ISBNs onto the formats books use
+var formatNames = map[string]string{
+	"BB": "Hardcover", "BC": "Paperback", "BA": "Book", "BH": "Board Book",
+	"hardcover": "Hardcover", "hardback": "Hardcover", "hbk": "Hardcover", "hb": "Hardcover", "cloth": "Hardcover",
+	"paperback": "Paperback", "pbk": "Paperback", "pb": "Paperback", "trade paperback": "Paperback", "softcover": "Paperback",
+	"ebook": "Ebook", "e-book": "Ebook", "electronic": "Ebook", "electronic bk": "Ebook", "online": "Ebook",
+	"audiobook": "Audiobook", "audio": "Audiobook",
+}
+
+// formatName names an ONIX product form or a MARC qualifier, ebooks and audiobooks are named by their ONIX form group
+func formatName(form string) string {
+	form = strings.TrimSpace(form)
+	if name, ok := formatNames[form]; ok {
+		return name
+	}
+
+	if name, ok := formatNames[strings.ToLower(strings.Trim(form, "().: "))]; ok {
+		return name
+	}
+
+	switch {
+	case len(form) == 2 && form[0] == 'E':
+		return "Ebook"
+	case len(form) == 2 && form[0] == 'A':
+		return "Audiobook"
+	}
+
+	return ""
+}
+
+// invertName turns the catalog form "Tolkien, J. R. R." into "J. R. R. Tolkien"
+func invertName(name string) string {
+	name = trimPunctuation(name)
+
+	// The closing period of "Herbert, Frank." goes, the one of an initial stays
+	if words := strings.Fields(name); len(words) > 0 && len(words[len(words)-1]) > 2 {
+		name = strings.TrimSuffix(name, ".")
+	}
+
+	last, first, ok := strings.Cut(name, ", ")
+	if !ok {
+		return name
+	}
+
+	return strings.TrimSpace(first) + " " + strings.TrimSpace(last)
+}
+
+// trimPunctuation strips the punctuation catalogs end fields with, as in "The hobbit /" or "Allen & Unwin,"
+func trimPunctuation(value string) string {
+	return strings.TrimSpace(strings.TrimRight(strings.TrimSpace(value), " /:;,="))
+}
+
+var yearPattern = regexp.MustCompile(`(?:^|\D)(1[0-9]{3}|20[0-9]{2})(?:\D|$)`)
+
+// year finds the year of a catalog date such as "c1999." or "[1937]"
+func year(value string) string {
+	if match := yearPattern.FindStringSubmatch(value); match != nil {
+		return match[1]
+	}
+
+	return ""
+}
@@ -0,0 +1,231 @@
+package bookimport
+
+import (
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+
+	"github.com/kaanserin/go-reads/internal/database"
+)
+
+// ONIX 3.0 product record in reference tag names, only the elements books are built from
+type onixProduct struct {
+	Identifiers []struct {
+		Type  string `xml:"ProductIDType"`
+		Value string `xml:"IDValue"`
+	} `xml:"ProductIdentifier"`
+	Descriptive struct {
+		ProductForm  string            `xml:"ProductForm"`
+		Titles       []onixTitleDetail `xml:"TitleDetail"`
+		Contributors []onixContributor `xml:"Contributor"`
+		Languages    []struct {
+			Role string `xml:"LanguageRole"`
+			Code string `xml:"LanguageCode"`
+		} `xml:"Language"`
+		Extents []struct {
+			Type  string `xml:"ExtentType"`
+			Value string `xml:"ExtentValue"`
+			Unit  string `xml:"ExtentUnit"`
+		} `xml:"Extent"`
+		Subjects []struct {
+			Main    *struct{} `xml:"MainSubject"`
+			Scheme  string    `xml:"SubjectSchemeIdentifier"`
+			Code    string    `xml:"SubjectCode"`
+			Heading string    `xml:"SubjectHeadingText"`
+		} `xml:"Subject"`
+	} `xml:"DescriptiveDetail"`
+	Publishing struct {
+		Publishers []struct {
+			Role string `xml:"PublishingRole"`
+			Name string `xml:"PublisherName"`
+		} `xml:"Publisher"`
+		Dates []struct {
+			Role string `xml:"PublishingDateRole"`
+			Date struct {
+				Format string `xml:"dateformat,attr"`
+				Value  string `xml:",chardata"`
+			} `xml:"Date"`
+		} `xml:"PublishingDate"`
+	} `xml:"PublishingDetail"`
+}
+
+type onixTitleDetail struct {
+	Type     string `xml:"TitleType"`
+	Elements []struct {
+		Level         string `xml:"TitleElementLevel"`
+		Text          string `xml:"TitleText"`
+		Prefix        string `xml:"TitlePrefix"`
+		WithoutPrefix string `xml:"TitleWithoutPrefix"`
+	} `xml:"TitleElement"`
+}
+
+type onixContributor struct {
+	Sequence       int      `xml:"SequenceNumber"`
+	Roles          []string `xml:"ContributorRole"`
+	PersonName     string   `xml:"PersonName"`
+	NameInverted   string   `xml:"PersonNameInverted"`
+	NamesBeforeKey string   `xml:"NamesBeforeKey"`
+	KeyNames       string   `xml:"KeyNames"`
+	CorporateName  string   `xml:"CorporateName"`
+}
+
+// parseONIX reads the products of an ONIX 3.0 message, Line is the line a product starts on
+func parseONIX(r io.Reader) ([]*Row, error) {
+	decoder := xml.NewDecoder(r)
+	rows := make([]*Row, 0)
+	for {
+		token, err := decoder.Token()
+		if errors.Is(err, io.EOF) {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+
+		start, ok := token.(xml.StartElement)
+		if !ok {
+			continue
+		}
+
+		switch start.Name.Local {
+		case "ONIXmessage":
+			return nil, errors.New("ONIX short tags are not supported, please send the message with reference tags")
+		case "Product":
+			line, _ := decoder.InputPos()
+			product := &onixProduct{}
+			if err := decoder.DecodeElement(product, &start); err != nil {
+				return nil, fmt.Errorf("line %d: %w", line, err)
+			}
+
+			rows = append(rows, newRow(line, product.record()))
+		}
+	}
+
+	return rows, nil
+}
+
+func (product *onixProduct) record() *record {
+	rec := &record{}
+	descriptive, publishing := &product.Descriptive, &product.Publishing
+
+	// ISBN-13, then GTIN-13 of books, then ISBN-10
+	for _, idType := range []string{"15", "03", "02"} {
+		for _, identifier := range product.Identifiers {
+			if identifier.Type == idType && rec.ISBN == "" {
+				rec.ISBN = flexString(identifier.Value)
+			}
+		}
+	}
+
+	for _, title := range descriptive.Titles {
+		if title.Type != "01" || rec.Title != "" {
+			continue
+		}
+
+		for _, element := range title.Elements {
+			if element.Level != "01" && element.Level != "" {
+				continue
+			}
+
+			text := element.Text
+			if text == "" {
+				text = strings.TrimSpace(element.Prefix + " " + element.WithoutPrefix)
+			}
+			rec.Title = flexString(text)
+			break
+		}
+	}
+
+	contributors := slices.Clone(descriptive.Contributors)
+	slices.SortStableFunc(contributors, func(a, b onixContributor) int { return a.Sequence - b.Sequence })
+	for _, contributor := range contributors {
+		name := contributor.name()
+		if name == "" {
+			continue
+		}
+
+		for _, code := range contributor.Roles {
+			if role := contributorRole(code); role != "" {
+				rec.contributors = append(rec.contributors, &database.ImportContributor{Name: name, Role: role})
+				break
+			}
+		}
+	}
+
+	for _, language := range descriptive.Languages {
+		if language.Role == "01" {
+			rec.Language = flexString(languageName(language.Code))
+			break
+		}
+	}
+
+	// Main content page count first, then any count in pages
+	for _, extentType := range []string{"00", ""} {
+		for _, extent := range descriptive.Extents {
+			if extent.Unit == "03" && (extentType == "" || extent.Type == extentType) && rec.PageCount == "" {
+				rec.PageCount = flexString(extent.Value)
+			}
+		}
+	}
+
+	// The main subject first, then any subject with a heading or a BISAC code
+	for _, main := range []bool{true, false} {
+		for _, subject := range descriptive.Subjects {
+			if rec.Genre != "" || (main && subject.Main == nil) {
+				continue
+			}
+
+			if subject.Heading != "" {
+				rec.Genre = flexString(subject.Heading)
+			} else if subject.Scheme == "10" {
+				rec.Genre = flexString(bisacSection(subject.Code))
+			}
+		}
+	}
+
+	rec.Format = flexString(formatName(descriptive.ProductForm))
+
+	for _, publisher := range publishing.Publishers {
+		if publisher.Role == "01" {
+			rec.Publisher = flexString(publisher.Name)
+			break
+		}
+	}
+
+	for _, date := range publishing.Dates {
+		if date.Role == "01" {
+			rec.PublicationDate = flexString(onixDate(date.Date.Format, date.Date.Value))
+			break
+		}
+	}
+
+	return rec
+}
+
+func (contributor *onixContributor) name() string {
+	switch {
+	case contributor.PersonName != "":
+		return strings.TrimSpace(contributor.PersonName)
+	case contributor.KeyNames != "":
+		return strings.TrimSpace(contributor.NamesBeforeKey + " " + contributor.KeyNames)
+	case contributor.NameInverted != "":
+		return invertName(contributor.NameInverted)
+	}
+
+	return strings.TrimSpace(contributor.CorporateName)
+}
+
+// onixDate turns ONIX dates, YYYYMMDD unless the dateformat says YYYYMM or YYYY, into the layouts publication dates accept
+func onixDate(format string, value string) string {
+	value = strings.TrimSpace(value)
+	switch {
+	case (format == "" || format == "00") && len(value) == 8:
+		return value[:4] + "-" + value[4:6] + "-" + value[6:]
+	case format == "01" && len(value) == 6:
+		return value[:4] + "-" + value[4:]
+	}
+
+	return value
+}
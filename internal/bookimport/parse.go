@@ -0,0 +1,299 @@
+package bookimport
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/kaanserin/go-reads/internal/database"
+)
+
+// Formats of catalog files
+const (
+	FormatCSV     = "csv"
+	FormatNDJSON  = "ndjson"
+	FormatONIX    = "onix"
+	FormatMARC    = "marc"
+	FormatMARCXML = "marcxml"
+)
+
+// Row is a parsed catalog row, Errors lists why it can not be imported
+type Row struct {
+	// Line of the row in the file, the CSV header is line 1. Binary MARC files count records instead.
+	Line int
+	// Format the row was read from
+	Source       string
+	Book         *database.CreateBookDto
+	Contributors []*database.ImportContributor
+	Errors       []string
+}
+
+// FormatFromName guesses the format of a catalog file from its name or content type, NDJSON unless it looks like another format
+func FormatFromName(name string) string {
+	name = strings.ToLower(name)
+	switch {
+	case filepath.Ext(name) == ".csv" || strings.Contains(name, "text/csv"):
+		return FormatCSV
+	case strings.Contains(name, "onix"):
+		return FormatONIX
+	case strings.Contains(name, "marcxml") || strings.Contains(name, "marc+xml"):
+		return FormatMARCXML
+	case filepath.Ext(name) == ".mrc" || strings.Contains(name, "marc21") || strings.HasSuffix(name, "/marc"):
+		return FormatMARC
+	}
+
+	return FormatNDJSON
+}
+
+// Parse reads every row of a catalog file in the Book field layout.
+// Rows that can not be parsed are returned with their errors, only unreadable files fail as a whole.
+func Parse(r io.Reader, format string) ([]*Row, error) {
+	var rows []*Row
+	var err error
+	switch format {
+	case FormatCSV:
+		rows, err = parseCSV(r)
+	case FormatNDJSON, "json":
+		format = FormatNDJSON
+		rows, err = parseNDJSON(r)
+	case FormatONIX:
+		rows, err = parseONIX(r)
+	case FormatMARC:
+		rows, err = parseMARC(r)
+	case FormatMARCXML:
+		rows, err = parseMARCXML(r)
+	default:
+		return nil, fmt.Errorf("unknown format %q, expected one of %s", format, strings.Join(Formats, ", "))
+	}
+
+	for _, row := range rows {
+		row.Source = format
+	}
+
+	return rows, err
+}
+
+var Formats = []string{FormatCSV, FormatNDJSON, FormatONIX, FormatMARC, FormatMARCXML}
+
+// record is a catalog row before validation, every field is kept as text
+type record struct {
+	Title           flexString `json:"title"`
+	Author          flexString `json:"author"`
+	Genre           flexString `json:"genre"`
+	PublicationDate flexString `json:"publicationDate"`
+	Publisher       flexString `json:"publisher"`
+	ISBN            flexString `json:"isbn"`
+	PageCount       flexString `json:"pageCount"`
+	Language        flexString `json:"language"`
+	Format          flexString `json:"format"`
+
+	// Credits in order, filled in by the library and publisher formats
+	contributors []*database.ImportContributor
+}
+
+// flexString accepts JSON strings and numbers, catalogs disagree on whether ISBNs and page counts are numbers
+type flexString string
+
+func (s *flexString) UnmarshalJSON(data []byte) error {
+	if bytes.Equal(data, []byte("null")) {
+		return nil
+	}
+
+	if len(data) > 0 && data[0] == '"' {
+		var value string
+		if err := json.Unmarshal(data, &value); err != nil {
+			return err
+		}
+
+		*s = flexString(value)
+		return nil
+	}
+
+	var number json.Number
+	if err := json.Unmarshal(data, &number); err != nil {
+		return err
+	}
+
+	*s = flexString(number.String())
+	return nil
+}
+
+// csvColumns maps normalized CSV headers onto record fields, both the JSON and the database names are accepted
+var csvColumns = map[string]func(r *record) *flexString{
+	"title":           func(r *record) *flexString { return &r.Title },
+	"author":          func(r *record) *flexString { return &r.Author },
+	"genre":           func(r *record) *flexString { return &r.Genre },
+	"publicationdate": func(r *record) *flexString { return &r.PublicationDate },
+	"publisher":       func(r *record) *flexString { return &r.Publisher },
+	"isbn":            func(r *record) *flexString { return &r.ISBN },
+	"pagecount":       func(r *record) *flexString { return &r.PageCount },
+	"language":        func(r *record) *flexString { return &r.Language },
+	"format":          func(r *record) *flexString { return &r.Format },
+}
+
+func normalizeHeader(header string) string {
+	header = strings.TrimPrefix(header, "\ufeff")
+	return strings.NewReplacer("_", "", " ", "", "-", "").Replace(strings.ToLower(strings.TrimSpace(header)))
+}
+
+func parseCSV(r io.Reader) ([]*Row, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+
+	header, err := reader.Read()
+	if errors.Is(err, io.EOF) {
+		return []*Row{}, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	columns := make([]func(r *record) *flexString, len(header))
+	for i, name := range header {
+		columns[i] = csvColumns[normalizeHeader(name)]
+	}
+
+	rows := make([]*Row, 0)
+	for {
+		fields, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+
+		// FieldPos is only valid after a successful Read
+		var parseErr *csv.ParseError
+		if errors.As(err, &parseErr) {
+			rows = append(rows, &Row{Line: parseErr.Line, Errors: []string{parseErr.Err.Error()}})
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+
+		line, _ := reader.FieldPos(0)
+
+		rec := &record{}
+		for i, value := range fields {
+			if i < len(columns) && columns[i] != nil {
+				*columns[i](rec) = flexString(value)
+			}
+		}
+
+		rows = append(rows, newRow(line, rec))
+	}
+
+	return rows, nil
+}
+
+func parseNDJSON(r io.Reader) ([]*Row, error) {
+	rows := make([]*Row, 0)
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		if len(bytes.TrimSpace(scanner.Bytes())) == 0 {
+			continue
+		}
+
+		rec := &record{}
+		if err := json.Unmarshal(scanner.Bytes(), rec); err != nil {
+			rows = append(rows, &Row{Line: line, Errors: []string{"invalid JSON: " + err.Error()}})
+			continue
+		}
+
+		rows = append(rows, newRow(line, rec))
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return rows, nil
+}
+
+// newRow validates a record and converts it into the book to import
+func newRow(line int, rec *record) *Row {
+	row := &Row{
+		Line: line,
+		Book: &database.CreateBookDto{
+			Title:     strings.TrimSpace(string(rec.Title)),
+			Author:    strings.TrimSpace(string(rec.Author)),
+			Genre:     strings.TrimSpace(string(rec.Genre)),
+			Publisher: strings.TrimSpace(string(rec.Publisher)),
+			Language:  strings.TrimSpace(string(rec.Language)),
+			Format:    strings.TrimSpace(string(rec.Format)),
+		},
+	}
+
+	// Only the credited authors make it into the author text, the other contributors are linked by role
+	if row.Book.Author == "" {
+		authors := make([]string, 0, len(rec.contributors))
+		for _, contributor := range rec.contributors {
+			if contributor.Role == database.AuthorRoleAuthor {
+				authors = append(authors, contributor.Name)
+			}
+		}
+		row.Book.Author = truncate(strings.Join(authors, ", "), 100)
+	}
+
+	for _, contributor := range rec.contributors {
+		if len([]rune(contributor.Name)) > 200 {
+			row.Errors = append(row.Errors, fmt.Sprintf("contributor %s can be at most 200 characters long", contributor.Name))
+		}
+	}
+	row.Contributors = rec.contributors
+
+	required := []struct {
+		field string
+		value string
+		max   int
+	}{
+		{"title", row.Book.Title, 100},
+		{"author", row.Book.Author, 100},
+		{"genre", row.Book.Genre, 50},
+		{"publisher", row.Book.Publisher, 100},
+		{"language", row.Book.Language, 50},
+		{"format", row.Book.Format, 50},
+	}
+
+	for _, field := range required {
+		if field.value == "" {
+			row.Errors = append(row.Errors, field.field+" is required")
+		} else if len([]rune(field.value)) > field.max {
+			row.Errors = append(row.Errors, fmt.Sprintf("%s can be at most %d characters long", field.field, field.max))
+		}
+	}
+
+	isbn, err := NormalizeISBN(string(rec.ISBN))
+	if err != nil {
+		row.Errors = append(row.Errors, err.Error())
+	}
+	row.Book.ISBN = isbn
+
+	publicationDate, err := parsePublicationDate(string(rec.PublicationDate), time.Now())
+	if err != nil {
+		row.Errors = append(row.Errors, err.Error())
+	}
+	row.Book.PublicationDate = publicationDate
+
+	pageCount, err := parsePageCount(string(rec.PageCount))
+	if err != nil {
+		row.Errors = append(row.Errors, err.Error())
+	}
+	row.Book.PageCount = pageCount
+
+	return row
+}
+
+// truncate shortens s to at most max runes
+func truncate(s string, max int) string {
+	if runes := []rune(s); len(runes) > max {
+		return string(runes[:max])
+	}
+
+	return s
+}
@@ -0,0 +1,105 @@
+package bookimport
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// NormalizeISBN strips hyphens and spaces from an ISBN-10 or ISBN-13 and verifies its check digit
+func NormalizeISBN(isbn string) (string, error) {
+	isbn = strings.ToUpper(strings.NewReplacer("-", "", " ", "").Replace(strings.TrimSpace(isbn)))
+	if isbn == "" {
+		return "", errors.New("isbn is required")
+	}
+
+	switch len(isbn) {
+	case 10:
+		sum := 0
+		for i, r := range isbn {
+			digit := int(r - '0')
+			if r == 'X' && i == 9 {
+				digit = 10
+			} else if r < '0' || r > '9' {
+				return "", fmt.Errorf("isbn %s contains invalid characters", isbn)
+			}
+
+			sum += (10 - i) * digit
+		}
+
+		if sum%11 != 0 {
+			return "", fmt.Errorf("isbn %s has an invalid check digit", isbn)
+		}
+	case 13:
+		sum := 0
+		for i, r := range isbn {
+			if r < '0' || r > '9' {
+				return "", fmt.Errorf("isbn %s contains invalid characters", isbn)
+			}
+
+			weight := 1
+			if i%2 == 1 {
+				weight = 3
+			}
+			sum += weight * int(r-'0')
+		}
+
+		if sum%10 != 0 {
+			return "", fmt.Errorf("isbn %s has an invalid check digit", isbn)
+		}
+	default:
+		return "", fmt.Errorf("isbn %s must have 10 or 13 digits", isbn)
+	}
+
+	return isbn, nil
+}
+
+// Layouts accepted for publication dates
+var dateLayouts = []string{"2006-01-02", time.RFC3339, "2006/01/02", "2006-01", "2006"}
+
+// parsePublicationDate accepts full dates, RFC 3339 timestamps and, for older catalogs, bare months and years.
+// Dates more than a year ahead are rejected, announced books are rarely listed earlier.
+func parsePublicationDate(value string, now time.Time) (time.Time, error) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return time.Time{}, errors.New("publicationDate is required")
+	}
+
+	for _, layout := range dateLayouts {
+		date, err := time.Parse(layout, value)
+		if err != nil {
+			continue
+		}
+
+		if date.After(now.AddDate(1, 0, 0)) {
+			return time.Time{}, fmt.Errorf("publicationDate %s is more than a year in the future", value)
+		}
+
+		return date, nil
+	}
+
+	return time.Time{}, fmt.Errorf("publicationDate %s is not a date such as 2006-01-02", value)
+}
+
+// Largest page count the SMALLINT books.page_count column holds
+const maxPageCount = 32767
+
+func parsePageCount(value string) (string, error) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return "", errors.New("pageCount is required")
+	}
+
+	pageCount, err := strconv.Atoi(value)
+	if err != nil {
+		return "", fmt.Errorf("pageCount %s is not a whole number", value)
+	}
+
+	if pageCount <= 0 || pageCount > maxPageCount {
+		return "", fmt.Errorf("pageCount must be between 1 and %d", maxPageCount)
+	}
+
+	return strconv.Itoa(pageCount), nil
+}
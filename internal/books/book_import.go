@@ -0,0 +1,149 @@
+package books
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kaanserin/go-reads/internal/bookimport"
+	"github.com/kaanserin/go-reads/internal/config"
+	"github.com/kaanserin/go-reads/internal/database"
+	"github.com/kaanserin/go-reads/internal/utils"
+	"gopkg.in/validator.v2"
+)
+
+func createBook(covers *BookCovers) func(c *gin.Context) error {
+	return func(c *gin.Context) error {
+		var createBookDto *database.CreateBookDto = &database.CreateBookDto{}
+		if err := json.NewDecoder(c.Request.Body).Decode(createBookDto); err != nil {
+			return &utils.CustomError{
+				Message: "Please send the book as a JSON object",
+			}
+		}
+
+		if err := validator.Validate(createBookDto); err != nil {
+			return err
+		}
+
+		isbn, err := bookimport.NormalizeISBN(createBookDto.ISBN)
+		if err != nil {
+			return err
+		}
+		createBookDto.ISBN = isbn
+
+		storage, err := database.GetPgStorageFromRequest(c.Request)
+		if err != nil {
+			return err
+		}
+
+		book, err := storage.CreateBook(createBookDto)
+		if errors.Is(err, database.ErrDuplicateISBN) {
+			c.JSON(http.StatusConflict, utils.CustomError{
+				Message: fmt.Sprintf("A book with ISBN %s already exists", createBookDto.ISBN),
+			})
+
+			return nil
+		} else if err != nil {
+			return err
+		}
+
+		covers.Resolve(c.Request.Context(), book)
+		c.JSON(http.StatusCreated, book)
+		return nil
+	}
+}
+
+// importBooks upserts the books of a CSV, newline delimited JSON, ONIX or MARC21 body by ISBN and reports the outcome of every row.
+// The format is taken from ?format= or else the content type, ?dry_run=true validates and matches without saving.
+func importBooks(cfg *config.Config) func(c *gin.Context) error {
+	return func(c *gin.Context) error {
+		format := c.Query("format")
+		if format == "" {
+			format = bookimport.FormatFromName(c.ContentType())
+		}
+
+		dryRun, _ := strconv.ParseBool(c.Query("dry_run"))
+
+		body := http.MaxBytesReader(c.Writer, c.Request.Body, cfg.Import.MaxUploadBytes)
+		rows, err := bookimport.Parse(body, format)
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			c.JSON(http.StatusRequestEntityTooLarge, utils.CustomError{
+				Message: fmt.Sprintf("Import files can be at most %d bytes", maxBytesErr.Limit),
+			})
+			return nil
+		} else if err != nil {
+			return err
+		}
+
+		if len(rows) == 0 {
+			return &utils.CustomError{
+				Message: "The import file has no rows",
+			}
+		}
+
+		storage, err := database.GetPgStorageFromRequest(c.Request)
+		if err != nil {
+			return err
+		}
+
+		c.JSON(http.StatusOK, bookimport.Run(storage, rows, cfg.Import.BatchSize, dryRun))
+		return nil
+	}
+}
+
+// getBookFieldSources tells where every field of the book came from, manual fields are kept by imports
+func getBookFieldSources(c *gin.Context) error {
+	storage, err := database.GetPgStorageFromRequest(c.Request)
+	if err != nil {
+		return err
+	}
+
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return &utils.CustomError{
+			Message: "Please enter a valid integer for id",
+		}
+	}
+
+	sources, err := storage.GetBookFieldSources(id)
+	if err != nil {
+		return err
+	}
+
+	c.JSON(http.StatusOK, sources)
+	return nil
+}
+
+// unlockBookField lets the next import overwrite a field librarians edited
+func unlockBookField(c *gin.Context) error {
+	storage, err := database.GetPgStorageFromRequest(c.Request)
+	if err != nil {
+		return err
+	}
+
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return &utils.CustomError{
+			Message: "Please enter a valid integer for id",
+		}
+	}
+
+	field := c.Param("field")
+	if !slices.Contains(database.BookFields, field) {
+		return &utils.CustomError{
+			Message: fmt.Sprintf("Field must be one of %s", strings.Join(database.BookFields, ", ")),
+		}
+	}
+
+	if err := storage.UnlockBookField(id, field); err != nil {
+		return err
+	}
+
+	return getBookFieldSources(c)
+}
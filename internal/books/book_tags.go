@@ -0,0 +1,152 @@
+package books
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kaanserin/go-reads/internal/database"
+	"github.com/kaanserin/go-reads/internal/utils"
+)
+
+// Number of tags returned as the top tags of a book
+const topTagsLimit = 10
+
+const maxTagLength = 50
+
+type BookTagDto struct {
+	Tag string `json:"tag"`
+}
+
+// BookTagsResponse holds the tags readers put on a book most and the tags of the current user
+type BookTagsResponse struct {
+	TopTags []*database.TagCount `json:"top_tags"`
+	Mine    []string             `json:"mine"`
+}
+
+// normalizeTag lowercases a free-form tag and joins its words with dashes,
+// so "To Read" and "to-read" count as the same shelf
+func normalizeTag(tag string) (string, error) {
+	words := strings.FieldsFunc(strings.ToLower(tag), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+
+	normalized := strings.Join(words, "-")
+	if normalized == "" {
+		return "", &utils.CustomError{
+			Message: "Tag needs at least one letter or digit",
+		}
+	}
+
+	if len([]rune(normalized)) > maxTagLength {
+		return "", &utils.CustomError{
+			Message: "Tag can be at most 50 characters long",
+		}
+	}
+
+	return normalized, nil
+}
+
+func getBookTags(c *gin.Context) error {
+	storage, err := database.GetPgStorageFromRequest(c.Request)
+	if err != nil {
+		return err
+	}
+
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return &utils.CustomError{
+			Message: "Please enter a valid integer for id",
+		}
+	}
+
+	topTags, err := storage.GetBookTopTags(id, topTagsLimit)
+	if err != nil {
+		return err
+	}
+
+	userTmp, _ := c.Get("user")
+	user := userTmp.(*database.User)
+	mine, err := storage.GetUserBookTags(id, user.ID)
+	if err != nil {
+		return err
+	}
+
+	c.JSON(http.StatusOK, BookTagsResponse{
+		TopTags: topTags,
+		Mine:    mine,
+	})
+
+	return nil
+}
+
+func addBookTag(c *gin.Context) error {
+	bookTagDto := &BookTagDto{}
+	if err := json.NewDecoder(c.Request.Body).Decode(bookTagDto); err != nil {
+		return err
+	}
+
+	tag, err := normalizeTag(bookTagDto.Tag)
+	if err != nil {
+		return err
+	}
+
+	storage, err := database.GetPgStorageFromRequest(c.Request)
+	if err != nil {
+		return err
+	}
+
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return &utils.CustomError{
+			Message: "Please enter a valid integer for id",
+		}
+	}
+
+	userTmp, _ := c.Get("user")
+	user := userTmp.(*database.User)
+	if err := storage.AddBookTag(id, user.ID, tag); err != nil {
+		return err
+	}
+
+	return getBookTags(c)
+}
+
+func removeBookTag(c *gin.Context) error {
+	storage, err := database.GetPgStorageFromRequest(c.Request)
+	if err != nil {
+		return err
+	}
+
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return &utils.CustomError{
+			Message: "Please enter a valid integer for id",
+		}
+	}
+
+	tag, err := normalizeTag(c.Param("tag"))
+	if err != nil {
+		return err
+	}
+
+	userTmp, _ := c.Get("user")
+	user := userTmp.(*database.User)
+	err = storage.RemoveBookTag(id, user.ID, tag)
+	if errors.Is(err, sql.ErrNoRows) {
+		c.JSON(http.StatusNotFound, utils.CustomError{
+			Message: "You have not tagged the book with " + tag,
+		})
+
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	return getBookTags(c)
+}
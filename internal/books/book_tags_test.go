@@ -0,0 +1,35 @@
+package books
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestNormalizeTag(t *testing.T) {
+	tests := map[string]string{
+		"to-read":           "to-read",
+		"To Read":           "to-read",
+		"  favourites!! ":   "favourites",
+		"sci-fi / space":    "sci-fi-space",
+		"Lieblingsbücher":   "lieblingsbücher",
+		"2024 reading goal": "2024-reading-goal",
+	}
+
+	for tag, expected := range tests {
+		normalized, err := normalizeTag(tag)
+		if err != nil {
+			t.Errorf("Expected %q to be valid, got %v", tag, err)
+			continue
+		}
+
+		if normalized != expected {
+			t.Errorf("Expected %q to become %q, got %q", tag, expected, normalized)
+		}
+	}
+
+	for _, tag := range []string{"", " - ", strings.Repeat("a", 51)} {
+		if _, err := normalizeTag(tag); err == nil {
+			t.Errorf("Expected %q to be rejected", tag)
+		}
+	}
+}
@@ -1,45 +1,199 @@
 package books
 
 import (
+	"database/sql"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"net/http"
+	"slices"
 	"strconv"
+	"strings"
 
 	"github.com/gin-gonic/gin"
+	"github.com/kaanserin/go-reads/internal/blobstore"
+	"github.com/kaanserin/go-reads/internal/config"
 	"github.com/kaanserin/go-reads/internal/database"
+	"github.com/kaanserin/go-reads/internal/images"
+	"github.com/kaanserin/go-reads/internal/imageset"
+	"github.com/kaanserin/go-reads/internal/metrics"
 	"github.com/kaanserin/go-reads/internal/middleware"
+	"github.com/kaanserin/go-reads/internal/render"
+	"github.com/kaanserin/go-reads/internal/reviewtext"
 	"github.com/kaanserin/go-reads/internal/utils"
 	"gopkg.in/validator.v2"
 )
 
-func AddBooksRoutes(r *gin.Engine) {
+// BookCovers stores cover renditions below books/<id>/cover/ and resolves their URLs on books.
+// The books.cover_image_key column holds the key of the original.
+type BookCovers = imageset.Images[database.Book]
+
+func NewBookCovers(cfg *config.Config, blobStore blobstore.BlobStore) *BookCovers {
+	return imageset.NewImages(cfg, blobStore, imageset.Entity[database.Book]{
+		Kind:            "cover",
+		PrefixFormat:    "books/%d/cover",
+		ProxyPathFormat: "/books/%d/cover",
+		Options: images.Options{
+			MaxBytes: cfg.Images.MaxUploadBytes,
+			Widths:   cfg.Images.CoverWidths,
+		},
+		Image: func(book *database.Book) (int, string) {
+			return book.ID, book.CoverImageKey
+		},
+		SetURLs: func(book *database.Book, urls map[string]string) {
+			book.CoverUrls = urls
+		},
+	})
+}
+
+func AddBooksRoutes(r *gin.Engine, cfg *config.Config, covers *BookCovers) {
+	// Loaded by browsers through signed URLs, so it can not require the authorization header
+	r.GET("/books/:id/cover", utils.MakeHandlerFunc(getBookCover(covers)))
+
 	booksGroup := r.Group("books")
 
-	booksGroup.Use(middleware.Authentication())
+	booksGroup.Use(middleware.Authentication(cfg.Auth.AppKey))
 
-	booksGroup.GET("/", middleware.AuthorizeAdmin(), utils.MakeHandlerFunc(getBooks))
-	booksGroup.GET("/:id", utils.MakeHandlerFunc(getBookById))
+	booksGroup.GET("/", middleware.AuthorizeAdmin(), utils.MakeHandlerFunc(getBooks(covers)))
+	booksGroup.POST("/", middleware.AuthorizeRoles("admin", "librarian"), utils.MakeHandlerFunc(createBook(covers)))
+	booksGroup.POST("/import", middleware.AuthorizeAdmin(), utils.MakeHandlerFunc(importBooks(cfg)))
+	booksGroup.GET("/:id", utils.MakeHandlerFunc(getBookById(covers)))
 	booksGroup.GET("/:id/reviews", utils.MakeHandlerFunc(getBookReviewsByBookId))
-	booksGroup.PUT("/:id", middleware.AuthorizeAdmin(), utils.MakeHandlerFunc(updateBookById))
-	booksGroup.DELETE("/:id", middleware.AuthorizeAdmin(), utils.MakeHandlerFunc(deleteBookById))
+	booksGroup.GET("/:id/reviews/mine", utils.MakeHandlerFunc(getMyBookReview))
+	booksGroup.PUT("/:id/reviews/mine", utils.MakeHandlerFunc(putMyBookReview(cfg)))
+	booksGroup.PUT("/:id", middleware.AuthorizeAdmin(), utils.MakeHandlerFunc(updateBookById(covers)))
+	booksGroup.DELETE("/:id", middleware.AuthorizeAdmin(), utils.MakeHandlerFunc(deleteBookById(covers)))
+	booksGroup.PUT("/:id/genres", middleware.AuthorizeRoles("admin", "librarian"), utils.MakeHandlerFunc(setBookGenres(covers)))
+	booksGroup.GET("/:id/tags", utils.MakeHandlerFunc(getBookTags))
+	booksGroup.POST("/:id/tags", utils.MakeHandlerFunc(addBookTag))
+	booksGroup.DELETE("/:id/tags/:tag", utils.MakeHandlerFunc(removeBookTag))
+	booksGroup.GET("/:id/sources", middleware.AuthorizeRoles("admin", "librarian"), utils.MakeHandlerFunc(getBookFieldSources))
+	booksGroup.DELETE("/:id/sources/:field", middleware.AuthorizeRoles("admin", "librarian"), utils.MakeHandlerFunc(unlockBookField))
+	booksGroup.PUT("/:id/authors", middleware.AuthorizeRoles("admin", "librarian"), utils.MakeHandlerFunc(setBookAuthors(covers)))
+	booksGroup.POST("/:id/cover", middleware.AuthorizeRoles("admin", "librarian"), utils.MakeHandlerFunc(updateBookCover(covers)))
+	booksGroup.DELETE("/:id/cover", middleware.AuthorizeRoles("admin", "librarian"), utils.MakeHandlerFunc(deleteBookCover(covers)))
 }
 
-func getBooks(c *gin.Context) error {
-	storage, err := database.GetPgStorageFromRequest(c.Request)
-	if err != nil {
-		return err
+func getBooks(covers *BookCovers) func(c *gin.Context) error {
+	return func(c *gin.Context) error {
+		storage, err := database.GetPgStorageFromRequest(c.Request)
+		if err != nil {
+			return err
+		}
+
+		books, err := storage.GetBooks(c.Request)
+		if err != nil {
+			return err
+		}
+
+		covers.ResolveAll(c.Request.Context(), books)
+		return render.Respond(c, http.StatusOK, books)
 	}
+}
 
-	books, err := storage.GetBooks(c.Request)
-	if err != nil {
-		return err
+func getBookById(covers *BookCovers) func(c *gin.Context) error {
+	return func(c *gin.Context) error {
+		storage, err := database.GetPgStorageFromRequest(c.Request)
+		if err != nil {
+			return err
+		}
+
+		idParam, _ := c.Params.Get("id")
+		id, err := strconv.Atoi(idParam)
+		if err != nil {
+			return err
+		}
+
+		books, err := storage.GetBookById(id)
+		if err != nil {
+			return err
+		}
+
+		books.TopTags, err = storage.GetBookTopTags(id, topTagsLimit)
+		if err != nil {
+			return err
+		}
+
+		covers.Resolve(c.Request.Context(), books)
+		return render.Respond(c, http.StatusOK, books)
 	}
+}
+
+func updateBookById(covers *BookCovers) func(c *gin.Context) error {
+	return func(c *gin.Context) error {
+		var updateBookDto *database.UpdateBookDto = &database.UpdateBookDto{}
+		json.NewDecoder(c.Request.Body).Decode(updateBookDto)
+
+		errs := validator.Validate(updateBookDto)
+		if errs != nil {
+			return errs
+		}
+
+		storage, err := database.GetPgStorageFromRequest(c.Request)
+		if err != nil {
+			return err
+		}
+
+		idParam, _ := c.Params.Get("id")
+		id, err := strconv.Atoi(idParam)
+		if err != nil {
+			return &utils.CustomError{
+				Message: "Please enter a valid integer for id",
+			}
+		}
+
+		book, err := storage.UpdateBookById(id, updateBookDto)
+		if errors.Is(err, database.ErrDuplicateISBN) {
+			c.JSON(http.StatusConflict, utils.CustomError{
+				Message: fmt.Sprintf("A book with ISBN %s already exists", updateBookDto.ISBN),
+			})
 
-	c.JSON(http.StatusOK, books)
-	return nil
+			return nil
+		} else if err != nil {
+			return err
+		}
+
+		covers.Resolve(c.Request.Context(), book)
+		c.JSON(http.StatusOK, book)
+		return nil
+	}
 }
 
-func getBookById(c *gin.Context) error {
+func deleteBookById(covers *BookCovers) func(c *gin.Context) error {
+	return func(c *gin.Context) error {
+		storage, err := database.GetPgStorageFromRequest(c.Request)
+		if err != nil {
+			return err
+		}
+
+		idParam, _ := c.Params.Get("id")
+		id, err := strconv.Atoi(idParam)
+		if err != nil {
+			return &utils.CustomError{
+				Message: "Please enter a valid integer for id",
+			}
+		}
+
+		book, err := storage.GetBookById(id)
+		if err != nil {
+			return err
+		}
+
+		err = storage.DeleteBookById(id)
+		if err != nil {
+			return err
+		}
+
+		covers.DeleteVariants(c.Request.Context(), book.CoverImageKey)
+		c.JSON(200, &utils.CustomError{
+			Message: "Book deleted successfully",
+		})
+
+		return nil
+	}
+}
+
+func getBookReviewsByBookId(c *gin.Context) error {
 	storage, err := database.GetPgStorageFromRequest(c.Request)
 	if err != nil {
 		return err
@@ -51,89 +205,327 @@ func getBookById(c *gin.Context) error {
 		return err
 	}
 
-	books, err := storage.GetBookById(id)
+	bookReviews, err := storage.GetBookReviewsByBookId(id, c.Request)
 	if err != nil {
 		return err
 	}
 
-	c.JSON(http.StatusOK, books)
-	return nil
-}
-
-func updateBookById(c *gin.Context) error {
-	var updateBookDto *database.UpdateBookDto = &database.UpdateBookDto{}
-	json.NewDecoder(c.Request.Body).Decode(updateBookDto)
+	// Spoilers are hidden unless the reader asks to see them
+	reviewtext.Prepare(c.Query("reveal_spoilers") == "true", bookReviews...)
 
-	errs := validator.Validate(updateBookDto)
-	if errs != nil {
-		return errs
-	}
+	return render.Respond(c, http.StatusOK, bookReviews)
+}
 
+// getMyBookReview returns the review the signed in user wrote of the book
+func getMyBookReview(c *gin.Context) error {
 	storage, err := database.GetPgStorageFromRequest(c.Request)
 	if err != nil {
 		return err
 	}
 
-	idParam, _ := c.Params.Get("id")
-	id, err := strconv.Atoi(idParam)
+	id, err := strconv.Atoi(c.Param("id"))
 	if err != nil {
 		return &utils.CustomError{
 			Message: "Please enter a valid integer for id",
 		}
 	}
 
-	book, err := storage.UpdateBookById(id, updateBookDto)
-	if err != nil {
+	userTmp, _ := c.Get("user")
+	user := userTmp.(*database.User)
+
+	bookReview, err := storage.GetUserBookReview(user.ID, id)
+	if errors.Is(err, sql.ErrNoRows) {
+		c.JSON(http.StatusNotFound, utils.CustomError{
+			Message: "You have not reviewed this book",
+		})
+
+		return nil
+	} else if err != nil {
 		return err
 	}
 
-	c.JSON(http.StatusOK, book)
-	return nil
+	reviewtext.Prepare(true, bookReview)
+	return render.Respond(c, http.StatusOK, bookReview)
 }
 
-func deleteBookById(c *gin.Context) error {
-	storage, err := database.GetPgStorageFromRequest(c.Request)
-	if err != nil {
-		return err
-	}
+// putMyBookReview creates the review of the signed in user or replaces the one they wrote before
+func putMyBookReview(cfg *config.Config) func(c *gin.Context) error {
+	return func(c *gin.Context) error {
+		var createBookReviewDto *database.CreateBookReviewDto = &database.CreateBookReviewDto{}
+		json.NewDecoder(c.Request.Body).Decode(createBookReviewDto)
 
-	idParam, _ := c.Params.Get("id")
-	id, err := strconv.Atoi(idParam)
-	if err != nil {
-		return &utils.CustomError{
-			Message: "Please enter a valid integer for id",
+		id, err := strconv.Atoi(c.Param("id"))
+		if err != nil {
+			return &utils.CustomError{
+				Message: "Please enter a valid integer for id",
+			}
 		}
-	}
+		createBookReviewDto.BookID = id
 
-	err = storage.DeleteBookById(id)
-	if err != nil {
-		return err
+		if err := validator.Validate(createBookReviewDto); err != nil {
+			return err
+		}
+
+		createBookReviewDto.Review, err = reviewtext.Sanitize(createBookReviewDto.Review, cfg.Reviews.MaxLength)
+		if err != nil {
+			return err
+		}
+
+		storage, err := database.GetPgStorageFromRequest(c.Request)
+		if err != nil {
+			return err
+		}
+
+		userTmp, _ := c.Get("user")
+		user := userTmp.(*database.User)
+		createBookReviewDto.UserID = user.ID
+
+		bookReview, created, err := storage.UpsertBookReview(createBookReviewDto)
+		if errors.Is(err, sql.ErrNoRows) {
+			c.JSON(http.StatusNotFound, utils.CustomError{
+				Message: "Book not found",
+			})
+
+			return nil
+		} else if err != nil {
+			return err
+		}
+
+		status := http.StatusOK
+		if created {
+			metrics.ReviewsCreatedTotal.Inc()
+			status = http.StatusCreated
+		}
+
+		reviewtext.Prepare(true, bookReview)
+		c.JSON(status, bookReview)
+		return nil
 	}
+}
 
-	c.JSON(200, &utils.CustomError{
-		Message: "Book deleted successfully",
-	})
+// setBookAuthors replaces the credited authors, translators, illustrators and editors of a book
+func setBookAuthors(covers *BookCovers) func(c *gin.Context) error {
+	return func(c *gin.Context) error {
+		contributors := make([]*database.BookContributorDto, 0)
+		if err := json.NewDecoder(c.Request.Body).Decode(&contributors); err != nil {
+			return err
+		}
+
+		seen := make(map[database.BookContributorDto]bool, len(contributors))
+		for _, contributor := range contributors {
+			if err := validator.Validate(contributor); err != nil {
+				return err
+			}
+
+			if contributor.Role == "" {
+				contributor.Role = database.AuthorRoleAuthor
+			}
+
+			if !slices.Contains(database.AuthorRoles, contributor.Role) {
+				return &utils.CustomError{
+					Message: fmt.Sprintf("Role must be one of %s", strings.Join(database.AuthorRoles, ", ")),
+				}
+			}
+
+			if seen[*contributor] {
+				return &utils.CustomError{
+					Message: fmt.Sprintf("Author %d is credited as %s more than once", contributor.AuthorID, contributor.Role),
+				}
+			}
+			seen[*contributor] = true
+		}
+
+		storage, err := database.GetPgStorageFromRequest(c.Request)
+		if err != nil {
+			return err
+		}
+
+		id, err := strconv.Atoi(c.Param("id"))
+		if err != nil {
+			return &utils.CustomError{
+				Message: "Please enter a valid integer for id",
+			}
+		}
 
-	return nil
+		book, err := storage.SetBookContributors(id, contributors)
+		if err != nil {
+			return err
+		}
+
+		covers.Resolve(c.Request.Context(), book)
+		c.JSON(http.StatusOK, book)
+		return nil
+	}
 }
 
-func getBookReviewsByBookId(c *gin.Context) error {
-	storage, err := database.GetPgStorageFromRequest(c.Request)
-	if err != nil {
-		return err
+type BookGenresDto struct {
+	GenreIDs []int `json:"genre_ids"`
+}
+
+// setBookGenres replaces the genres a book is filed under
+func setBookGenres(covers *BookCovers) func(c *gin.Context) error {
+	return func(c *gin.Context) error {
+		bookGenresDto := &BookGenresDto{}
+		if err := json.NewDecoder(c.Request.Body).Decode(bookGenresDto); err != nil {
+			return err
+		}
+
+		seen := make(map[int]bool, len(bookGenresDto.GenreIDs))
+		for _, genreId := range bookGenresDto.GenreIDs {
+			if seen[genreId] {
+				return &utils.CustomError{
+					Message: fmt.Sprintf("Genre %d is given more than once", genreId),
+				}
+			}
+			seen[genreId] = true
+		}
+
+		storage, err := database.GetPgStorageFromRequest(c.Request)
+		if err != nil {
+			return err
+		}
+
+		id, err := strconv.Atoi(c.Param("id"))
+		if err != nil {
+			return &utils.CustomError{
+				Message: "Please enter a valid integer for id",
+			}
+		}
+
+		book, err := storage.SetBookGenres(id, bookGenresDto.GenreIDs)
+		if err != nil {
+			return err
+		}
+
+		covers.Resolve(c.Request.Context(), book)
+		c.JSON(http.StatusOK, book)
+		return nil
 	}
+}
 
-	idParam, _ := c.Params.Get("id")
-	id, err := strconv.Atoi(idParam)
-	if err != nil {
-		return err
+func updateBookCover(covers *BookCovers) func(c *gin.Context) error {
+	return func(c *gin.Context) error {
+		storage, err := database.GetPgStorageFromRequest(c.Request)
+		if err != nil {
+			return err
+		}
+
+		id, err := strconv.Atoi(c.Param("id"))
+		if err != nil {
+			return &utils.CustomError{
+				Message: "Please enter a valid integer for id",
+			}
+		}
+
+		book, err := storage.GetBookById(id)
+		if errors.Is(err, sql.ErrNoRows) {
+			c.JSON(http.StatusNotFound, utils.CustomError{
+				Message: "Book not found",
+			})
+
+			return nil
+		} else if err != nil {
+			return err
+		}
+
+		objectKey, err := covers.UploadFromRequest(c, covers.Prefix(book.ID))
+		if err != nil || objectKey == "" {
+			return err
+		}
+
+		ctx := c.Request.Context()
+		if err := storage.UpdateBookCoverKey(book.ID, objectKey); err != nil {
+			covers.DeleteVariants(ctx, objectKey)
+			return err
+		}
+
+		// The previous cover is replaced, its renditions are no longer referenced
+		if book.CoverImageKey != "" && book.CoverImageKey != objectKey {
+			covers.DeleteVariants(ctx, book.CoverImageKey)
+		}
+
+		book.CoverImageKey = objectKey
+		covers.Resolve(ctx, book)
+		c.JSON(http.StatusOK, book)
+		return nil
 	}
+}
 
-	bookReviews, err := storage.GetBookReviewsByBookId(id, c.Request)
-	if err != nil {
-		return err
+func deleteBookCover(covers *BookCovers) func(c *gin.Context) error {
+	return func(c *gin.Context) error {
+		storage, err := database.GetPgStorageFromRequest(c.Request)
+		if err != nil {
+			return err
+		}
+
+		id, err := strconv.Atoi(c.Param("id"))
+		if err != nil {
+			return &utils.CustomError{
+				Message: "Please enter a valid integer for id",
+			}
+		}
+
+		book, err := storage.GetBookById(id)
+		if errors.Is(err, sql.ErrNoRows) || (err == nil && book.CoverImageKey == "") {
+			c.JSON(http.StatusNotFound, utils.CustomError{
+				Message: "Book has no cover",
+			})
+
+			return nil
+		} else if err != nil {
+			return err
+		}
+
+		if err := storage.UpdateBookCoverKey(book.ID, ""); err != nil {
+			return err
+		}
+
+		ctx := c.Request.Context()
+		covers.DeleteVariants(ctx, book.CoverImageKey)
+
+		book.CoverImageKey = ""
+		covers.Resolve(ctx, book)
+		c.JSON(http.StatusOK, book)
+		return nil
 	}
+}
+
+// getBookCover serves a cover rendition through a signed, time limited URL
+func getBookCover(covers *BookCovers) func(c *gin.Context) error {
+	return func(c *gin.Context) error {
+		id, err := strconv.Atoi(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, utils.CustomError{
+				Message: "Id is not a number",
+			})
+
+			return nil
+		}
 
-	c.JSON(http.StatusOK, bookReviews)
-	return nil
+		if !covers.VerifyRequest(c, id) {
+			c.JSON(http.StatusForbidden, utils.CustomError{
+				Message: "Invalid or expired signature",
+			})
+
+			return nil
+		}
+
+		storage, err := database.GetPgStorageFromRequest(c.Request)
+		if err != nil {
+			return err
+		}
+
+		book, err := storage.GetBookById(id)
+		if errors.Is(err, sql.ErrNoRows) {
+			c.JSON(http.StatusNotFound, utils.CustomError{
+				Message: "Book not found",
+			})
+
+			return nil
+		} else if err != nil {
+			return err
+		}
+
+		return covers.Serve(c, book.CoverImageKey)
+	}
 }
@@ -0,0 +1,425 @@
+package config
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/joho/godotenv"
+)
+
+const defaultConfigFile = ".env"
+
+type Config struct {
+	Server    ServerConfig
+	Database  DatabaseConfig
+	Auth      AuthConfig
+	BlobStore BlobStoreConfig
+	Images    ImagesConfig
+	Import    ImportConfig
+	Reviews   ReviewsConfig
+	Log       LogConfig
+	Tracing   TracingConfig
+	Readiness ReadinessConfig
+}
+
+type ServerConfig struct {
+	// Address the http server listens on, API_HOST
+	Addr            string
+	ShutdownTimeout time.Duration
+}
+
+type DatabaseConfig struct {
+	URL                string
+	ConnectRetries     int
+	ConnectRetryPeriod time.Duration
+	// Apply pending migrations before the server starts
+	MigrateOnStart bool
+}
+
+type AuthConfig struct {
+	AppKey   string
+	TokenTTL time.Duration
+}
+
+type BlobStoreConfig struct {
+	// s3, local or memory
+	Backend  string
+	LocalDir string
+	// Public URL objects are served from, object keys are appended to it
+	PublicBaseURL string
+	// How long signed object URLs stay valid
+	URLTTL time.Duration
+	S3     S3Config
+}
+
+type ImagesConfig struct {
+	// Maximum size of an uploaded image in bytes
+	MaxUploadBytes int64
+	// Edge lengths of the square thumbnails rendered for every upload
+	ThumbnailSizes []int
+	// Widths of the renditions rendered for every book cover
+	CoverWidths []int
+}
+
+type ImportConfig struct {
+	// Maximum size of a catalog file uploaded for a bulk import in bytes
+	MaxUploadBytes int64
+	// Rows written per transaction
+	BatchSize int
+}
+
+type ReviewsConfig struct {
+	// Maximum length of the Markdown text of a review in characters
+	MaxLength int
+}
+
+type S3Config struct {
+	BucketName string
+	// Custom endpoint for S3 compatible servers such as MinIO
+	Endpoint     string
+	UsePathStyle bool
+}
+
+type LogConfig struct {
+	Level string
+}
+
+type TracingConfig struct {
+	// otlp, stdout or none
+	Exporter string
+}
+
+type ReadinessConfig struct {
+	Timeout          time.Duration
+	CheckObjectStore bool
+}
+
+func defaults() *Config {
+	return &Config{
+		Server: ServerConfig{
+			Addr:            ":8080",
+			ShutdownTimeout: 30 * time.Second,
+		},
+		Database: DatabaseConfig{
+			ConnectRetries:     5,
+			ConnectRetryPeriod: 2 * time.Second,
+		},
+		Auth: AuthConfig{
+			TokenTTL: time.Hour,
+		},
+		BlobStore: BlobStoreConfig{
+			LocalDir: "./data/blobs",
+			URLTTL:   15 * time.Minute,
+		},
+		Images: ImagesConfig{
+			MaxUploadBytes: 5 << 20,
+			ThumbnailSizes: []int{64, 256, 512},
+			CoverWidths:    []int{150, 300, 600},
+		},
+		Import: ImportConfig{
+			MaxUploadBytes: 50 << 20,
+			BatchSize:      500,
+		},
+		Reviews: ReviewsConfig{
+			MaxLength: 10000,
+		},
+		Log: LogConfig{
+			Level: "info",
+		},
+		Tracing: TracingConfig{
+			Exporter: "none",
+		},
+		Readiness: ReadinessConfig{
+			Timeout: 2 * time.Second,
+		},
+	}
+}
+
+// Load builds the configuration from defaults, the config file, the environment and flags,
+// later sources overriding earlier ones, and validates the result
+func Load(args []string) (*Config, error) {
+	flags := flag.NewFlagSet("go_reads", flag.ContinueOnError)
+	load := AddFlags(flags)
+	if err := flags.Parse(args); err != nil {
+		return nil, err
+	}
+
+	return load()
+}
+
+// AddFlags registers the configuration flags on flags.
+// The returned function loads and validates the configuration once the flags are parsed.
+func AddFlags(flags *flag.FlagSet) func() (*Config, error) {
+	configFile := flags.String("config", "", "path to an env file with configuration values (default .env)")
+	addr := flags.String("addr", "", "address the http server listens on")
+	logLevel := flags.String("log-level", "", "log level: debug, info, warn or error")
+
+	return func() (*Config, error) {
+		if err := loadFile(*configFile); err != nil {
+			return nil, err
+		}
+
+		cfg, err := FromEnv()
+		if err != nil {
+			return nil, err
+		}
+
+		if *addr != "" {
+			cfg.Server.Addr = *addr
+		}
+
+		if *logLevel != "" {
+			cfg.Log.Level = *logLevel
+		}
+
+		if err := cfg.Validate(); err != nil {
+			return nil, err
+		}
+
+		return cfg, nil
+	}
+}
+
+// loadFile adds the values in the env file to the environment without overriding existing variables.
+// A missing default file is not an error so containers can be configured through the environment alone.
+func loadFile(path string) error {
+	if path == "" {
+		err := godotenv.Load(defaultConfigFile)
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil
+		}
+
+		return err
+	}
+
+	return godotenv.Load(path)
+}
+
+// FromEnv reads the configuration from the environment on top of the defaults
+func FromEnv() (*Config, error) {
+	cfg := defaults()
+	env := &envReader{}
+
+	env.string("API_HOST", &cfg.Server.Addr)
+	env.duration("SHUTDOWN_TIMEOUT", &cfg.Server.ShutdownTimeout)
+	env.string("DB_URL", &cfg.Database.URL)
+	env.int("DB_CONNECT_RETRIES", &cfg.Database.ConnectRetries)
+	env.duration("DB_CONNECT_RETRY_INTERVAL", &cfg.Database.ConnectRetryPeriod)
+	env.bool("DB_MIGRATE_ON_START", &cfg.Database.MigrateOnStart)
+	env.string("APP_KEY", &cfg.Auth.AppKey)
+	env.duration("AUTH_TOKEN_TTL", &cfg.Auth.TokenTTL)
+	env.string("AWS_BUCKET_NAME", &cfg.BlobStore.S3.BucketName)
+	env.string("AWS_ENDPOINT_URL_S3", &cfg.BlobStore.S3.Endpoint)
+	env.bool("AWS_S3_USE_PATH_STYLE", &cfg.BlobStore.S3.UsePathStyle)
+	env.string("BLOB_STORE_BACKEND", &cfg.BlobStore.Backend)
+	env.string("BLOB_STORE_LOCAL_DIR", &cfg.BlobStore.LocalDir)
+	env.string("BLOB_STORE_PUBLIC_BASE_URL", &cfg.BlobStore.PublicBaseURL)
+	env.duration("BLOB_STORE_URL_TTL", &cfg.BlobStore.URLTTL)
+	env.int64("IMAGE_MAX_UPLOAD_BYTES", &cfg.Images.MaxUploadBytes)
+	env.intList("IMAGE_THUMBNAIL_SIZES", &cfg.Images.ThumbnailSizes)
+	env.intList("IMAGE_COVER_WIDTHS", &cfg.Images.CoverWidths)
+	env.int64("IMPORT_MAX_UPLOAD_BYTES", &cfg.Import.MaxUploadBytes)
+	env.int("IMPORT_BATCH_SIZE", &cfg.Import.BatchSize)
+	env.int("REVIEW_MAX_LENGTH", &cfg.Reviews.MaxLength)
+	env.string("LOG_LEVEL", &cfg.Log.Level)
+	env.string("OTEL_TRACES_EXPORTER", &cfg.Tracing.Exporter)
+	env.duration("READINESS_TIMEOUT", &cfg.Readiness.Timeout)
+	env.bool("READINESS_CHECK_OBJECT_STORE", &cfg.Readiness.CheckObjectStore)
+
+	if len(env.errs) > 0 {
+		return nil, errors.Join(env.errs...)
+	}
+
+	// Deployments that only configure a bucket keep storing objects in S3
+	if cfg.BlobStore.Backend == "" {
+		cfg.BlobStore.Backend = "local"
+		if cfg.BlobStore.S3.BucketName != "" {
+			cfg.BlobStore.Backend = "s3"
+		}
+	}
+
+	return cfg, nil
+}
+
+func (cfg *Config) Validate() error {
+	var errs []error
+
+	if cfg.Server.Addr == "" {
+		errs = append(errs, errors.New("API_HOST must not be empty"))
+	}
+
+	if cfg.Database.URL == "" {
+		errs = append(errs, errors.New("DB_URL is required"))
+	}
+
+	if cfg.Database.ConnectRetries < 0 {
+		errs = append(errs, errors.New("DB_CONNECT_RETRIES must not be negative"))
+	}
+
+	if cfg.Database.ConnectRetryPeriod <= 0 {
+		errs = append(errs, errors.New("DB_CONNECT_RETRY_INTERVAL must be positive"))
+	}
+
+	if cfg.Auth.AppKey == "" {
+		errs = append(errs, errors.New("APP_KEY is required"))
+	}
+
+	if cfg.Auth.TokenTTL <= 0 {
+		errs = append(errs, errors.New("AUTH_TOKEN_TTL must be positive"))
+	}
+
+	switch cfg.Log.Level {
+	case "debug", "info", "warn", "error":
+	default:
+		errs = append(errs, fmt.Errorf("LOG_LEVEL %q must be one of debug, info, warn or error", cfg.Log.Level))
+	}
+
+	switch cfg.Tracing.Exporter {
+	case "otlp", "stdout", "none":
+	default:
+		errs = append(errs, fmt.Errorf("OTEL_TRACES_EXPORTER %q must be one of otlp, stdout or none", cfg.Tracing.Exporter))
+	}
+
+	if cfg.BlobStore.URLTTL <= 0 {
+		errs = append(errs, errors.New("BLOB_STORE_URL_TTL must be positive"))
+	}
+
+	if cfg.Images.MaxUploadBytes <= 0 {
+		errs = append(errs, errors.New("IMAGE_MAX_UPLOAD_BYTES must be positive"))
+	}
+
+	for _, size := range cfg.Images.ThumbnailSizes {
+		if size <= 0 || size > 2048 {
+			errs = append(errs, fmt.Errorf("IMAGE_THUMBNAIL_SIZES contains %d, sizes must be between 1 and 2048", size))
+		}
+	}
+
+	for _, width := range cfg.Images.CoverWidths {
+		if width <= 0 || width > 2048 {
+			errs = append(errs, fmt.Errorf("IMAGE_COVER_WIDTHS contains %d, widths must be between 1 and 2048", width))
+		}
+	}
+
+	if cfg.Import.MaxUploadBytes <= 0 {
+		errs = append(errs, errors.New("IMPORT_MAX_UPLOAD_BYTES must be positive"))
+	}
+
+	if cfg.Import.BatchSize <= 0 {
+		errs = append(errs, errors.New("IMPORT_BATCH_SIZE must be positive"))
+	}
+
+	if cfg.Reviews.MaxLength <= 0 {
+		errs = append(errs, errors.New("REVIEW_MAX_LENGTH must be positive"))
+	}
+
+	if cfg.Readiness.Timeout <= 0 {
+		errs = append(errs, errors.New("READINESS_TIMEOUT must be positive"))
+	}
+
+	switch cfg.BlobStore.Backend {
+	case "s3":
+		if cfg.BlobStore.S3.BucketName == "" {
+			errs = append(errs, errors.New("AWS_BUCKET_NAME is required for the s3 blob store"))
+		}
+	case "local":
+		if cfg.BlobStore.LocalDir == "" {
+			errs = append(errs, errors.New("BLOB_STORE_LOCAL_DIR is required for the local blob store"))
+		}
+	case "memory":
+	default:
+		errs = append(errs, fmt.Errorf("BLOB_STORE_BACKEND %q must be one of s3, local or memory", cfg.BlobStore.Backend))
+	}
+
+	return errors.Join(errs...)
+}
+
+// envReader parses environment variables into typed fields, collecting every parse error
+type envReader struct {
+	errs []error
+}
+
+func (r *envReader) string(key string, dst *string) {
+	if value, ok := os.LookupEnv(key); ok && value != "" {
+		*dst = value
+	}
+}
+
+func (r *envReader) int(key string, dst *int) {
+	r.parse(key, func(value string) error {
+		v, err := strconv.Atoi(value)
+		if err == nil {
+			*dst = v
+		}
+
+		return err
+	})
+}
+
+func (r *envReader) int64(key string, dst *int64) {
+	r.parse(key, func(value string) error {
+		v, err := strconv.ParseInt(value, 10, 64)
+		if err == nil {
+			*dst = v
+		}
+
+		return err
+	})
+}
+
+// intList parses a comma separated list such as "64,256,512"
+func (r *envReader) intList(key string, dst *[]int) {
+	r.parse(key, func(value string) error {
+		parts := strings.Split(value, ",")
+		list := make([]int, 0, len(parts))
+		for _, part := range parts {
+			v, err := strconv.Atoi(strings.TrimSpace(part))
+			if err != nil {
+				return err
+			}
+
+			list = append(list, v)
+		}
+
+		*dst = list
+		return nil
+	})
+}
+
+func (r *envReader) bool(key string, dst *bool) {
+	r.parse(key, func(value string) error {
+		v, err := strconv.ParseBool(value)
+		if err == nil {
+			*dst = v
+		}
+
+		return err
+	})
+}
+
+func (r *envReader) duration(key string, dst *time.Duration) {
+	r.parse(key, func(value string) error {
+		v, err := time.ParseDuration(value)
+		if err == nil {
+			*dst = v
+		}
+
+		return err
+	})
+}
+
+func (r *envReader) parse(key string, parse func(value string) error) {
+	value, ok := os.LookupEnv(key)
+	if !ok || value == "" {
+		return
+	}
+
+	if err := parse(value); err != nil {
+		r.errs = append(r.errs, fmt.Errorf("invalid value %q for %s: %w", value, key, err))
+	}
+}
@@ -0,0 +1,107 @@
+package config
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFromEnvAppliesDefaultsAndOverrides(t *testing.T) {
+	t.Setenv("DB_URL", "postgres://localhost/go_reads")
+	t.Setenv("APP_KEY", "secret")
+	t.Setenv("DB_CONNECT_RETRIES", "3")
+	t.Setenv("READINESS_TIMEOUT", "500ms")
+
+	cfg, err := FromEnv()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if cfg.Server.Addr != ":8080" {
+		t.Errorf("Expected default address :8080, got %s", cfg.Server.Addr)
+	}
+
+	if cfg.Database.ConnectRetries != 3 {
+		t.Errorf("Expected 3 retries, got %d", cfg.Database.ConnectRetries)
+	}
+
+	if cfg.Readiness.Timeout != 500*time.Millisecond {
+		t.Errorf("Expected readiness timeout 500ms, got %s", cfg.Readiness.Timeout)
+	}
+
+	if err := cfg.Validate(); err != nil {
+		t.Errorf("Expected config to be valid, got %v", err)
+	}
+}
+
+func TestFromEnvRejectsMalformedValues(t *testing.T) {
+	t.Setenv("DB_CONNECT_RETRIES", "many")
+
+	if _, err := FromEnv(); err == nil || !strings.Contains(err.Error(), "DB_CONNECT_RETRIES") {
+		t.Errorf("Expected an error for DB_CONNECT_RETRIES, got %v", err)
+	}
+}
+
+func TestValidateRequiresAppKeyAndDatabaseURL(t *testing.T) {
+	t.Setenv("DB_URL", "")
+	t.Setenv("APP_KEY", "")
+
+	cfg, err := FromEnv()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = cfg.Validate()
+	if err == nil {
+		t.Fatal("Expected validation to fail")
+	}
+
+	for _, key := range []string{"APP_KEY", "DB_URL"} {
+		if !strings.Contains(err.Error(), key) {
+			t.Errorf("Expected validation error to mention %s, got %v", key, err)
+		}
+	}
+}
+
+func TestLoadFlagsOverrideEnvironment(t *testing.T) {
+	t.Setenv("DB_URL", "postgres://localhost/go_reads")
+	t.Setenv("APP_KEY", "secret")
+	t.Setenv("API_HOST", ":9000")
+
+	cfg, err := Load([]string{"-addr", ":9090", "-log-level", "debug"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if cfg.Server.Addr != ":9090" {
+		t.Errorf("Expected flag address :9090, got %s", cfg.Server.Addr)
+	}
+
+	if cfg.Log.Level != "debug" {
+		t.Errorf("Expected log level debug, got %s", cfg.Log.Level)
+	}
+}
+
+func TestFromEnvSelectsBlobStoreBackend(t *testing.T) {
+	t.Setenv("BLOB_STORE_BACKEND", "")
+	t.Setenv("AWS_BUCKET_NAME", "")
+
+	cfg, err := FromEnv()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if cfg.BlobStore.Backend != "local" {
+		t.Errorf("Expected local backend without a bucket, got %s", cfg.BlobStore.Backend)
+	}
+
+	t.Setenv("AWS_BUCKET_NAME", "go-reads")
+	cfg, err = FromEnv()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if cfg.BlobStore.Backend != "s3" {
+		t.Errorf("Expected s3 backend with a bucket, got %s", cfg.BlobStore.Backend)
+	}
+}
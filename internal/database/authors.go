@@ -0,0 +1,302 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/kaanserin/go-reads/internal/utils"
+	"github.com/lib/pq"
+)
+
+// Roles a contributor can have on a book
+const (
+	AuthorRoleAuthor      = "author"
+	AuthorRoleTranslator  = "translator"
+	AuthorRoleIllustrator = "illustrator"
+	AuthorRoleEditor      = "editor"
+)
+
+var AuthorRoles = []string{AuthorRoleAuthor, AuthorRoleTranslator, AuthorRoleIllustrator, AuthorRoleEditor}
+
+type Author struct {
+	ID        int        `json:"id" db:"id"`
+	Name      string     `json:"name" db:"name"`
+	Bio       string     `json:"bio" db:"bio"`
+	BirthDate *time.Time `json:"birthDate" db:"birth_date"`
+	DeathDate *time.Time `json:"deathDate" db:"death_date"`
+	PhotoKey  string     `json:"-" db:"photo_key"`
+	CreatedAt time.Time  `json:"created_at" db:"created_at"`
+	UpdatedAt time.Time  `json:"updated_at" db:"updated_at"`
+
+	// Resolved, loadable URLs of the photo and its variants keyed by variant name
+	PhotoUrls map[string]string `json:"photo_urls,omitempty" db:"-"`
+}
+
+const authorColumns = "id, name, COALESCE(bio, '') AS bio, birth_date, death_date, COALESCE(photo_key, '') AS photo_key, created_at, updated_at"
+
+// BookContributor is an author credited on a book in one role
+type BookContributor struct {
+	BookID   int    `json:"-" db:"book_id"`
+	AuthorID int    `json:"author_id" db:"author_id"`
+	Name     string `json:"name" db:"name"`
+	Role     string `json:"role" db:"role"`
+}
+
+func (storage *PostgresqlStorage) GetAuthors(r *http.Request) ([]*Author, error) {
+	storage, span := storage.startSpan("GetAuthors")
+	defer span.End()
+
+	query := "SELECT " + authorColumns + " FROM authors"
+	if name := r.URL.Query().Get("name"); name != "" {
+		query += fmt.Sprintf(" WHERE name ILIKE %s", pq.QuoteLiteral("%"+name+"%"))
+	}
+
+	return GetLazyPaginatedResponsePG[Author](storage, r, query)
+}
+
+func (storage *PostgresqlStorage) GetAuthorById(id int) (*Author, error) {
+	storage, span := storage.startSpan("GetAuthorById")
+	defer span.End()
+
+	var author *Author = &Author{}
+	err := storage.db.GetContext(storage.context(), author, "SELECT "+authorColumns+" FROM authors WHERE id = $1", id)
+	if err != nil {
+		return nil, err
+	}
+
+	return author, nil
+}
+
+type AuthorDto struct {
+	Name      string     `json:"name" validate:"nonzero,max=200" db:"name"`
+	Bio       string     `json:"bio" db:"bio"`
+	BirthDate *time.Time `json:"birthDate" db:"birth_date"`
+	DeathDate *time.Time `json:"deathDate" db:"death_date"`
+}
+
+func (storage *PostgresqlStorage) CreateAuthor(authorDto *AuthorDto) (*Author, error) {
+	storage, span := storage.startSpan("CreateAuthor")
+	defer span.End()
+
+	var id int
+	err := storage.db.QueryRowContext(storage.context(),
+		"INSERT INTO authors (name, bio, birth_date, death_date) VALUES ($1, NULLIF($2, ''), $3, $4) RETURNING id",
+		authorDto.Name, authorDto.Bio, authorDto.BirthDate, authorDto.DeathDate).Scan(&id)
+	if err != nil {
+		return nil, err
+	}
+
+	return storage.GetAuthorById(id)
+}
+
+func (storage *PostgresqlStorage) UpdateAuthorById(id int, authorDto *AuthorDto) (*Author, error) {
+	storage, span := storage.startSpan("UpdateAuthorById")
+	defer span.End()
+
+	result, err := storage.db.ExecContext(storage.context(),
+		"UPDATE authors SET name = $1, bio = NULLIF($2, ''), birth_date = $3, death_date = $4, updated_at = $5 WHERE id = $6",
+		authorDto.Name, authorDto.Bio, authorDto.BirthDate, authorDto.DeathDate, time.Now(), id)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := expectAuthorAffected(result.RowsAffected, id); err != nil {
+		return nil, err
+	}
+
+	return storage.GetAuthorById(id)
+}
+
+// DeleteAuthorById removes the author together with their book credits
+func (storage *PostgresqlStorage) DeleteAuthorById(id int) error {
+	storage, span := storage.startSpan("DeleteAuthorById")
+	defer span.End()
+
+	result, err := storage.db.ExecContext(storage.context(), "DELETE FROM authors WHERE id = $1", id)
+	if err != nil {
+		return err
+	}
+
+	return expectAuthorAffected(result.RowsAffected, id)
+}
+
+// UpdateAuthorPhotoKey stores the object key of the author's photo, an empty key removes the photo
+func (storage *PostgresqlStorage) UpdateAuthorPhotoKey(id int, objectKey string) error {
+	storage, span := storage.startSpan("UpdateAuthorPhotoKey")
+	defer span.End()
+
+	result, err := storage.db.ExecContext(storage.context(), "UPDATE authors SET photo_key = NULLIF($1, '') WHERE id = $2", objectKey, id)
+	if err != nil {
+		return err
+	}
+
+	return expectAuthorAffected(result.RowsAffected, id)
+}
+
+func expectAuthorAffected(rowsAffected func() (int64, error), id int) error {
+	affectedRows, err := rowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if affectedRows == 0 {
+		return &utils.CustomError{
+			Message: fmt.Sprintf("No author found for the given id %d", id),
+		}
+	}
+
+	return nil
+}
+
+// GetBooksByAuthorId returns a page of the books the author is credited on in any role
+func (storage *PostgresqlStorage) GetBooksByAuthorId(id int, r *http.Request) ([]*Book, error) {
+	storage, span := storage.startSpan("GetBooksByAuthorId")
+	defer span.End()
+
+	query := fmt.Sprintf("SELECT %s FROM books WHERE id IN (SELECT book_id FROM book_authors WHERE author_id = %d)", bookColumns, id)
+	books, err := GetLazyPaginatedResponsePG[Book](storage, r, query)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := storage.loadBookRelations(books); err != nil {
+		return nil, err
+	}
+
+	return books, nil
+}
+
+// loadBookContributors fills in the credited authors of every book with a single query
+func (storage *PostgresqlStorage) loadBookContributors(books []*Book) error {
+	if len(books) == 0 {
+		return nil
+	}
+
+	ids := make([]int64, 0, len(books))
+	byId := make(map[int]*Book, len(books))
+	for _, book := range books {
+		ids = append(ids, int64(book.ID))
+		byId[book.ID] = book
+		book.Authors = make([]*BookContributor, 0)
+	}
+
+	contributors := make([]*BookContributor, 0)
+	err := storage.db.SelectContext(storage.context(), &contributors, `SELECT book_authors.book_id, book_authors.author_id, authors.name, book_authors.role
+	FROM book_authors JOIN authors ON authors.id = book_authors.author_id
+	WHERE book_authors.book_id = ANY($1)
+	ORDER BY book_authors.book_id, book_authors.position, authors.name`, pq.Array(ids))
+	if err != nil {
+		return err
+	}
+
+	for _, contributor := range contributors {
+		if book, ok := byId[contributor.BookID]; ok {
+			book.Authors = append(book.Authors, contributor)
+		}
+	}
+
+	return nil
+}
+
+type BookContributorDto struct {
+	AuthorID int    `json:"author_id" validate:"nonzero"`
+	Role     string `json:"role"`
+}
+
+// SetBookContributors replaces the credits of a book in the given order.
+// books.author is kept as the display text of the credited authors for older clients.
+func (storage *PostgresqlStorage) SetBookContributors(bookId int, contributors []*BookContributorDto) (*Book, error) {
+	storage, span := storage.startSpan("SetBookContributors")
+	defer span.End()
+
+	tx, err := storage.db.BeginTxx(storage.context(), nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var exists bool
+	if err := tx.GetContext(storage.context(), &exists, "SELECT EXISTS (SELECT 1 FROM books WHERE id = $1)", bookId); err != nil {
+		return nil, err
+	}
+
+	if !exists {
+		return nil, &utils.CustomError{
+			Message: fmt.Sprintf("No book found for the given id %d", bookId),
+		}
+	}
+
+	if _, err := tx.ExecContext(storage.context(), "DELETE FROM book_authors WHERE book_id = $1", bookId); err != nil {
+		return nil, err
+	}
+
+	authorNames := make([]string, 0, len(contributors))
+	for position, contributor := range contributors {
+		role := contributor.Role
+		if role == "" {
+			role = AuthorRoleAuthor
+		}
+
+		var name string
+		err := tx.GetContext(storage.context(), &name, "SELECT name FROM authors WHERE id = $1", contributor.AuthorID)
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, &utils.CustomError{
+				Message: fmt.Sprintf("No author found for the given id %d", contributor.AuthorID),
+			}
+		} else if err != nil {
+			return nil, err
+		}
+
+		_, err = tx.ExecContext(storage.context(), `INSERT INTO book_authors (book_id, author_id, role, position)
+		VALUES ($1, $2, $3, $4) ON CONFLICT DO NOTHING`, bookId, contributor.AuthorID, role, position)
+		if err != nil {
+			return nil, err
+		}
+
+		if role == AuthorRoleAuthor {
+			authorNames = append(authorNames, name)
+		}
+	}
+
+	edited := []string{BookFieldAuthors}
+	if len(authorNames) > 0 {
+		if _, err := tx.ExecContext(storage.context(), "UPDATE books SET author = left($1, 100) WHERE id = $2", strings.Join(authorNames, ", "), bookId); err != nil {
+			return nil, err
+		}
+
+		edited = append(edited, "author")
+	}
+
+	if err := storage.markBookFieldsManual(tx, bookId, edited...); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return storage.GetBookById(bookId)
+}
+
+// linkAuthorByName credits the author with the given name on a book, creating the author when there is none
+func (storage *PostgresqlStorage) linkAuthorByName(execer sqlx.ExecerContext, bookId int, name string) error {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return nil
+	}
+
+	_, err := execer.ExecContext(storage.context(), `WITH existing AS (
+		SELECT min(id) AS id FROM authors WHERE lower(name) = lower($2)
+	), created AS (
+		INSERT INTO authors (name) SELECT $2 WHERE (SELECT id FROM existing) IS NULL RETURNING id
+	)
+	INSERT INTO book_authors (book_id, author_id, role)
+	SELECT $1, COALESCE((SELECT id FROM existing), (SELECT id FROM created)), 'author'
+	ON CONFLICT DO NOTHING`, bookId, name)
+	return err
+}
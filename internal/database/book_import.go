@@ -0,0 +1,220 @@
+package database
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/lib/pq"
+)
+
+// ImportBookRow is a validated catalog row of a bulk import
+type ImportBookRow struct {
+	// Line of the row in the imported file, used to report results
+	Line int
+	// Format the row was read from, recorded as the source of the fields it sets
+	Source string
+	Book   *CreateBookDto
+	// Credits of the book in order, when the catalog lists them. Books without credits are credited to Book.Author.
+	Contributors []*ImportContributor
+}
+
+type ImportContributor struct {
+	Name string
+	Role string
+}
+
+type ImportBookResult struct {
+	Line   int `db:"line"`
+	BookID int `db:"book_id"`
+	// False when an existing book with the same ISBN was updated
+	Created bool `db:"created"`
+	// Fields of an updated book that kept their manually edited value
+	Kept pq.StringArray `db:"kept"`
+}
+
+// Columns of books an import sets
+var importedColumns = []string{"title", "author", "genre", "publication_date", "publisher", "isbn", "page_count", "language", "format"}
+
+// ImportBooks upserts a batch of books by ISBN in one transaction.
+// The rows are copied into a temporary table first so the batch is matched, updated and inserted with a handful of statements.
+// New books get a work of their own and are linked to their contributors and genre, which are created when missing.
+// Updated books keep their genres and every field librarians edited, the source of each field that was set is recorded.
+// With dryRun the transaction is rolled back, the results tell what the import would do.
+func (storage *PostgresqlStorage) ImportBooks(rows []*ImportBookRow, dryRun bool) ([]*ImportBookResult, error) {
+	storage, span := storage.startSpan("ImportBooks")
+	defer span.End()
+
+	ctx := storage.context()
+	tx, err := storage.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, `CREATE TEMPORARY TABLE book_import (
+		line INT NOT NULL,
+		source VARCHAR(50) NOT NULL,
+		title VARCHAR(100) NOT NULL,
+		author VARCHAR(100) NOT NULL,
+		genre VARCHAR(50) NOT NULL,
+		publication_date DATE NOT NULL,
+		publisher VARCHAR(100) NOT NULL,
+		isbn VARCHAR(50) NOT NULL,
+		page_count SMALLINT NOT NULL,
+		language VARCHAR(50) NOT NULL,
+		format VARCHAR(50) NOT NULL,
+		book_id INT,
+		work_id INT,
+		credited BOOLEAN NOT NULL DEFAULT false
+	) ON COMMIT DROP;
+	CREATE TEMPORARY TABLE book_import_contributors (
+		line INT NOT NULL,
+		name VARCHAR(200) NOT NULL,
+		role VARCHAR(20) NOT NULL,
+		position SMALLINT NOT NULL
+	) ON COMMIT DROP`)
+	if err != nil {
+		return nil, err
+	}
+
+	copyStmt, err := tx.PrepareContext(ctx, pq.CopyIn("book_import", append([]string{"line", "source"}, importedColumns...)...))
+	if err != nil {
+		return nil, err
+	}
+
+	for _, row := range rows {
+		book := row.Book
+		_, err := copyStmt.ExecContext(ctx, row.Line, row.Source, book.Title, book.Author, book.Genre, book.PublicationDate.Format("2006-01-02"),
+			book.Publisher, book.ISBN, book.PageCount, book.Language, book.Format)
+		if err != nil {
+			copyStmt.Close()
+			return nil, err
+		}
+	}
+
+	if _, err := copyStmt.ExecContext(ctx); err != nil {
+		copyStmt.Close()
+		return nil, err
+	}
+
+	if err := copyStmt.Close(); err != nil {
+		return nil, err
+	}
+
+	copyStmt, err = tx.PrepareContext(ctx, pq.CopyIn("book_import_contributors", "line", "name", "role", "position"))
+	if err != nil {
+		return nil, err
+	}
+
+	for _, row := range rows {
+		for position, contributor := range row.Contributors {
+			if _, err := copyStmt.ExecContext(ctx, row.Line, contributor.Name, contributor.Role, position); err != nil {
+				copyStmt.Close()
+				return nil, err
+			}
+		}
+	}
+
+	if _, err := copyStmt.ExecContext(ctx); err != nil {
+		copyStmt.Close()
+		return nil, err
+	}
+
+	if err := copyStmt.Close(); err != nil {
+		return nil, err
+	}
+
+	// Manually edited fields of existing books keep their value
+	assignments := make([]string, 0, len(importedColumns))
+	for _, column := range importedColumns {
+		assignments = append(assignments, fmt.Sprintf("%[1]s = CASE WHEN %[2]s THEN books.%[1]s ELSE book_import.%[1]s END",
+			column, fieldLockedSQL("books.id", column)))
+	}
+
+	statements := []string{
+		// Match existing books, ISBNs are compared without hyphens and spaces
+		`UPDATE book_import SET book_id = (
+			SELECT min(books.id) FROM books WHERE translate(books.isbn, '- ', '') = translate(book_import.isbn, '- ', '')
+		)`,
+		`UPDATE books SET ` + strings.Join(assignments, ", ") + ` FROM book_import WHERE books.id = book_import.book_id`,
+
+		// Insert the others, each as the only edition of a new work
+		`UPDATE book_import SET work_id = nextval(pg_get_serial_sequence('works', 'id')) WHERE book_id IS NULL`,
+		`INSERT INTO works (id, title) SELECT work_id, title FROM book_import WHERE work_id IS NOT NULL`,
+		`INSERT INTO books (title, author, genre, publication_date, publisher, isbn, page_count, language, format, work_id)
+		SELECT title, author, genre, publication_date, publisher, isbn, page_count, language, format, work_id
+		FROM book_import WHERE work_id IS NOT NULL`,
+		`UPDATE book_import SET book_id = books.id FROM books WHERE book_import.work_id IS NOT NULL AND books.work_id = book_import.work_id`,
+
+		// Listed contributors replace the credits of a book unless librarians edited them
+		`UPDATE book_import SET credited = EXISTS (SELECT 1 FROM book_import_contributors WHERE book_import_contributors.line = book_import.line)
+			AND NOT ` + fieldLockedSQL("book_import.book_id", BookFieldAuthors),
+		`DELETE FROM book_authors WHERE book_id IN (SELECT book_id FROM book_import WHERE credited)`,
+		`INSERT INTO authors (name)
+		SELECT DISTINCT ON (lower(name)) name FROM (
+			SELECT trim(book_import_contributors.name) AS name FROM book_import_contributors
+			JOIN book_import ON book_import.line = book_import_contributors.line WHERE book_import.credited
+			UNION ALL
+			SELECT trim(author) FROM book_import WHERE work_id IS NOT NULL AND NOT credited
+		) AS names
+		WHERE name <> '' AND NOT EXISTS (SELECT 1 FROM authors WHERE lower(authors.name) = lower(names.name))`,
+		`INSERT INTO book_authors (book_id, author_id, role, position)
+		SELECT book_import.book_id, (SELECT min(authors.id) FROM authors WHERE lower(authors.name) = lower(trim(book_import_contributors.name))),
+			book_import_contributors.role, book_import_contributors.position
+		FROM book_import_contributors JOIN book_import ON book_import.line = book_import_contributors.line
+		WHERE book_import.credited AND trim(book_import_contributors.name) <> ''
+		ON CONFLICT DO NOTHING`,
+		`INSERT INTO book_authors (book_id, author_id, role)
+		SELECT book_import.book_id, (SELECT min(authors.id) FROM authors WHERE lower(authors.name) = lower(trim(book_import.author))), 'author'
+		FROM book_import WHERE work_id IS NOT NULL AND NOT credited AND trim(author) <> ''
+		ON CONFLICT DO NOTHING`,
+
+		// File new books under their genre
+		fmt.Sprintf(`INSERT INTO genres (name, slug)
+		SELECT DISTINCT ON (%[1]s) trim(genre), %[1]s FROM book_import
+		WHERE work_id IS NOT NULL AND %[1]s <> ''
+		ON CONFLICT (slug) DO NOTHING`, genreSlugSQL("genre")),
+		fmt.Sprintf(`INSERT INTO book_genres (book_id, genre_id)
+		SELECT book_import.book_id, genres.id FROM book_import JOIN genres ON genres.slug = %s
+		WHERE book_import.work_id IS NOT NULL
+		ON CONFLICT DO NOTHING`, genreSlugSQL("book_import.genre")),
+
+		// Record where the fields that were set came from
+		`INSERT INTO book_field_sources (book_id, field, source)
+		SELECT book_import.book_id, fields.field, book_import.source
+		FROM book_import, unnest(` + fieldsArraySQL(BookFields) + `) AS fields (field)
+		WHERE book_import.work_id IS NOT NULL OR fields.field = ANY(` + fieldsArraySQL(importedColumns) + `)
+			OR (fields.field = ` + pq.QuoteLiteral(BookFieldAuthors) + ` AND book_import.credited)
+		ON CONFLICT (book_id, field) DO UPDATE SET source = EXCLUDED.source, updated_at = CURRENT_TIMESTAMP
+		WHERE book_field_sources.source <> ` + pq.QuoteLiteral(SourceManual),
+	}
+
+	for _, statement := range statements {
+		if _, err := tx.ExecContext(ctx, statement); err != nil {
+			return nil, err
+		}
+	}
+
+	results := make([]*ImportBookResult, 0, len(rows))
+	err = tx.SelectContext(ctx, &results, `SELECT line, book_id, work_id IS NOT NULL AS created,
+		ARRAY(
+			SELECT field FROM book_field_sources
+			WHERE book_id = book_import.book_id AND source = $1 AND book_import.work_id IS NULL
+				AND (field = ANY($2) OR (field = $3 AND EXISTS (SELECT 1 FROM book_import_contributors WHERE book_import_contributors.line = book_import.line)))
+			ORDER BY field
+		) AS kept
+	FROM book_import ORDER BY line`, SourceManual, pq.Array(importedColumns), BookFieldAuthors)
+	if err != nil {
+		return nil, err
+	}
+
+	if dryRun {
+		return results, nil
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return results, nil
+}
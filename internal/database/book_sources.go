@@ -0,0 +1,111 @@
+package database
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/kaanserin/go-reads/internal/utils"
+	"github.com/lib/pq"
+)
+
+// SourceManual marks fields edited through the API, imports leave them alone
+const SourceManual = "manual"
+
+// Book fields whose source is tracked, the columns of books plus the author credits and genre links
+const (
+	BookFieldAuthors = "authors"
+	BookFieldGenres  = "genres"
+)
+
+var BookFields = []string{"title", "author", "genre", "publication_date", "publisher", "isbn", "page_count", "language", "format", BookFieldAuthors, BookFieldGenres}
+
+// BookFieldSource tells where the current value of a book field came from
+type BookFieldSource struct {
+	Field     string    `json:"field" db:"field"`
+	Source    string    `json:"source" db:"source"`
+	UpdatedAt time.Time `json:"updated_at" db:"updated_at"`
+}
+
+func (storage *PostgresqlStorage) GetBookFieldSources(bookId int) ([]*BookFieldSource, error) {
+	storage, span := storage.startSpan("GetBookFieldSources")
+	defer span.End()
+
+	sources := make([]*BookFieldSource, 0)
+	err := storage.db.SelectContext(storage.context(), &sources,
+		"SELECT field, source, updated_at FROM book_field_sources WHERE book_id = $1 ORDER BY field", bookId)
+	if err != nil {
+		return nil, err
+	}
+
+	return sources, nil
+}
+
+// UnlockBookField forgets the source of a field so the next import may overwrite a manual edit
+func (storage *PostgresqlStorage) UnlockBookField(bookId int, field string) error {
+	storage, span := storage.startSpan("UnlockBookField")
+	defer span.End()
+
+	result, err := storage.db.ExecContext(storage.context(), "DELETE FROM book_field_sources WHERE book_id = $1 AND field = $2", bookId, field)
+	if err != nil {
+		return err
+	}
+
+	affectedRows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if affectedRows == 0 {
+		return &utils.CustomError{
+			Message: fmt.Sprintf("Field %s of book %d has no recorded source", field, bookId),
+		}
+	}
+
+	return nil
+}
+
+// markBookFieldsManual records the fields as edited by hand
+func (storage *PostgresqlStorage) markBookFieldsManual(execer sqlx.ExecerContext, bookId int, fields ...string) error {
+	_, err := execer.ExecContext(storage.context(), `INSERT INTO book_field_sources (book_id, field, source)
+	SELECT $1, field, $2 FROM unnest($3::text[]) AS fields (field)
+	ON CONFLICT (book_id, field) DO UPDATE SET source = EXCLUDED.source, updated_at = CURRENT_TIMESTAMP`,
+		bookId, SourceManual, pq.Array(fields))
+	return err
+}
+
+// manualChangesSQL marks the columns of the book whose value differs from the named parameter of the same name as edited by hand
+func manualChangesSQL(bookId int) string {
+	changes := make([]string, 0, len(BookFields))
+	for _, field := range BookFields {
+		if field == BookFieldAuthors || field == BookFieldGenres {
+			continue
+		}
+
+		changes = append(changes, fmt.Sprintf("(%s, books.%s IS DISTINCT FROM :%s)", pq.QuoteLiteral(field), field, field))
+	}
+
+	return fmt.Sprintf(`INSERT INTO book_field_sources (book_id, field, source)
+	SELECT books.id, changes.field, %s FROM books, LATERAL (VALUES %s) AS changes (field, changed)
+	WHERE books.id = %d AND changes.changed
+	ON CONFLICT (book_id, field) DO UPDATE SET source = EXCLUDED.source, updated_at = CURRENT_TIMESTAMP`,
+		pq.QuoteLiteral(SourceManual), strings.Join(changes, ", "), bookId)
+}
+
+// fieldLockedSQL is a condition that holds when the field of the book with the given id expression was edited by hand
+func fieldLockedSQL(bookId string, field string) string {
+	return fmt.Sprintf(`EXISTS (SELECT 1 FROM book_field_sources
+		WHERE book_field_sources.book_id = %s AND book_field_sources.field = %s AND book_field_sources.source = %s)`,
+		bookId, pq.QuoteLiteral(field), pq.QuoteLiteral(SourceManual))
+}
+
+// fieldsArraySQL is an array literal of the fields
+func fieldsArraySQL(fields []string) string {
+	quoted := make([]string, 0, len(fields))
+	for _, field := range fields {
+		quoted = append(quoted, pq.QuoteLiteral(field))
+	}
+
+	return "ARRAY[" + strings.Join(quoted, ", ") + "]::text[]"
+}
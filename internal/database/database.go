@@ -1,15 +1,21 @@
 package database
 
 import (
+	"context"
+	"database/sql"
+	"errors"
 	"fmt"
 	"net/http"
-	"os"
 	"strconv"
 	"time"
 
 	"github.com/jmoiron/sqlx"
+	"github.com/kaanserin/go-reads/internal/logging"
+	"github.com/kaanserin/go-reads/internal/tracing"
 	"github.com/kaanserin/go-reads/internal/utils"
-	_ "github.com/lib/pq"
+	"github.com/lib/pq"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
 type contextKey string
@@ -25,12 +31,19 @@ type User struct {
 	FirstName       string    `json:"first_name" db:"first_name"`
 	LastName        string    `json:"last_name" db:"last_name"`
 	Email           string    `json:"email" db:"email"`
-	Password        string    `json:"password,omitempty" db:"password"`
+	Password        string    `json:"password,omitempty" csv:"-" db:"password"`
 	RoleId          int       `json:"role_id" db:"role_id"`
-	ProfileImageUrl string    `json:"profile_image_url" db:"profile_image_url"`
+	ProfileImageKey string    `json:"-" db:"profile_image_url"`
 	CreatedAt       time.Time `json:"created_at" db:"created_at"`
+
+	// Resolved, loadable URLs of the profile image and its variants keyed by variant name
+	ProfileImageUrl  string            `json:"profile_image_url" db:"-"`
+	ProfileImageUrls map[string]string `json:"profile_image_urls,omitempty" db:"-"`
 }
 
+// Columns selected for users, the password hash is only read when signing in
+const userColumns = "id, first_name, last_name, email, role_id, COALESCE(profile_image_url, '') AS profile_image_url, created_at"
+
 type Role struct {
 	ID        int       `json:"id"`
 	Name      string    `json:"name"`
@@ -48,20 +61,78 @@ type Book struct {
 	PageCount       string    `json:"pageCount" db:"page_count"`
 	Language        string    `json:"language" db:"language"`
 	Format          string    `json:"format" db:"format"`
+	CoverImageKey   string    `json:"-" db:"cover_image_key"`
+	// Work the book is an edition of, reviews of every edition roll up to it
+	WorkID int `json:"work_id" db:"work_id"`
+
+	// Credited authors, translators, illustrators and editors in billing order
+	Authors []*BookContributor `json:"authors,omitempty" db:"-"`
+	// Series the book's work belongs to with its position in each
+	Series []*BookSeries `json:"series,omitempty" db:"-"`
+	// Genres of the taxonomy the book is filed under, in the order librarians gave them
+	Genres []*BookGenre `json:"genres,omitempty" db:"-"`
+	// Tags most readers put on the book, only filled in when a single book is fetched
+	TopTags []*TagCount `json:"top_tags,omitempty" db:"-"`
+
+	// Resolved, loadable URLs of the cover renditions keyed by rendition name
+	CoverUrls map[string]string `json:"cover_urls,omitempty" db:"-"`
 }
 
+const bookColumns = "id, title, author, genre, publication_date, publisher, isbn, page_count, language, format, COALESCE(cover_image_key, '') AS cover_image_key, work_id"
+
 type BookReview struct {
-	ID        int       `json:"id" db:"id"`
-	BookID    int       `json:"book_id" db:"book_id"`
-	UserID    int       `json:"user_id" db:"user_id"`
-	Score     int       `json:"score" db:"score"`
-	Review    string    `json:"review" db:"review"`
-	CreatedAt time.Time `json:"created_at" db:"created_at"`
-	UpdatedAt time.Time `json:"updated_at" db:"updated_at"`
+	ID     int     `json:"id" db:"id"`
+	BookID int     `json:"book_id" db:"book_id"`
+	UserID int     `json:"user_id" db:"user_id"`
+	Score  float64 `json:"score" db:"score"`
+	// Markdown, empty for ratings without a written review
+	Review string `json:"review" db:"review"`
+	// The review rendered as sanitized HTML for the reader
+	ReviewHTML string `json:"review_html" db:"-"`
+	// The whole review gives the plot away
+	Spoiler bool `json:"spoiler" db:"spoiler"`
+	// Spoilers were redacted from the review text for the reader
+	SpoilersHidden bool      `json:"spoilers_hidden,omitempty" db:"-"`
+	CreatedAt      time.Time `json:"created_at" db:"created_at"`
+	UpdatedAt      time.Time `json:"updated_at" db:"updated_at"`
+	LikesCount     int       `json:"likes_count" db:"likes_count"`
+	// The review was changed since it was first written, its earlier versions are kept as revisions
+	Edited        bool `json:"edited" db:"edited"`
+	CommentsCount int  `json:"comments_count" db:"comments_count"`
 }
 
+const bookReviewColumns = `id, book_id, user_id, score, COALESCE(review, '') AS review, spoiler, created_at, updated_at,
+	(SELECT count(*) FROM review_likes WHERE review_likes.review_id = book_reviews.id) AS likes_count,
+	(SELECT count(*) FROM review_comments WHERE review_comments.review_id = book_reviews.id AND review_comments.deleted_at IS NULL) AS comments_count,
+	EXISTS (SELECT 1 FROM review_revisions WHERE review_revisions.review_id = book_reviews.id) AS edited`
+
 type PostgresqlStorage struct {
 	db *sqlx.DB
+
+	// ctx is the context of the request the storage is bound to
+	ctx context.Context
+}
+
+func (storage *PostgresqlStorage) context() context.Context {
+	if storage.ctx == nil {
+		return context.Background()
+	}
+
+	return storage.ctx
+}
+
+// WithContext returns a copy of the storage bound to ctx, queries and spans use it as their parent
+func (storage *PostgresqlStorage) WithContext(ctx context.Context) *PostgresqlStorage {
+	return &PostgresqlStorage{db: storage.db, ctx: ctx}
+}
+
+// startSpan opens a span for a storage method and returns a copy of the storage bound to it
+func (storage *PostgresqlStorage) startSpan(name string) (*PostgresqlStorage, trace.Span) {
+	ctx, span := tracing.Tracer().Start(storage.context(), "storage."+name,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(attribute.String("db.system", "postgresql")))
+
+	return storage.WithContext(ctx), span
 }
 
 func GetLazyPaginatedResponsePG[V any](storage *PostgresqlStorage, r *http.Request, query string) ([]*V, error) {
@@ -91,7 +162,11 @@ func GetLazyPaginatedResponsePG[V any](storage *PostgresqlStorage, r *http.Reque
 
 	queryWithLimit := fmt.Sprintf("%s order by id desc offset %d limit %s", query, offset, pageLength)
 
-	err = storage.db.Select(&results, queryWithLimit)
+	storage, span := storage.startSpan("paginatedQuery")
+	defer span.End()
+	span.SetAttributes(attribute.Int64("db.page", pageNum), attribute.Int64("db.page_length", pageLengthNum))
+
+	err = storage.db.SelectContext(storage.context(), &results, queryWithLimit)
 	if err != nil {
 		return nil, err
 	}
@@ -104,35 +179,112 @@ type Storage interface {
 	GetUserById(int) (*User, error)
 	GetUserByEmail(string) (*User, error)
 	CreateUser(firstName, lastName, email, password string) (*User, error)
+	CreateUserWithRole(firstName, lastName, email, password string, roleId int) (*User, error)
 	DeleteUserById(int) error
 	GetRoleById(int) (*Role, error)
+	GetRoleByName(name string) (*Role, error)
+	UpdateUserRole(id int, roleId int) error
 	UpdateUserProfileImageUrl(id int, objectKey string) error
+	GetAllUsers() ([]*User, error)
 
 	// Books
 	GetBooks(r *http.Request) ([]*Book, error)
+	GetAllBooks() ([]*Book, error)
+	CreateBook(createBookDto *CreateBookDto) (*Book, error)
+	GetBooksByISBN(isbn string) ([]*Book, error)
+	UpdateBookCoverKey(id int, objectKey string) error
+	ImportBooks(rows []*ImportBookRow, dryRun bool) ([]*ImportBookResult, error)
+	SetBookContributors(bookId int, contributors []*BookContributorDto) (*Book, error)
+
+	// Works
+	GetWorkById(id int) (*Work, error)
+	UpdateWorkById(id int, workDto *WorkDto) (*Work, error)
+	GetEditionsByWorkId(id int, r *http.Request) ([]*Book, error)
+	GetBookReviewsByWorkId(id int, r *http.Request) ([]*BookReview, error)
+	MergeWorks(targetId int, sourceIds []int) (*Work, error)
+	SplitWork(id int, bookIds []int) (*Work, error)
+
+	// Series
+	GetSeries(r *http.Request) ([]*Series, error)
+	GetSeriesById(id int) (*Series, error)
+	CreateSeries(seriesDto *SeriesDto) (*Series, error)
+	UpdateSeriesById(id int, seriesDto *SeriesDto) (*Series, error)
+	DeleteSeriesById(id int) error
+	SetSeriesWork(seriesId int, workId int, position float64) (*Series, error)
+	RemoveSeriesWork(seriesId int, workId int) (*Series, error)
+	GetNextUnreadInSeries(seriesId int, userId int) (*SeriesEntry, error)
+
+	// Genres and tags
+	GetGenres() ([]*Genre, error)
+	GetGenreBySlug(slug string) (*Genre, error)
+	GetGenreAncestors(id int) ([]*Genre, error)
+	CreateGenre(genreDto *GenreDto) (*Genre, error)
+	UpdateGenreBySlug(slug string, genreDto *GenreDto) (*Genre, error)
+	DeleteGenreBySlug(slug string) error
+	GetBooksByGenreId(id int, r *http.Request) ([]*Book, error)
+	SetBookGenres(bookId int, genreIds []int) (*Book, error)
+	AddBookTag(bookId int, userId int, tag string) error
+	RemoveBookTag(bookId int, userId int, tag string) error
+	GetBookTopTags(bookId int, limit int) ([]*TagCount, error)
+	GetUserBookTags(bookId int, userId int) ([]string, error)
+	GetBookFieldSources(bookId int) ([]*BookFieldSource, error)
+	UnlockBookField(bookId int, field string) error
+
+	// Libraries
+	ImportLibrary(userId int, rows []*LibraryImportRow) ([]*LibraryImportResult, error)
+	GetUserLibrary(userId int) ([]*LibraryEntry, error)
+	Export(tables []string, sink ExportSink) error
+
+	// Authors
+	GetAuthors(r *http.Request) ([]*Author, error)
+	GetAuthorById(id int) (*Author, error)
+	CreateAuthor(authorDto *AuthorDto) (*Author, error)
+	UpdateAuthorById(id int, authorDto *AuthorDto) (*Author, error)
+	DeleteAuthorById(id int) error
+	UpdateAuthorPhotoKey(id int, objectKey string) error
+	GetBooksByAuthorId(id int, r *http.Request) ([]*Book, error)
 
 	// Book Reviews
 	GetBookReviews(r *http.Request) ([]*BookReview, error)
 	GetBookReviewById(id int) (*BookReview, error)
+	CreateBookReview(createUserDto *CreateBookReviewDto) (*BookReview, error)
 	DeleteBookReviewById(id int) error
 	UpdateBookReview(id int, updateBookReviewDto UpdateBookReviewDto) (*BookReview, error)
+	UpsertBookReview(createUserDto *CreateBookReviewDto) (*BookReview, bool, error)
+	GetUserBookReview(userId int, bookId int) (*BookReview, error)
+	GetAllBookReviews() ([]*BookReview, error)
+	LikeBookReview(reviewId int, userId int) error
+	UnlikeBookReview(reviewId int, userId int) error
+	GetReviewComments(reviewId int) ([]*ReviewComment, error)
+	GetReviewCommentById(id int) (*ReviewComment, error)
+	CreateReviewComment(reviewId int, userId int, commentDto *ReviewCommentDto) (*ReviewComment, error)
+	UpdateReviewComment(id int, body string) (*ReviewComment, error)
+	DeleteReviewComment(id int) error
+	GetReviewRevisions(reviewId int) ([]*ReviewRevision, error)
+
+	// Maintenance
+	Reindex() error
 }
 
 func (storage *PostgresqlStorage) GetUserById(id int) (*User, error) {
+	storage, span := storage.startSpan("GetUserById")
+	defer span.End()
+
 	var user *User = &User{}
 
-	err := storage.db.Get(user, "SELECT * from users where id = $1", id)
+	err := storage.db.GetContext(storage.context(), user, "SELECT "+userColumns+" from users where id = $1", id)
 	if err != nil {
 		return nil, err
 	}
 
-	user.Password = ""
-
 	return user, nil
 }
 
 func (storage *PostgresqlStorage) GetUsers(r *http.Request) ([]*User, error) {
-	query := "select id, first_name, last_name, email, role_id, created_at from users"
+	storage, span := storage.startSpan("GetUsers")
+	defer span.End()
+
+	query := "select " + userColumns + " from users"
 	users, err := GetLazyPaginatedResponsePG[User](storage, r, query)
 	if err != nil {
 		return nil, err
@@ -142,16 +294,20 @@ func (storage *PostgresqlStorage) GetUsers(r *http.Request) ([]*User, error) {
 }
 
 func (storage *PostgresqlStorage) GetUserByEmail(email string) (*User, error) {
+	storage, span := storage.startSpan("GetUserByEmail")
+	defer span.End()
+
 	var user *User = &User{}
 
-	err := storage.db.QueryRow(
-		"SELECT id, first_name, last_name, email, role_id, password, created_at from users where email = $1", email).Scan(
+	err := storage.db.QueryRowContext(storage.context(),
+		"SELECT id, first_name, last_name, email, role_id, password, COALESCE(profile_image_url, ''), created_at from users where email = $1", email).Scan(
 		&user.ID,
 		&user.FirstName,
 		&user.LastName,
 		&user.Email,
 		&user.RoleId,
 		&user.Password,
+		&user.ProfileImageKey,
 		&user.CreatedAt,
 	)
 
@@ -163,7 +319,10 @@ func (storage *PostgresqlStorage) GetUserByEmail(email string) (*User, error) {
 }
 
 func (storage *PostgresqlStorage) CreateUser(first_name, last_name, email, password string) (*User, error) {
-	_, err := storage.db.Exec(
+	storage, span := storage.startSpan("CreateUser")
+	defer span.End()
+
+	_, err := storage.db.ExecContext(storage.context(),
 		"INSERT INTO users (first_name, last_name, email, password) VALUES ($1, $2, $3, $4)",
 		first_name,
 		last_name,
@@ -183,8 +342,37 @@ func (storage *PostgresqlStorage) CreateUser(first_name, last_name, email, passw
 	return user, nil
 }
 
+// CreateUserWithRole adds a user who holds the role from the start, such as an admin created from the command line
+func (storage *PostgresqlStorage) CreateUserWithRole(first_name, last_name, email, password string, roleId int) (*User, error) {
+	storage, span := storage.startSpan("CreateUserWithRole")
+	defer span.End()
+
+	_, err := storage.db.ExecContext(storage.context(),
+		"INSERT INTO users (first_name, last_name, email, password, role_id) VALUES ($1, $2, $3, $4, $5)",
+		first_name,
+		last_name,
+		email,
+		password,
+		roleId)
+
+	if err != nil {
+		return nil, err
+	}
+
+	user, err := storage.GetUserByEmail(email)
+	if err != nil {
+		return nil, err
+	}
+
+	user.Password = ""
+	return user, nil
+}
+
 func (storage *PostgresqlStorage) DeleteUserById(id int) error {
-	_, err := storage.db.Exec(fmt.Sprintf("DELETE FROM users where id = %d", id))
+	storage, span := storage.startSpan("DeleteUserById")
+	defer span.End()
+
+	_, err := storage.db.ExecContext(storage.context(), fmt.Sprintf("DELETE FROM users where id = %d", id))
 	return err
 }
 
@@ -196,12 +384,15 @@ type UpdateUserDto struct {
 }
 
 func (storage *PostgresqlStorage) UpdateUserById(id int, payload *UpdateUserDto) (*User, error) {
+	storage, span := storage.startSpan("UpdateUserById")
+	defer span.End()
+
 	user, err := storage.GetUserById(id)
 	if err != nil {
 		return nil, err
 	}
 
-	_, err = storage.db.Exec("UPDATE users SET first_name = $1, last_name = $2, email = $3 WHERE id = $4", payload.FirstName, payload.LastName, payload.Email, id)
+	_, err = storage.db.ExecContext(storage.context(), "UPDATE users SET first_name = $1, last_name = $2, email = $3 WHERE id = $4", payload.FirstName, payload.LastName, payload.Email, id)
 	if err != nil {
 		return nil, err
 	}
@@ -213,8 +404,29 @@ func (storage *PostgresqlStorage) UpdateUserById(id int, payload *UpdateUserDto)
 }
 
 func (storage *PostgresqlStorage) GetRoleById(id int) (*Role, error) {
+	storage, span := storage.startSpan("GetRoleById")
+	defer span.End()
+
+	var role *Role = &Role{}
+	err := storage.db.QueryRowContext(storage.context(), "SELECT id, name, created_at FROM roles WHERE id = $1", id).Scan(
+		&role.ID,
+		&role.Name,
+		&role.CreatedAt,
+	)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return role, nil
+}
+
+func (storage *PostgresqlStorage) GetRoleByName(name string) (*Role, error) {
+	storage, span := storage.startSpan("GetRoleByName")
+	defer span.End()
+
 	var role *Role = &Role{}
-	err := storage.db.QueryRow("SELECT id, name, created_at FROM roles WHERE id = $1", id).Scan(
+	err := storage.db.QueryRowContext(storage.context(), "SELECT id, name, created_at FROM roles WHERE name = $1", name).Scan(
 		&role.ID,
 		&role.Name,
 		&role.CreatedAt,
@@ -227,20 +439,221 @@ func (storage *PostgresqlStorage) GetRoleById(id int) (*Role, error) {
 	return role, nil
 }
 
+func (storage *PostgresqlStorage) UpdateUserRole(id int, roleId int) error {
+	storage, span := storage.startSpan("UpdateUserRole")
+	defer span.End()
+
+	result, err := storage.db.ExecContext(storage.context(), "UPDATE users SET role_id = $1 WHERE id = $2", roleId, id)
+	if err != nil {
+		return err
+	}
+
+	rowsAff, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAff == 0 {
+		return &utils.CustomError{
+			Message: fmt.Sprintf("No user found for the given id %d", id),
+		}
+	}
+
+	return nil
+}
+
+// GetAllUsers returns every user without their password hash
+func (storage *PostgresqlStorage) GetAllUsers() ([]*User, error) {
+	storage, span := storage.startSpan("GetAllUsers")
+	defer span.End()
+
+	users := make([]*User, 0)
+	err := storage.db.SelectContext(storage.context(), &users, "SELECT "+userColumns+" FROM users ORDER BY id")
+	if err != nil {
+		return nil, err
+	}
+
+	return users, nil
+}
+
 func (storage *PostgresqlStorage) GetBooks(r *http.Request) ([]*Book, error) {
-	return GetLazyPaginatedResponsePG[Book](storage, r, "SELECT id, title, author, genre, publication_date, publisher, isbn, page_count, language, format FROM books")
+	storage, span := storage.startSpan("GetBooks")
+	defer span.End()
+
+	books, err := GetLazyPaginatedResponsePG[Book](storage, r, "SELECT "+bookColumns+" FROM books")
+	if err != nil {
+		return nil, err
+	}
+
+	if err := storage.loadBookRelations(books); err != nil {
+		return nil, err
+	}
+
+	return books, nil
 }
 
 func (storage *PostgresqlStorage) GetBookById(id int) (*Book, error) {
+	storage, span := storage.startSpan("GetBookById")
+	defer span.End()
+
 	var book *Book = &Book{}
-	err := storage.db.Get(book, "SELECT * from books where id = $1 LIMIT 1", id)
+	err := storage.db.GetContext(storage.context(), book, "SELECT "+bookColumns+" from books where id = $1 LIMIT 1", id)
 	if err != nil {
 		return nil, err
 	}
 
+	if err := storage.loadBookRelations([]*Book{book}); err != nil {
+		return nil, err
+	}
+
 	return book, nil
 }
 
+func (storage *PostgresqlStorage) GetAllBooks() ([]*Book, error) {
+	storage, span := storage.startSpan("GetAllBooks")
+	defer span.End()
+
+	books := make([]*Book, 0)
+	err := storage.db.SelectContext(storage.context(), &books,
+		"SELECT "+bookColumns+" FROM books ORDER BY id")
+	if err != nil {
+		return nil, err
+	}
+
+	if err := storage.loadBookRelations(books); err != nil {
+		return nil, err
+	}
+
+	return books, nil
+}
+
+// loadBookRelations fills in what books reference in other tables
+func (storage *PostgresqlStorage) loadBookRelations(books []*Book) error {
+	if err := storage.loadBookContributors(books); err != nil {
+		return err
+	}
+
+	if err := storage.loadBookGenres(books); err != nil {
+		return err
+	}
+
+	return storage.loadBookSeries(books)
+}
+
+type CreateBookDto struct {
+	// Existing work the book is a new edition of, a new work is created when empty
+	WorkID          int       `json:"workId" db:"work_id"`
+	Title           string    `json:"title" validate:"nonzero" db:"title"`
+	Author          string    `json:"author" validate:"nonzero" db:"author"`
+	Genre           string    `json:"genre" validate:"nonzero" db:"genre"`
+	PublicationDate time.Time `json:"publicationDate" validate:"nonzero" db:"publication_date"`
+	Publisher       string    `json:"publisher" validate:"nonzero" db:"publisher"`
+	ISBN            string    `json:"isbn" validate:"nonzero" db:"isbn"`
+	PageCount       string    `json:"pageCount" validate:"nonzero" db:"page_count"`
+	Language        string    `json:"language" validate:"nonzero" db:"language"`
+	Format          string    `json:"format" validate:"nonzero" db:"format"`
+}
+
+// ErrDuplicateISBN is returned when a book is created with, or changed to, the ISBN of an existing book
+var ErrDuplicateISBN = errors.New("a book with this ISBN already exists")
+
+// isbnWriteError turns a violation of the unique index on ISBNs into ErrDuplicateISBN
+func isbnWriteError(err error) error {
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) && pqErr.Code.Name() == "unique_violation" && pqErr.Constraint == "books_isbn_unique_idx" {
+		return ErrDuplicateISBN
+	}
+
+	return err
+}
+
+// CreateBook adds a book with its author credit and genre, or returns ErrDuplicateISBN.
+// Its fields are marked as edited by hand so imports leave them alone.
+func (storage *PostgresqlStorage) CreateBook(createBookDto *CreateBookDto) (*Book, error) {
+	storage, span := storage.startSpan("CreateBook")
+	defer span.End()
+
+	tx, err := storage.db.BeginTxx(storage.context(), nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var id int
+	query, args, err := tx.BindNamed(`WITH new_work AS (
+		INSERT INTO works (title) SELECT :title WHERE :work_id = 0 RETURNING id
+	)
+	INSERT INTO books
+	(title, author, genre, publication_date, publisher, isbn, page_count, language, format, work_id)
+	VALUES (:title, :author, :genre, :publication_date, :publisher, :isbn, :page_count, :language, :format,
+	COALESCE((SELECT id FROM new_work), NULLIF(:work_id, 0)))
+	RETURNING id`, createBookDto)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := tx.GetContext(storage.context(), &id, query, args...); err != nil {
+		return nil, isbnWriteError(err)
+	}
+
+	if err := storage.linkAuthorByName(tx, id, createBookDto.Author); err != nil {
+		return nil, err
+	}
+
+	if err := storage.linkGenreByName(tx, id, createBookDto.Genre); err != nil {
+		return nil, err
+	}
+
+	if err := storage.markBookFieldsManual(tx, id, BookFields...); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return storage.GetBookById(id)
+}
+
+// GetBooksByISBN returns every book with the given ISBN, ignoring hyphens and spaces
+func (storage *PostgresqlStorage) GetBooksByISBN(isbn string) ([]*Book, error) {
+	storage, span := storage.startSpan("GetBooksByISBN")
+	defer span.End()
+
+	books := make([]*Book, 0)
+	err := storage.db.SelectContext(storage.context(), &books,
+		"SELECT "+bookColumns+" FROM books WHERE translate(isbn, '- ', '') = translate($1, '- ', '') ORDER BY id", isbn)
+	if err != nil {
+		return nil, err
+	}
+
+	return books, nil
+}
+
+// UpdateBookCoverKey stores the object key of the book's cover, an empty key removes the cover
+func (storage *PostgresqlStorage) UpdateBookCoverKey(id int, objectKey string) error {
+	storage, span := storage.startSpan("UpdateBookCoverKey")
+	defer span.End()
+
+	result, err := storage.db.ExecContext(storage.context(), "UPDATE books SET cover_image_key = NULLIF($1, '') WHERE id = $2", objectKey, id)
+	if err != nil {
+		return err
+	}
+
+	affectedRows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if affectedRows == 0 {
+		return &utils.CustomError{
+			Message: fmt.Sprintf("No book found for the given id %d", id),
+		}
+	}
+
+	return nil
+}
+
 type UpdateBookDto struct {
 	Title           string    `json:"title" validate:"nonzero" db:"title"`
 	Author          string    `json:"author" validate:"nonzero" db:"author"`
@@ -254,13 +667,27 @@ type UpdateBookDto struct {
 }
 
 func (storage *PostgresqlStorage) UpdateBookById(id int, payload *UpdateBookDto) (*Book, error) {
-	result, err := storage.db.NamedExec(fmt.Sprintf(`UPDATE books
+	storage, span := storage.startSpan("UpdateBookById")
+	defer span.End()
+
+	tx, err := storage.db.BeginTxx(storage.context(), nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	// Changed fields are marked as edited by hand before the update overwrites their old values
+	if _, err := tx.NamedExecContext(storage.context(), manualChangesSQL(id), payload); err != nil {
+		return nil, err
+	}
+
+	result, err := tx.NamedExecContext(storage.context(), fmt.Sprintf(`UPDATE books
 	SET title = :title, author = :author, genre = :genre, publication_date = :publication_date,
 	publisher = :publisher, isbn = :isbn, page_count = :page_count, language = :language, format = :format
 	WHERE id = %d`, id), payload)
 
 	if err != nil {
-		return nil, err
+		return nil, isbnWriteError(err)
 	}
 
 	affectedRows, err := result.RowsAffected()
@@ -274,22 +701,23 @@ func (storage *PostgresqlStorage) UpdateBookById(id int, payload *UpdateBookDto)
 		}
 	}
 
-	var book *Book = &Book{}
-	err = storage.db.Get(book, "SELECT * from books WHERE ID = $1", id)
-	if err != nil {
+	if err := tx.Commit(); err != nil {
 		return nil, err
 	}
 
-	return book, nil
+	return storage.GetBookById(id)
 }
 
 func (storage *PostgresqlStorage) DeleteBookById(id int) error {
-	_, err := storage.GetBookById(id)
+	storage, span := storage.startSpan("DeleteBookById")
+	defer span.End()
+
+	book, err := storage.GetBookById(id)
 	if err != nil {
 		return err
 	}
 
-	result, err := storage.db.Exec("DELETE FROM books WHERE id = $1", id)
+	result, err := storage.db.ExecContext(storage.context(), "DELETE FROM books WHERE id = $1", id)
 	if err != nil {
 		return err
 	}
@@ -305,17 +733,38 @@ func (storage *PostgresqlStorage) DeleteBookById(id int) error {
 		}
 	}
 
-	return nil
+	// A work without editions is not reachable anymore
+	_, err = storage.db.ExecContext(storage.context(),
+		"DELETE FROM works WHERE id = $1 AND NOT EXISTS (SELECT 1 FROM books WHERE work_id = $1)", book.WorkID)
+	return err
 }
 
 func (storage *PostgresqlStorage) GetBookReviews(r *http.Request) ([]*BookReview, error) {
-	return GetLazyPaginatedResponsePG[BookReview](storage, r, "SELECT * from book_reviews")
+	storage, span := storage.startSpan("GetBookReviews")
+	defer span.End()
+
+	return GetLazyPaginatedResponsePG[BookReview](storage, r, "SELECT "+bookReviewColumns+" FROM book_reviews")
+}
+
+func (storage *PostgresqlStorage) GetAllBookReviews() ([]*BookReview, error) {
+	storage, span := storage.startSpan("GetAllBookReviews")
+	defer span.End()
+
+	bookReviews := make([]*BookReview, 0)
+	if err := storage.db.SelectContext(storage.context(), &bookReviews, "SELECT "+bookReviewColumns+" FROM book_reviews ORDER BY id"); err != nil {
+		return nil, err
+	}
+
+	return bookReviews, nil
 }
 
 func (storage *PostgresqlStorage) GetBookReviewById(id int) (*BookReview, error) {
+	storage, span := storage.startSpan("GetBookReviewById")
+	defer span.End()
+
 	var bookReview *BookReview = &BookReview{}
 
-	err := storage.db.Get(bookReview, "SELECT * FROM book_reviews WHERE ID = $1", id)
+	err := storage.db.GetContext(storage.context(), bookReview, "SELECT "+bookReviewColumns+" FROM book_reviews WHERE ID = $1", id)
 	if err != nil {
 		return nil, err
 	}
@@ -323,26 +772,100 @@ func (storage *PostgresqlStorage) GetBookReviewById(id int) (*BookReview, error)
 	return bookReview, nil
 }
 
+// CreateBookReviewDto rates a book, the review text is optional
 type CreateBookReviewDto struct {
-	BookID int    `json:"bookId" db:"book_id" validate:"nonzero"`
-	UserID int    `json:"userId" db:"user_id"`
-	Score  int    `json:"score" db:"score" validate:"nonzero"`
-	Review string `json:"review" db:"review" validate:"nonzero"`
+	BookID int     `json:"bookId" db:"book_id" validate:"nonzero"`
+	UserID int     `json:"userId" db:"user_id"`
+	Score  float64 `json:"score" db:"score" validate:"stars"`
+	// Markdown, at most Reviews.MaxLength characters
+	Review string `json:"review" db:"review"`
+	// The review gives the plot away, inline spoilers are marked with [spoiler]...[/spoiler]
+	Spoiler bool `json:"spoiler" db:"spoiler"`
 }
 
+// ErrDuplicateReview is returned when a user reviews a book they already reviewed
+var ErrDuplicateReview = errors.New("the book is already reviewed by the user")
+
+// CreateBookReview adds the review of a user, it returns sql.ErrNoRows when the book does not exist
+// and ErrDuplicateReview when the user already reviewed it
 func (storage *PostgresqlStorage) CreateBookReview(createUserDto *CreateBookReviewDto) (*BookReview, error) {
+	storage, span := storage.startSpan("CreateBookReview")
+	defer span.End()
+
+	if err := storage.requireBook(createUserDto.BookID); err != nil {
+		return nil, err
+	}
+
 	var id int
-	err := storage.db.QueryRow("INSERT INTO book_reviews (book_id, user_id, score, review) VALUES ($1, $2, $3, $4) RETURNING id",
-		createUserDto.BookID, createUserDto.UserID, createUserDto.Score, createUserDto.Review).Scan(&id)
-	if err != nil {
+	err := storage.db.QueryRowContext(storage.context(), `INSERT INTO book_reviews (book_id, user_id, score, review, spoiler) VALUES ($1, $2, $3, NULLIF($4, ''), $5)
+	ON CONFLICT (user_id, book_id) DO NOTHING RETURNING id`,
+		createUserDto.BookID, createUserDto.UserID, createUserDto.Score, createUserDto.Review, createUserDto.Spoiler).Scan(&id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrDuplicateReview
+	} else if err != nil {
 		return nil, err
 	}
 
 	return storage.GetBookReviewById(id)
 }
 
+// UpsertBookReview creates the review of a user or replaces the score and text of the one they wrote before,
+// created tells which one happened. It returns sql.ErrNoRows when the book does not exist.
+func (storage *PostgresqlStorage) UpsertBookReview(createUserDto *CreateBookReviewDto) (review *BookReview, created bool, err error) {
+	storage, span := storage.startSpan("UpsertBookReview")
+	defer span.End()
+
+	if err := storage.requireBook(createUserDto.BookID); err != nil {
+		return nil, false, err
+	}
+
+	var id int
+	// xmax is only set on rows the statement updated
+	err = storage.db.QueryRowContext(storage.context(), keepRevision("user_id = $2 AND book_id = $1", "$3", "$4", "$5", "$2")+`INSERT INTO book_reviews (book_id, user_id, score, review, spoiler) VALUES ($1, $2, $3, NULLIF($4, ''), $5)
+	ON CONFLICT (user_id, book_id) DO UPDATE SET score = EXCLUDED.score, review = EXCLUDED.review, spoiler = EXCLUDED.spoiler, updated_at = CURRENT_TIMESTAMP
+	RETURNING id, xmax = 0`,
+		createUserDto.BookID, createUserDto.UserID, createUserDto.Score, createUserDto.Review, createUserDto.Spoiler).Scan(&id, &created)
+	if err != nil {
+		return nil, false, err
+	}
+
+	review, err = storage.GetBookReviewById(id)
+	return review, created, err
+}
+
+// GetUserBookReview returns the review the user wrote of the book, or sql.ErrNoRows
+func (storage *PostgresqlStorage) GetUserBookReview(userId int, bookId int) (*BookReview, error) {
+	storage, span := storage.startSpan("GetUserBookReview")
+	defer span.End()
+
+	var bookReview *BookReview = &BookReview{}
+	err := storage.db.GetContext(storage.context(), bookReview, "SELECT "+bookReviewColumns+" FROM book_reviews WHERE user_id = $1 AND book_id = $2", userId, bookId)
+	if err != nil {
+		return nil, err
+	}
+
+	return bookReview, nil
+}
+
+// requireBook returns sql.ErrNoRows when the book does not exist
+func (storage *PostgresqlStorage) requireBook(id int) error {
+	var exists bool
+	if err := storage.db.GetContext(storage.context(), &exists, "SELECT EXISTS (SELECT 1 FROM books WHERE id = $1)", id); err != nil {
+		return err
+	}
+
+	if !exists {
+		return sql.ErrNoRows
+	}
+
+	return nil
+}
+
 func (storage *PostgresqlStorage) DeleteBookReviewById(id int) error {
-	result, err := storage.db.Exec("DELETE FROM book_reviews WHERE id = $1", id)
+	storage, span := storage.startSpan("DeleteBookReviewById")
+	defer span.End()
+
+	result, err := storage.db.ExecContext(storage.context(), "DELETE FROM book_reviews WHERE id = $1", id)
 	if err != nil {
 		return err
 	}
@@ -362,14 +885,20 @@ func (storage *PostgresqlStorage) DeleteBookReviewById(id int) error {
 }
 
 type UpdateBookReviewDto struct {
-	Score     int       `json:"score" db:"score" validate:"nonzero"`
-	Review    string    `json:"review" db:"review" validate:"nonzero"`
+	Score     float64   `json:"score" db:"score" validate:"stars"`
+	Review    string    `json:"review" db:"review"`
+	Spoiler   bool      `json:"spoiler" db:"spoiler"`
 	UpdatedAt time.Time `db:"updated_at"`
+	// The user making the edit, kept with the version it replaces
+	EditorID int `json:"-" db:"editor_id"`
 }
 
 func (storage *PostgresqlStorage) UpdateBookReview(id int, updateBookReviewDto UpdateBookReviewDto) (*BookReview, error) {
+	storage, span := storage.startSpan("UpdateBookReview")
+	defer span.End()
+
 	updateBookReviewDto.UpdatedAt = time.Now()
-	result, err := storage.db.NamedExec(fmt.Sprintf("UPDATE book_reviews SET score = :score, review = :review, updated_at = :updated_at WHERE id = %d", id), updateBookReviewDto)
+	result, err := storage.db.NamedExecContext(storage.context(), keepRevision(fmt.Sprintf("id = %d", id), ":score", ":review", ":spoiler", ":editor_id")+fmt.Sprintf("UPDATE book_reviews SET score = :score, review = NULLIF(:review, ''), spoiler = :spoiler, updated_at = :updated_at WHERE id = %d", id), updateBookReviewDto)
 	if err != nil {
 		return nil, err
 	}
@@ -386,7 +915,7 @@ func (storage *PostgresqlStorage) UpdateBookReview(id int, updateBookReviewDto U
 	}
 
 	var bookReview *BookReview = &BookReview{}
-	if err := storage.db.Get(bookReview, "SELECT * FROM book_reviews WHERE id = $1", id); err != nil {
+	if err := storage.db.GetContext(storage.context(), bookReview, "SELECT "+bookReviewColumns+" FROM book_reviews WHERE id = $1", id); err != nil {
 		return nil, err
 	}
 
@@ -394,6 +923,9 @@ func (storage *PostgresqlStorage) UpdateBookReview(id int, updateBookReviewDto U
 }
 
 func (storage *PostgresqlStorage) GetBookReviewsByBookId(id int, r *http.Request) ([]*BookReview, error) {
+	storage, span := storage.startSpan("GetBookReviewsByBookId")
+	defer span.End()
+
 	book, err := storage.GetBookById(id)
 	if err != nil {
 		return nil, err
@@ -405,7 +937,17 @@ func (storage *PostgresqlStorage) GetBookReviewsByBookId(id int, r *http.Request
 		}
 	}
 
-	query := fmt.Sprintf("SELECT * from book_reviews WHERE book_id = %d", id)
+	// Reviews of every edition of the book's work are shown unless only this edition is asked for
+	query := fmt.Sprintf("SELECT "+bookReviewColumns+" FROM book_reviews WHERE book_id IN (SELECT id FROM books WHERE work_id = %d)", book.WorkID)
+	if r.URL.Query().Get("edition_only") == "true" {
+		query = fmt.Sprintf("SELECT "+bookReviewColumns+" FROM book_reviews WHERE book_id = %d", id)
+	}
+
+	// Ratings without text are left out when only written reviews are asked for
+	if r.URL.Query().Get("written_only") == "true" {
+		query += " AND review IS NOT NULL"
+	}
+
 	bookReviews, err := GetLazyPaginatedResponsePG[BookReview](storage, r, query)
 	if err != nil {
 		return nil, err
@@ -415,12 +957,36 @@ func (storage *PostgresqlStorage) GetBookReviewsByBookId(id int, r *http.Request
 }
 
 func (storage *PostgresqlStorage) UpdateUserProfileImageUrl(id int, objectKey string) error {
-	_, err := storage.db.Exec("UPDATE users SET profile_image_url = $1 WHERE id = $2", objectKey, id)
+	storage, span := storage.startSpan("UpdateUserProfileImageUrl")
+	defer span.End()
+
+	// An empty key removes the profile image
+	_, err := storage.db.ExecContext(storage.context(), "UPDATE users SET profile_image_url = NULLIF($1, '') WHERE id = $2", objectKey, id)
 	return err
 }
 
-func NewPostgresStorage() (*PostgresqlStorage, error) {
-	dbUrl := os.Getenv("DB_URL")
+// Tables rebuilt by Reindex
+var maintainedTables = []string{"roles", "users", "books", "book_reviews", "authors", "book_authors", "works", "series", "series_works", "genres", "book_genres", "book_tags", "shelf_entries", "book_field_sources", "review_likes", "review_comments", "review_revisions"}
+
+// Reindex rebuilds the indexes of the application tables and refreshes their planner statistics
+func (storage *PostgresqlStorage) Reindex() error {
+	storage, span := storage.startSpan("Reindex")
+	defer span.End()
+
+	for _, table := range maintainedTables {
+		if _, err := storage.db.ExecContext(storage.context(), fmt.Sprintf("REINDEX TABLE %s", table)); err != nil {
+			return err
+		}
+
+		if _, err := storage.db.ExecContext(storage.context(), fmt.Sprintf("ANALYZE %s", table)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func NewPostgresStorage(dbUrl string) (*PostgresqlStorage, error) {
 	db, err := sqlx.Open("postgres", dbUrl)
 	if err != nil {
 		return nil, err
@@ -431,7 +997,43 @@ func NewPostgresStorage() (*PostgresqlStorage, error) {
 	}, nil
 }
 
+// Ping verifies that the database is reachable
+func (storage *PostgresqlStorage) Ping(ctx context.Context) error {
+	return storage.db.PingContext(ctx)
+}
+
+// WaitForConnection pings the database until it responds, giving up after the given number of retries
+func (storage *PostgresqlStorage) WaitForConnection(ctx context.Context, retries int, interval time.Duration) error {
+	var err error
+	for attempt := 0; attempt <= retries; attempt++ {
+		if err = storage.Ping(ctx); err == nil {
+			return nil
+		}
+
+		if attempt == retries {
+			break
+		}
+
+		logging.FromContext(ctx).Warn("database is unreachable, retrying",
+			"attempt", attempt+1, "retries", retries, "interval", interval.String(), "error", err)
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(interval):
+		}
+	}
+
+	return fmt.Errorf("database is unreachable after %d retries: %w", retries, err)
+}
+
+// Stats returns the connection pool statistics of the underlying database
+func (storage *PostgresqlStorage) Stats() sql.DBStats {
+	return storage.db.Stats()
+}
+
+// GetPgStorageFromRequest returns the storage bound to the request's context
 func GetPgStorageFromRequest(r *http.Request) (*PostgresqlStorage, error) {
 	db := r.Context().Value(DBContextKey).(*PostgresqlStorage)
-	return db, nil
+	return db.WithContext(r.Context()), nil
 }
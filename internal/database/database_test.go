@@ -1,9 +1,14 @@
 package database
 
 import (
+	"database/sql"
+	"errors"
+	"os"
 	"testing"
+	"time"
 
 	"github.com/joho/godotenv"
+	"gopkg.in/validator.v2"
 )
 
 func TestPostgresStorage(t *testing.T) {
@@ -11,7 +16,7 @@ func TestPostgresStorage(t *testing.T) {
 	var storage Storage
 
 	// Test with storage of choice
-	storage, err := NewPostgresStorage()
+	storage, err := NewPostgresStorage(os.Getenv("DB_URL"))
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -23,6 +28,36 @@ func TestPostgresStorage(t *testing.T) {
 		Password:  "pass",
 	}
 
+	// Users and books of the review tests, deleted again when the subtest ends
+	fixtureSuffix := time.Now().Format("150405.000000")
+	createTestUser := func(t *testing.T, name string) *User {
+		user, err := storage.CreateUser(name, "TestLastName", name+fixtureSuffix+"@mail.com", "pass")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		t.Cleanup(func() { storage.DeleteUserById(user.ID) })
+		return user
+	}
+
+	createTestBook := func(t *testing.T, title string) *Book {
+		book, err := storage.CreateBook(&CreateBookDto{
+			Title: title, Author: "Test Author", Genre: "Test Genre", PublicationDate: time.Now(),
+			Publisher: "Test Publisher", ISBN: title + fixtureSuffix, PageCount: "100", Language: "en", Format: "paperback",
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		t.Cleanup(func() { storage.(*PostgresqlStorage).DeleteBookById(book.ID) })
+		return book
+	}
+
+	// Reviews reference their user and book, so they are deleted before them
+	cleanupReview := func(t *testing.T, review *BookReview) {
+		t.Cleanup(func() { storage.DeleteBookReviewById(review.ID) })
+	}
+
 	t.Run("TestCreateUserWithValidInputsAndDelete", func(t *testing.T) {
 		// Create a user
 		user, err := storage.CreateUser(createUserPayload.FirstName, createUserPayload.LastName, createUserPayload.Email, createUserPayload.Password)
@@ -64,4 +99,219 @@ func TestPostgresStorage(t *testing.T) {
 			t.Error(err)
 		}
 	})
+
+	t.Run("TestMergeAndSplitWorksKeepSeries", func(t *testing.T) {
+		pgStorage := storage.(*PostgresqlStorage)
+		suffix := time.Now().Format("150405.000000")
+		createBook := func(title string, workId int) *Book {
+			book, err := storage.CreateBook(&CreateBookDto{
+				WorkID: workId, Title: title, Author: "Test Author", Genre: "Test Genre", PublicationDate: time.Now(),
+				Publisher: "Test Publisher", ISBN: title + suffix, PageCount: "100", Language: "en", Format: "paperback",
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			t.Cleanup(func() { pgStorage.DeleteBookById(book.ID) })
+			return book
+		}
+
+		first := createBook("TestFirst", 0)
+		second := createBook("TestSecond", first.WorkID)
+		other := createBook("TestOther", 0)
+
+		series, err := storage.CreateSeries(&SeriesDto{Name: "Test Series"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { storage.DeleteSeriesById(series.ID) })
+
+		if _, err := storage.SetSeriesWork(series.ID, other.WorkID, 2); err != nil {
+			t.Fatal(err)
+		}
+
+		positionOf := func(workId int) float64 {
+			series, err := storage.GetSeriesById(series.ID)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			for _, entry := range series.Entries {
+				if entry.WorkID == workId {
+					return entry.Position
+				}
+			}
+
+			return -1
+		}
+
+		if _, err := storage.MergeWorks(first.WorkID, []int{other.WorkID}); err != nil {
+			t.Fatal(err)
+		}
+
+		if position := positionOf(first.WorkID); position != 2 {
+			t.Errorf("Expected the merged work to take the place of the source in the series, got %v", position)
+		}
+
+		split, err := storage.SplitWork(first.WorkID, []int{second.ID})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if position := positionOf(split.ID); position != 2 {
+			t.Errorf("Expected the split work to keep the place of the original in the series, got %v", position)
+		}
+	})
+
+	t.Run("TestCreateBookRejectsDuplicateISBNs", func(t *testing.T) {
+		book := createTestBook(t, "TestISBN")
+
+		_, err := storage.CreateBook(&CreateBookDto{
+			Title: "TestISBNCopy", Author: "Test Author", Genre: "Test Genre", PublicationDate: time.Now(),
+			Publisher: "Test Publisher", ISBN: " " + book.ISBN, PageCount: "100", Language: "en", Format: "paperback",
+		})
+		if !errors.Is(err, ErrDuplicateISBN) {
+			t.Errorf("Expected ErrDuplicateISBN for the ISBN of an existing book, got %v", err)
+		}
+	})
+
+	t.Run("TestCreateAndUpsertBookReviews", func(t *testing.T) {
+		user := createTestUser(t, "TestReviewer")
+		book := createTestBook(t, "TestReviewed")
+
+		// POST /book_reviews answers 404 for a missing book and 409 for a second review of the same book
+		if _, err := storage.CreateBookReview(&CreateBookReviewDto{BookID: -1, UserID: user.ID, Score: 4}); !errors.Is(err, sql.ErrNoRows) {
+			t.Errorf("Expected sql.ErrNoRows for a missing book, got %v", err)
+		}
+
+		review, err := storage.CreateBookReview(&CreateBookReviewDto{BookID: book.ID, UserID: user.ID, Score: 4, Review: "Good"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		cleanupReview(t, review)
+
+		if _, err := storage.CreateBookReview(&CreateBookReviewDto{BookID: book.ID, UserID: user.ID, Score: 2}); !errors.Is(err, ErrDuplicateReview) {
+			t.Errorf("Expected ErrDuplicateReview for a second review, got %v", err)
+		}
+
+		// GET /books/:id/reviews/mine answers 404 for users who did not review the book
+		mine, err := storage.GetUserBookReview(user.ID, book.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if mine.ID != review.ID || mine.Score != 4 || mine.Review != "Good" {
+			t.Errorf("Expected the review of the user, got %+v", mine)
+		}
+
+		other := createTestUser(t, "TestOtherReviewer")
+		if _, err := storage.GetUserBookReview(other.ID, book.ID); !errors.Is(err, sql.ErrNoRows) {
+			t.Errorf("Expected sql.ErrNoRows without a review, got %v", err)
+		}
+
+		// PUT /books/:id/reviews/mine answers 404 for a missing book, 201 for a new review and 200 for a replaced one
+		if _, _, err := storage.UpsertBookReview(&CreateBookReviewDto{BookID: -1, UserID: other.ID, Score: 3}); !errors.Is(err, sql.ErrNoRows) {
+			t.Errorf("Expected sql.ErrNoRows for a missing book, got %v", err)
+		}
+
+		upserted, created, err := storage.UpsertBookReview(&CreateBookReviewDto{BookID: book.ID, UserID: other.ID, Score: 3, Review: "Fine"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		cleanupReview(t, upserted)
+
+		if !created {
+			t.Error("Expected the first upsert to create the review")
+		}
+
+		replaced, created, err := storage.UpsertBookReview(&CreateBookReviewDto{BookID: book.ID, UserID: other.ID, Score: 5, Review: "Great"})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if created || replaced.ID != upserted.ID || replaced.Score != 5 || replaced.Review != "Great" {
+			t.Errorf("Expected the second upsert to replace the review, got created %v and %+v", created, replaced)
+		}
+	})
+
+	t.Run("TestReviewRevisions", func(t *testing.T) {
+		user := createTestUser(t, "TestRevisedReviewer")
+		editor := createTestUser(t, "TestReviewEditor")
+		book := createTestBook(t, "TestRevised")
+
+		review, _, err := storage.UpsertBookReview(&CreateBookReviewDto{BookID: book.ID, UserID: user.ID, Score: 4, Review: "Good"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		cleanupReview(t, review)
+
+		if review.Edited {
+			t.Error("Expected a new review not to be edited")
+		}
+
+		revisionsOf := func() []*ReviewRevision {
+			revisions, err := storage.GetReviewRevisions(review.ID)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			return revisions
+		}
+
+		// Saving the same review again is not an edit
+		unchanged, _, err := storage.UpsertBookReview(&CreateBookReviewDto{BookID: book.ID, UserID: user.ID, Score: 4, Review: "Good"})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if revisions := revisionsOf(); len(revisions) != 0 || unchanged.Edited {
+			t.Errorf("Expected no revision for an unchanged review, got %d and edited %v", len(revisions), unchanged.Edited)
+		}
+
+		updated, err := storage.UpdateBookReview(review.ID, UpdateBookReviewDto{Score: 3, Review: "Changed", EditorID: editor.ID})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !updated.Edited {
+			t.Error("Expected the review to be edited after a change")
+		}
+
+		revisions := revisionsOf()
+		if len(revisions) != 1 {
+			t.Fatalf("Expected one revision, got %d", len(revisions))
+		}
+
+		revision := revisions[0]
+		if revision.Score != 4 || revision.Review != "Good" || revision.Spoiler {
+			t.Errorf("Expected the replaced version, got %+v", revision)
+		}
+
+		if revision.EditedBy == nil || *revision.EditedBy != editor.ID {
+			t.Errorf("Expected the edit to be credited to user %d, got %v", editor.ID, revision.EditedBy)
+		}
+
+		if !revision.WrittenAt.Equal(unchanged.UpdatedAt) {
+			t.Errorf("Expected the replaced version to be written at %v, got %v", unchanged.UpdatedAt, revision.WrittenAt)
+		}
+	})
+}
+
+func TestValidateStars(t *testing.T) {
+	for _, rating := range []float64{1, 1.5, 3, 4.5, 5} {
+		if err := validateStars(rating, ""); err != nil {
+			t.Errorf("Expected %v to be a rating, got %v", rating, err)
+		}
+	}
+
+	for _, rating := range []float64{0, 0.5, 2.25, 5.5, -1} {
+		if err := validateStars(rating, ""); err == nil {
+			t.Errorf("Expected %v not to be a rating", rating)
+		}
+	}
+
+	dto := &CreateBookReviewDto{BookID: 1, Score: 3.5}
+	if err := validator.Validate(dto); err != nil {
+		t.Errorf("Expected a rating without text to be valid, got %v", err)
+	}
 }
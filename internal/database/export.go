@@ -0,0 +1,110 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// Tables a data export can contain
+const (
+	ExportBooks   = "books"
+	ExportReviews = "reviews"
+	ExportUsers   = "users"
+)
+
+// ExportTables lists the exportable tables in the order a full export writes them
+var ExportTables = []string{ExportBooks, ExportReviews, ExportUsers}
+
+// Rows fetched from the export cursor per round trip
+const exportFetchSize = 1000
+
+// exportQueries select every row of an exported table, users without their password hash
+var exportQueries = map[string]struct {
+	query string
+	model func() any
+}{
+	ExportBooks:   {query: "SELECT " + bookColumns + " FROM books ORDER BY id", model: func() any { return &Book{} }},
+	ExportReviews: {query: "SELECT " + bookReviewColumns + " FROM book_reviews ORDER BY id", model: func() any { return &BookReview{} }},
+	ExportUsers:   {query: "SELECT " + userColumns + " FROM users ORDER BY id", model: func() any { return &User{} }},
+}
+
+// ExportSink receives the rows of an export, table by table
+type ExportSink interface {
+	// BeginTable is called before the rows of every table, with an empty row of the table's model
+	BeginTable(table string, model any) error
+	WriteRow(row any) error
+}
+
+// Export streams the tables to the sink from a single repeatable read snapshot, so rows of different tables agree with each other.
+// Every table is read through a server-side cursor, only a batch of rows is held in memory at a time.
+func (storage *PostgresqlStorage) Export(tables []string, sink ExportSink) error {
+	storage, span := storage.startSpan("Export")
+	defer span.End()
+
+	for _, table := range tables {
+		if _, ok := exportQueries[table]; !ok {
+			return fmt.Errorf("unknown export table %q", table)
+		}
+	}
+
+	ctx := storage.context()
+	tx, err := storage.db.BeginTxx(ctx, &sql.TxOptions{Isolation: sql.LevelRepeatableRead, ReadOnly: true})
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, table := range tables {
+		export := exportQueries[table]
+		if err := sink.BeginTable(table, export.model()); err != nil {
+			return err
+		}
+
+		if _, err := tx.ExecContext(ctx, "DECLARE export_cursor NO SCROLL CURSOR FOR "+export.query); err != nil {
+			return err
+		}
+
+		count := 0
+		for {
+			rows, err := tx.QueryxContext(ctx, fmt.Sprintf("FETCH FORWARD %d FROM export_cursor", exportFetchSize))
+			if err != nil {
+				return err
+			}
+
+			fetched := 0
+			for rows.Next() {
+				row := export.model()
+				if err := rows.StructScan(row); err != nil {
+					rows.Close()
+					return err
+				}
+
+				if err := sink.WriteRow(row); err != nil {
+					rows.Close()
+					return err
+				}
+				fetched++
+			}
+			rows.Close()
+
+			if err := rows.Err(); err != nil {
+				return err
+			}
+
+			count += fetched
+			if fetched < exportFetchSize {
+				break
+			}
+		}
+
+		if _, err := tx.ExecContext(ctx, "CLOSE export_cursor"); err != nil {
+			return err
+		}
+
+		span.SetAttributes(attribute.Int("db.export."+table, count))
+	}
+
+	return tx.Commit()
+}
@@ -0,0 +1,406 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/kaanserin/go-reads/internal/utils"
+	"github.com/lib/pq"
+)
+
+type Genre struct {
+	ID        int       `json:"id" db:"id"`
+	Name      string    `json:"name" db:"name"`
+	Slug      string    `json:"slug" db:"slug"`
+	ParentID  *int      `json:"parent_id" db:"parent_id"`
+	CreatedAt time.Time `json:"created_at" db:"created_at"`
+
+	// Sub genres, only filled in when the taxonomy is returned as a tree
+	Children []*Genre `json:"children,omitempty" db:"-"`
+}
+
+const genreColumns = "id, name, slug, parent_id, created_at"
+
+// genreSlugSQL derives the slug of a genre name in SQL the same way the genres package does in Go
+func genreSlugSQL(expression string) string {
+	return fmt.Sprintf("trim(BOTH '-' FROM regexp_replace(lower(trim(%s)), '[^a-z0-9]+', '-', 'g'))", expression)
+}
+
+// BookGenre is one of the genres of a book
+type BookGenre struct {
+	BookID int    `json:"-" db:"book_id"`
+	ID     int    `json:"id" db:"id"`
+	Name   string `json:"name" db:"name"`
+	Slug   string `json:"slug" db:"slug"`
+}
+
+// TagCount is how many readers tagged a book with a tag
+type TagCount struct {
+	Tag   string `json:"tag" db:"tag"`
+	Count int    `json:"count" db:"count"`
+}
+
+// GetGenres returns the whole taxonomy ordered by name, parents are not guaranteed to come before their children
+func (storage *PostgresqlStorage) GetGenres() ([]*Genre, error) {
+	storage, span := storage.startSpan("GetGenres")
+	defer span.End()
+
+	genres := make([]*Genre, 0)
+	if err := storage.db.SelectContext(storage.context(), &genres, "SELECT "+genreColumns+" FROM genres ORDER BY name"); err != nil {
+		return nil, err
+	}
+
+	return genres, nil
+}
+
+func (storage *PostgresqlStorage) GetGenreBySlug(slug string) (*Genre, error) {
+	storage, span := storage.startSpan("GetGenreBySlug")
+	defer span.End()
+
+	var genre *Genre = &Genre{}
+	if err := storage.db.GetContext(storage.context(), genre, "SELECT "+genreColumns+" FROM genres WHERE slug = $1", slug); err != nil {
+		return nil, err
+	}
+
+	genre.Children = make([]*Genre, 0)
+	err := storage.db.SelectContext(storage.context(), &genre.Children, "SELECT "+genreColumns+" FROM genres WHERE parent_id = $1 ORDER BY name", genre.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	return genre, nil
+}
+
+// GetGenreAncestors returns the path from the top level genre down to the parent of the genre
+func (storage *PostgresqlStorage) GetGenreAncestors(id int) ([]*Genre, error) {
+	storage, span := storage.startSpan("GetGenreAncestors")
+	defer span.End()
+
+	ancestors := make([]*Genre, 0)
+	err := storage.db.SelectContext(storage.context(), &ancestors, `WITH RECURSIVE ancestors AS (
+		SELECT parent_id, 1 AS depth FROM genres WHERE id = $1
+		UNION ALL
+		SELECT genres.parent_id, ancestors.depth + 1 FROM genres JOIN ancestors ON genres.id = ancestors.parent_id
+	)
+	SELECT genres.id, genres.name, genres.slug, genres.parent_id, genres.created_at
+	FROM ancestors JOIN genres ON genres.id = ancestors.parent_id
+	ORDER BY ancestors.depth DESC`, id)
+	if err != nil {
+		return nil, err
+	}
+
+	return ancestors, nil
+}
+
+type GenreDto struct {
+	Name     string `json:"name" validate:"nonzero,max=100"`
+	Slug     string `json:"slug" validate:"max=100"`
+	ParentID *int   `json:"parent_id"`
+}
+
+func (storage *PostgresqlStorage) CreateGenre(genreDto *GenreDto) (*Genre, error) {
+	storage, span := storage.startSpan("CreateGenre")
+	defer span.End()
+
+	_, err := storage.db.ExecContext(storage.context(), "INSERT INTO genres (name, slug, parent_id) VALUES ($1, $2, $3)",
+		genreDto.Name, genreDto.Slug, genreDto.ParentID)
+	if err := genreWriteError(err, genreDto); err != nil {
+		return nil, err
+	}
+
+	return storage.GetGenreBySlug(genreDto.Slug)
+}
+
+// UpdateGenreBySlug renames or moves a genre, a genre can not be moved below itself or one of its sub genres
+func (storage *PostgresqlStorage) UpdateGenreBySlug(slug string, genreDto *GenreDto) (*Genre, error) {
+	storage, span := storage.startSpan("UpdateGenreBySlug")
+	defer span.End()
+
+	result, err := storage.db.ExecContext(storage.context(), `UPDATE genres SET name = $1, slug = $2, parent_id = $3
+	WHERE slug = $4 AND NOT EXISTS (
+		WITH RECURSIVE ancestors AS (
+			SELECT id, parent_id FROM genres WHERE id = $3
+			UNION ALL
+			SELECT genres.id, genres.parent_id FROM genres JOIN ancestors ON genres.id = ancestors.parent_id
+		)
+		SELECT 1 FROM ancestors JOIN genres AS moved ON moved.id = ancestors.id WHERE moved.slug = $4
+	)`, genreDto.Name, genreDto.Slug, genreDto.ParentID, slug)
+	if err := genreWriteError(err, genreDto); err != nil {
+		return nil, err
+	}
+
+	affectedRows, err := result.RowsAffected()
+	if err != nil {
+		return nil, err
+	}
+
+	if affectedRows == 0 {
+		if _, err := storage.GetGenreBySlug(slug); err != nil {
+			return nil, err
+		}
+
+		return nil, &utils.CustomError{
+			Message: "A genre can not be moved below itself or one of its sub genres",
+		}
+	}
+
+	return storage.GetGenreBySlug(genreDto.Slug)
+}
+
+// genreWriteError turns constraint violations of a genre insert or update into messages for the client
+func genreWriteError(err error, genreDto *GenreDto) error {
+	var pqErr *pq.Error
+	if !errors.As(err, &pqErr) {
+		return err
+	}
+
+	switch pqErr.Code.Name() {
+	case "unique_violation":
+		return &utils.CustomError{
+			Message: fmt.Sprintf("A genre with the slug %s already exists", genreDto.Slug),
+		}
+	case "foreign_key_violation":
+		return &utils.CustomError{
+			Message: fmt.Sprintf("No parent genre found for the given id %d", *genreDto.ParentID),
+		}
+	}
+
+	return err
+}
+
+// DeleteGenreBySlug removes a genre without sub genres, books keep their other genres
+func (storage *PostgresqlStorage) DeleteGenreBySlug(slug string) error {
+	storage, span := storage.startSpan("DeleteGenreBySlug")
+	defer span.End()
+
+	result, err := storage.db.ExecContext(storage.context(), "DELETE FROM genres WHERE slug = $1", slug)
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) && pqErr.Code.Name() == "foreign_key_violation" {
+		return &utils.CustomError{
+			Message: "Genres with sub genres can not be deleted",
+		}
+	} else if err != nil {
+		return err
+	}
+
+	affectedRows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if affectedRows == 0 {
+		return sql.ErrNoRows
+	}
+
+	return nil
+}
+
+// GetBooksByGenreId returns a page of the books in the genre or any of its sub genres
+func (storage *PostgresqlStorage) GetBooksByGenreId(id int, r *http.Request) ([]*Book, error) {
+	storage, span := storage.startSpan("GetBooksByGenreId")
+	defer span.End()
+
+	query := fmt.Sprintf(`SELECT %s FROM books WHERE id IN (
+		WITH RECURSIVE descendants AS (
+			SELECT id FROM genres WHERE id = %d
+			UNION ALL
+			SELECT genres.id FROM genres JOIN descendants ON genres.parent_id = descendants.id
+		)
+		SELECT book_id FROM book_genres WHERE genre_id IN (SELECT id FROM descendants)
+	)`, bookColumns, id)
+	books, err := GetLazyPaginatedResponsePG[Book](storage, r, query)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := storage.loadBookRelations(books); err != nil {
+		return nil, err
+	}
+
+	return books, nil
+}
+
+// SetBookGenres replaces the genres of a book in the given order.
+// books.genre is kept as the name of the first genre for older clients.
+func (storage *PostgresqlStorage) SetBookGenres(bookId int, genreIds []int) (*Book, error) {
+	storage, span := storage.startSpan("SetBookGenres")
+	defer span.End()
+
+	tx, err := storage.db.BeginTxx(storage.context(), nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var exists bool
+	if err := tx.GetContext(storage.context(), &exists, "SELECT EXISTS (SELECT 1 FROM books WHERE id = $1)", bookId); err != nil {
+		return nil, err
+	}
+
+	if !exists {
+		return nil, &utils.CustomError{
+			Message: fmt.Sprintf("No book found for the given id %d", bookId),
+		}
+	}
+
+	if _, err := tx.ExecContext(storage.context(), "DELETE FROM book_genres WHERE book_id = $1", bookId); err != nil {
+		return nil, err
+	}
+
+	for position, genreId := range genreIds {
+		var name string
+		err := tx.GetContext(storage.context(), &name, "SELECT name FROM genres WHERE id = $1", genreId)
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, &utils.CustomError{
+				Message: fmt.Sprintf("No genre found for the given id %d", genreId),
+			}
+		} else if err != nil {
+			return nil, err
+		}
+
+		if _, err := tx.ExecContext(storage.context(), "INSERT INTO book_genres (book_id, genre_id, position) VALUES ($1, $2, $3)",
+			bookId, genreId, position); err != nil {
+			return nil, err
+		}
+
+		if position == 0 {
+			if _, err := tx.ExecContext(storage.context(), "UPDATE books SET genre = left($1, 50) WHERE id = $2", name, bookId); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	edited := []string{BookFieldGenres}
+	if len(genreIds) > 0 {
+		edited = append(edited, "genre")
+	}
+
+	if err := storage.markBookFieldsManual(tx, bookId, edited...); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return storage.GetBookById(bookId)
+}
+
+// linkGenreByName files a book under the genre with the given name, creating a top level genre when there is none
+func (storage *PostgresqlStorage) linkGenreByName(execer sqlx.ExecerContext, bookId int, name string) error {
+	slug := genreSlugSQL("$2::text")
+	_, err := execer.ExecContext(storage.context(), fmt.Sprintf(`WITH created AS (
+		INSERT INTO genres (name, slug) SELECT trim($2::text), %[1]s WHERE %[1]s <> ''
+		ON CONFLICT (slug) DO NOTHING RETURNING id
+	)
+	INSERT INTO book_genres (book_id, genre_id)
+	SELECT $1, id FROM (
+		SELECT id FROM created UNION ALL SELECT id FROM genres WHERE slug = %[1]s
+	) AS genre LIMIT 1
+	ON CONFLICT DO NOTHING`, slug), bookId, name)
+	return err
+}
+
+// loadBookGenres fills in the genres of every book with a single query
+func (storage *PostgresqlStorage) loadBookGenres(books []*Book) error {
+	if len(books) == 0 {
+		return nil
+	}
+
+	ids := make([]int64, 0, len(books))
+	byId := make(map[int]*Book, len(books))
+	for _, book := range books {
+		ids = append(ids, int64(book.ID))
+		byId[book.ID] = book
+	}
+
+	bookGenres := make([]*BookGenre, 0)
+	err := storage.db.SelectContext(storage.context(), &bookGenres, `SELECT book_genres.book_id, genres.id, genres.name, genres.slug
+	FROM book_genres JOIN genres ON genres.id = book_genres.genre_id
+	WHERE book_genres.book_id = ANY($1)
+	ORDER BY book_genres.book_id, book_genres.position, genres.name`, pq.Array(ids))
+	if err != nil {
+		return err
+	}
+
+	for _, bookGenre := range bookGenres {
+		if book, ok := byId[bookGenre.BookID]; ok {
+			book.Genres = append(book.Genres, bookGenre)
+		}
+	}
+
+	return nil
+}
+
+// AddBookTag tags a book for a user, tagging a book twice with the same tag is a no-op
+func (storage *PostgresqlStorage) AddBookTag(bookId int, userId int, tag string) error {
+	storage, span := storage.startSpan("AddBookTag")
+	defer span.End()
+
+	_, err := storage.db.ExecContext(storage.context(),
+		"INSERT INTO book_tags (book_id, user_id, tag) VALUES ($1, $2, $3) ON CONFLICT DO NOTHING", bookId, userId, tag)
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) && pqErr.Code.Name() == "foreign_key_violation" {
+		return &utils.CustomError{
+			Message: fmt.Sprintf("No book found for the given id %d", bookId),
+		}
+	}
+
+	return err
+}
+
+func (storage *PostgresqlStorage) RemoveBookTag(bookId int, userId int, tag string) error {
+	storage, span := storage.startSpan("RemoveBookTag")
+	defer span.End()
+
+	result, err := storage.db.ExecContext(storage.context(),
+		"DELETE FROM book_tags WHERE book_id = $1 AND user_id = $2 AND tag = $3", bookId, userId, tag)
+	if err != nil {
+		return err
+	}
+
+	affectedRows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if affectedRows == 0 {
+		return sql.ErrNoRows
+	}
+
+	return nil
+}
+
+// GetBookTopTags returns the tags most readers put on the book
+func (storage *PostgresqlStorage) GetBookTopTags(bookId int, limit int) ([]*TagCount, error) {
+	storage, span := storage.startSpan("GetBookTopTags")
+	defer span.End()
+
+	tags := make([]*TagCount, 0)
+	err := storage.db.SelectContext(storage.context(), &tags, `SELECT tag, count(*) AS count FROM book_tags
+	WHERE book_id = $1 GROUP BY tag ORDER BY count DESC, tag LIMIT $2`, bookId, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	return tags, nil
+}
+
+// GetUserBookTags returns the tags the user put on the book
+func (storage *PostgresqlStorage) GetUserBookTags(bookId int, userId int) ([]string, error) {
+	storage, span := storage.startSpan("GetUserBookTags")
+	defer span.End()
+
+	tags := make([]string, 0)
+	err := storage.db.SelectContext(storage.context(), &tags,
+		"SELECT tag FROM book_tags WHERE book_id = $1 AND user_id = $2 ORDER BY tag", bookId, userId)
+	if err != nil {
+		return nil, err
+	}
+
+	return tags, nil
+}
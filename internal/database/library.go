@@ -0,0 +1,213 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+)
+
+// Reading status shelves, a book is on at most one of them per user
+const (
+	ShelfRead             = "read"
+	ShelfCurrentlyReading = "currently-reading"
+	ShelfToRead           = "to-read"
+)
+
+var StatusShelves = []string{ShelfRead, ShelfCurrentlyReading, ShelfToRead}
+
+// LibraryEntry is a book in the library of a user, everything they shelved or reviewed
+type LibraryEntry struct {
+	BookID int `json:"book_id" db:"book_id"`
+	// Reading status shelf, empty for books that were only reviewed
+	Status string `json:"status" db:"status"`
+	// Shelves of the user besides the reading status
+	Shelves pq.StringArray `json:"shelves" db:"shelves"`
+	Rating  float64        `json:"rating" db:"rating"`
+	Review  string         `json:"review" db:"review"`
+	// The review as a whole gives the plot away
+	Spoiler   bool       `json:"spoiler" db:"spoiler"`
+	DateAdded time.Time  `json:"date_added" db:"date_added"`
+	DateRead  *time.Time `json:"date_read" db:"date_read"`
+
+	// Filled in for exports
+	AverageRating           float64    `json:"-" db:"average_rating"`
+	OriginalPublicationDate *time.Time `json:"-" db:"original_publication_date"`
+	Book                    *Book      `json:"-" db:"-"`
+}
+
+// LibraryImportRow is a library entry of another catalog, matched against our books by ISBN or else by title and author
+type LibraryImportRow struct {
+	Line  int
+	ISBNs []string
+	// Candidate titles, lowercase
+	Titles []string
+	Author string
+	Entry  *LibraryEntry
+}
+
+// LibraryImportResult is the book a row was matched to, BookID is 0 for unmatched rows
+type LibraryImportResult struct {
+	Line   int
+	BookID int
+}
+
+// ImportLibrary adds the matched rows to the library of the user in one transaction.
+// The reading status of a book is replaced, shelves are added to the existing ones and a rating updates the review of the user.
+// Unmatched rows are returned with a zero BookID and leave no trace.
+func (storage *PostgresqlStorage) ImportLibrary(userId int, rows []*LibraryImportRow) ([]*LibraryImportResult, error) {
+	storage, span := storage.startSpan("ImportLibrary")
+	defer span.End()
+
+	ctx := storage.context()
+	tx, err := storage.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	results := make([]*LibraryImportResult, 0, len(rows))
+	for _, row := range rows {
+		bookId, err := storage.matchLibraryBook(tx, row)
+		if err != nil {
+			return nil, err
+		}
+
+		results = append(results, &LibraryImportResult{Line: row.Line, BookID: bookId})
+		if bookId == 0 {
+			continue
+		}
+
+		if err := storage.importLibraryEntry(tx, userId, bookId, row.Entry); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return results, nil
+}
+
+func (storage *PostgresqlStorage) matchLibraryBook(tx *sqlx.Tx, row *LibraryImportRow) (int, error) {
+	ctx := storage.context()
+
+	var bookId int
+	err := tx.GetContext(ctx, &bookId, "SELECT min(id) FROM books WHERE translate(isbn, '- ', '') = ANY($1) HAVING count(*) > 0", pq.Array(row.ISBNs))
+	if err == nil || !errors.Is(err, sql.ErrNoRows) {
+		return bookId, err
+	}
+
+	err = tx.GetContext(ctx, &bookId, `SELECT min(books.id) FROM books
+	WHERE lower(books.title) = ANY($1) AND (lower(books.author) = lower($2) OR EXISTS (
+		SELECT 1 FROM book_authors JOIN authors ON authors.id = book_authors.author_id
+		WHERE book_authors.book_id = books.id AND lower(authors.name) = lower($2)
+	))
+	HAVING count(*) > 0`, pq.Array(row.Titles), row.Author)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, nil
+	}
+
+	return bookId, err
+}
+
+func (storage *PostgresqlStorage) importLibraryEntry(tx *sqlx.Tx, userId int, bookId int, entry *LibraryEntry) error {
+	ctx := storage.context()
+
+	if entry.Status != "" {
+		_, err := tx.ExecContext(ctx, "DELETE FROM shelf_entries WHERE user_id = $1 AND book_id = $2 AND shelf = ANY($3) AND shelf <> $4",
+			userId, bookId, pq.Array(StatusShelves), entry.Status)
+		if err != nil {
+			return err
+		}
+	}
+
+	shelves := append([]string{}, entry.Shelves...)
+	if entry.Status != "" {
+		shelves = append(shelves, entry.Status)
+	}
+
+	for _, shelf := range shelves {
+		var readAt *time.Time
+		if shelf == ShelfRead {
+			readAt = entry.DateRead
+		}
+
+		_, err := tx.ExecContext(ctx, `INSERT INTO shelf_entries (user_id, book_id, shelf, added_at, read_at) VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT (user_id, book_id, shelf) DO UPDATE SET added_at = EXCLUDED.added_at, read_at = COALESCE(EXCLUDED.read_at, shelf_entries.read_at)`,
+			userId, bookId, shelf, entry.DateAdded, readAt)
+		if err != nil {
+			return err
+		}
+	}
+
+	if entry.Rating == 0 {
+		return nil
+	}
+
+	_, err := tx.ExecContext(ctx, keepRevision("user_id = $2 AND book_id = $1", "$3", "$4", "$7", "$2")+`INSERT INTO book_reviews (book_id, user_id, score, review, spoiler, created_at, updated_at) VALUES ($1, $2, $3, NULLIF($4, ''), $7, $5, $5)
+	ON CONFLICT (user_id, book_id) DO UPDATE SET score = EXCLUDED.score, review = EXCLUDED.review, spoiler = EXCLUDED.spoiler, updated_at = $6`,
+		bookId, userId, entry.Rating, entry.Review, entry.DateAdded, time.Now(), entry.Spoiler)
+	return err
+}
+
+// GetUserLibrary returns every book the user shelved or reviewed with its book, most recently added first
+func (storage *PostgresqlStorage) GetUserLibrary(userId int) ([]*LibraryEntry, error) {
+	storage, span := storage.startSpan("GetUserLibrary")
+	defer span.End()
+
+	entries := make([]*LibraryEntry, 0)
+	err := storage.db.SelectContext(storage.context(), &entries, `SELECT library.book_id,
+		COALESCE((SELECT shelf FROM shelf_entries WHERE user_id = $1 AND book_id = library.book_id AND shelf = ANY($2)), '') AS status,
+		COALESCE((SELECT array_agg(shelf ORDER BY shelf) FROM shelf_entries WHERE user_id = $1 AND book_id = library.book_id AND shelf <> ALL($2)), '{}') AS shelves,
+		COALESCE(review.score, 0) AS rating,
+		COALESCE(review.review, '') AS review,
+		COALESCE(review.spoiler, false) AS spoiler,
+		COALESCE((SELECT min(added_at) FROM shelf_entries WHERE user_id = $1 AND book_id = library.book_id), review.created_at, CURRENT_TIMESTAMP) AS date_added,
+		(SELECT read_at FROM shelf_entries WHERE user_id = $1 AND book_id = library.book_id AND shelf = 'read') AS date_read,
+		COALESCE((SELECT avg(score) FROM book_reviews WHERE book_id = library.book_id), 0) AS average_rating,
+		(SELECT min(editions.publication_date) FROM books JOIN books AS editions ON editions.work_id = books.work_id WHERE books.id = library.book_id) AS original_publication_date
+	FROM (
+		SELECT book_id FROM shelf_entries WHERE user_id = $1
+		UNION SELECT book_id FROM book_reviews WHERE user_id = $1
+	) AS library
+	LEFT JOIN LATERAL (
+		SELECT score, review, spoiler, created_at FROM book_reviews WHERE user_id = $1 AND book_id = library.book_id
+	) AS review ON true
+	ORDER BY date_added DESC, library.book_id`, userId, pq.Array(StatusShelves))
+	if err != nil {
+		return nil, err
+	}
+
+	if len(entries) == 0 {
+		return entries, nil
+	}
+
+	bookIds := make([]int64, 0, len(entries))
+	for _, entry := range entries {
+		bookIds = append(bookIds, int64(entry.BookID))
+	}
+
+	books := make([]*Book, 0, len(entries))
+	if err := storage.db.SelectContext(storage.context(), &books, "SELECT "+bookColumns+" FROM books WHERE id = ANY($1)", pq.Array(bookIds)); err != nil {
+		return nil, err
+	}
+
+	if err := storage.loadBookContributors(books); err != nil {
+		return nil, err
+	}
+
+	byId := make(map[int]*Book, len(books))
+	for _, book := range books {
+		byId[book.ID] = book
+	}
+
+	for _, entry := range entries {
+		entry.Book = byId[entry.BookID]
+	}
+
+	return entries, nil
+}
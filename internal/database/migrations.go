@@ -0,0 +1,136 @@
+package database
+
+import (
+	"context"
+	"embed"
+	"fmt"
+	"io/fs"
+	"sort"
+	"strings"
+	"time"
+)
+
+//go:embed migrations/*.sql
+var migrationFiles embed.FS
+
+// Advisory lock key held while migrations run so concurrent instances do not race
+const migrationLockKey = 7245001
+
+type Migration struct {
+	Version string
+	SQL     string
+}
+
+type AppliedMigration struct {
+	Version   string    `db:"version"`
+	AppliedAt time.Time `db:"applied_at"`
+}
+
+// Migrations returns the embedded migrations ordered by version
+func Migrations() ([]Migration, error) {
+	entries, err := fs.ReadDir(migrationFiles, "migrations")
+	if err != nil {
+		return nil, err
+	}
+
+	migrations := make([]Migration, 0, len(entries))
+	for _, entry := range entries {
+		content, err := migrationFiles.ReadFile("migrations/" + entry.Name())
+		if err != nil {
+			return nil, err
+		}
+
+		migrations = append(migrations, Migration{
+			Version: strings.TrimSuffix(entry.Name(), ".sql"),
+			SQL:     string(content),
+		})
+	}
+
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].Version < migrations[j].Version
+	})
+
+	return migrations, nil
+}
+
+func (storage *PostgresqlStorage) ensureMigrationsTable(ctx context.Context) error {
+	_, err := storage.db.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS schema_migrations (
+		version VARCHAR(255) PRIMARY KEY,
+		applied_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+	)`)
+	return err
+}
+
+// AppliedMigrations lists the migrations recorded in schema_migrations
+func (storage *PostgresqlStorage) AppliedMigrations(ctx context.Context) ([]AppliedMigration, error) {
+	if err := storage.ensureMigrationsTable(ctx); err != nil {
+		return nil, err
+	}
+
+	applied := make([]AppliedMigration, 0)
+	err := storage.db.SelectContext(ctx, &applied, "SELECT version, applied_at FROM schema_migrations ORDER BY version")
+	if err != nil {
+		return nil, err
+	}
+
+	return applied, nil
+}
+
+// Migrate applies every pending migration, each in its own transaction, and returns the applied versions
+func (storage *PostgresqlStorage) Migrate(ctx context.Context) ([]string, error) {
+	migrations, err := Migrations()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := storage.ensureMigrationsTable(ctx); err != nil {
+		return nil, err
+	}
+
+	conn, err := storage.db.Connx(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	if _, err := conn.ExecContext(ctx, "SELECT pg_advisory_lock($1)", migrationLockKey); err != nil {
+		return nil, err
+	}
+	defer conn.ExecContext(context.Background(), "SELECT pg_advisory_unlock($1)", migrationLockKey)
+
+	appliedVersions := make([]string, 0)
+	for _, migration := range migrations {
+		var exists bool
+		err := conn.GetContext(ctx, &exists, "SELECT EXISTS(SELECT 1 FROM schema_migrations WHERE version = $1)", migration.Version)
+		if err != nil {
+			return appliedVersions, err
+		}
+
+		if exists {
+			continue
+		}
+
+		tx, err := conn.BeginTxx(ctx, nil)
+		if err != nil {
+			return appliedVersions, err
+		}
+
+		if _, err := tx.ExecContext(ctx, migration.SQL); err != nil {
+			tx.Rollback()
+			return appliedVersions, fmt.Errorf("migration %s failed: %w", migration.Version, err)
+		}
+
+		if _, err := tx.ExecContext(ctx, "INSERT INTO schema_migrations (version) VALUES ($1)", migration.Version); err != nil {
+			tx.Rollback()
+			return appliedVersions, err
+		}
+
+		if err := tx.Commit(); err != nil {
+			return appliedVersions, err
+		}
+
+		appliedVersions = append(appliedVersions, migration.Version)
+	}
+
+	return appliedVersions, nil
+}
@@ -4,8 +4,14 @@ CREATE TABLE IF NOT EXISTS roles (
     created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
 );
 INSERT INTO roles (name)
-VALUES ('admin'),
-    ('user');
+SELECT role_name
+FROM (VALUES ('admin'), ('user')) AS default_roles(role_name)
+WHERE NOT EXISTS (
+        SELECT 1
+        FROM roles
+        WHERE roles.name = default_roles.role_name
+    )
+ORDER BY role_name;
 CREATE TABLE IF NOT EXISTS users (
     id SERIAL PRIMARY KEY,
     first_name VARCHAR(50),
@@ -28,7 +34,7 @@ CREATE TABLE IF NOT EXISTS books (
     language VARCHAR(50) NOT NULL,
     format VARCHAR(50) NOT NULL
 );
-CREATE TABLE book_reviews (
+CREATE TABLE IF NOT EXISTS book_reviews (
     id SERIAL PRIMARY KEY,
     book_id INT REFERENCES books(id),
     user_id INT REFERENCES users(id),
@@ -36,4 +42,4 @@ CREATE TABLE book_reviews (
     review TEXT,
     created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
     updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
-)
\ No newline at end of file
+);
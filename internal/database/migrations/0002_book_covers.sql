@@ -0,0 +1,9 @@
+ALTER TABLE books ADD COLUMN IF NOT EXISTS cover_image_key TEXT;
+CREATE INDEX IF NOT EXISTS books_isbn_idx ON books (translate(isbn, '- ', ''));
+INSERT INTO roles (name)
+SELECT 'librarian'
+WHERE NOT EXISTS (
+        SELECT 1
+        FROM roles
+        WHERE roles.name = 'librarian'
+    );
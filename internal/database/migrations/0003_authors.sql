@@ -0,0 +1,39 @@
+CREATE TABLE IF NOT EXISTS authors (
+    id SERIAL PRIMARY KEY,
+    name VARCHAR(200) NOT NULL,
+    bio TEXT,
+    birth_date DATE,
+    death_date DATE,
+    photo_key TEXT,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+CREATE INDEX IF NOT EXISTS authors_name_idx ON authors (lower(name));
+CREATE TABLE IF NOT EXISTS book_authors (
+    book_id INT NOT NULL REFERENCES books(id) ON DELETE CASCADE,
+    author_id INT NOT NULL REFERENCES authors(id) ON DELETE CASCADE,
+    role VARCHAR(20) NOT NULL DEFAULT 'author' CHECK (role IN ('author', 'translator', 'illustrator', 'editor')),
+    position SMALLINT NOT NULL DEFAULT 0,
+    PRIMARY KEY (book_id, author_id, role)
+);
+CREATE INDEX IF NOT EXISTS book_authors_author_id_idx ON book_authors (author_id);
+-- Every distinct free text author becomes one author, the text is kept as is since
+-- values such as "Tolkien, J.R.R." can not be told apart from a list of co-authors
+INSERT INTO authors (name)
+SELECT DISTINCT ON (lower(trim(books.author))) trim(books.author)
+FROM books
+WHERE trim(books.author) <> ''
+    AND NOT EXISTS (
+        SELECT 1
+        FROM authors
+        WHERE lower(authors.name) = lower(trim(books.author))
+    );
+INSERT INTO book_authors (book_id, author_id, role)
+SELECT books.id, (
+        SELECT min(authors.id)
+        FROM authors
+        WHERE lower(authors.name) = lower(trim(books.author))
+    ), 'author'
+FROM books
+WHERE trim(books.author) <> ''
+ON CONFLICT DO NOTHING;
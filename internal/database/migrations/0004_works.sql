@@ -0,0 +1,21 @@
+CREATE TABLE IF NOT EXISTS works (
+    id SERIAL PRIMARY KEY,
+    title VARCHAR(100) NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+ALTER TABLE books ADD COLUMN IF NOT EXISTS work_id INT REFERENCES works(id);
+-- Until editions are merged every existing book is the only edition of its own work
+DO $$
+DECLARE
+    book RECORD;
+    new_work_id INT;
+BEGIN
+    FOR book IN SELECT id, title FROM books WHERE work_id IS NULL ORDER BY id LOOP
+        INSERT INTO works (title) VALUES (book.title) RETURNING id INTO new_work_id;
+        UPDATE books SET work_id = new_work_id WHERE id = book.id;
+    END LOOP;
+END $$;
+ALTER TABLE books ALTER COLUMN work_id SET NOT NULL;
+CREATE INDEX IF NOT EXISTS books_work_id_idx ON books (work_id);
+CREATE INDEX IF NOT EXISTS book_reviews_book_id_idx ON book_reviews (book_id);
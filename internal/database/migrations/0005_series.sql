@@ -0,0 +1,16 @@
+CREATE TABLE IF NOT EXISTS series (
+    id SERIAL PRIMARY KEY,
+    name VARCHAR(200) NOT NULL,
+    description TEXT,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+-- Series contain works so every edition of a work has the same place in the series.
+-- Positions are fractional so novellas can sit between two novels, for example 2.5
+CREATE TABLE IF NOT EXISTS series_works (
+    series_id INT NOT NULL REFERENCES series(id) ON DELETE CASCADE,
+    work_id INT NOT NULL REFERENCES works(id) ON DELETE CASCADE,
+    position NUMERIC(6, 2) NOT NULL CHECK (position >= 0),
+    PRIMARY KEY (series_id, work_id)
+);
+CREATE INDEX IF NOT EXISTS series_works_work_id_idx ON series_works (work_id);
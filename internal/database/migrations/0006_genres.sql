@@ -0,0 +1,38 @@
+CREATE TABLE IF NOT EXISTS genres (
+    id SERIAL PRIMARY KEY,
+    name VARCHAR(100) NOT NULL,
+    slug VARCHAR(100) NOT NULL UNIQUE,
+    parent_id INT REFERENCES genres(id),
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+CREATE INDEX IF NOT EXISTS genres_parent_id_idx ON genres (parent_id);
+CREATE TABLE IF NOT EXISTS book_genres (
+    book_id INT NOT NULL REFERENCES books(id) ON DELETE CASCADE,
+    genre_id INT NOT NULL REFERENCES genres(id) ON DELETE CASCADE,
+    position SMALLINT NOT NULL DEFAULT 0,
+    PRIMARY KEY (book_id, genre_id)
+);
+CREATE INDEX IF NOT EXISTS book_genres_genre_id_idx ON book_genres (genre_id);
+CREATE TABLE IF NOT EXISTS book_tags (
+    book_id INT NOT NULL REFERENCES books(id) ON DELETE CASCADE,
+    user_id INT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    tag VARCHAR(50) NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (book_id, user_id, tag)
+);
+CREATE INDEX IF NOT EXISTS book_tags_book_id_tag_idx ON book_tags (book_id, tag);
+-- Every distinct free text genre becomes a top level genre of the taxonomy
+INSERT INTO genres (name, slug)
+SELECT DISTINCT ON (slug) name, slug
+FROM (
+        SELECT trim(genre) AS name,
+            trim(BOTH '-' FROM regexp_replace(lower(trim(genre)), '[^a-z0-9]+', '-', 'g')) AS slug
+        FROM books
+    ) AS book_genre_names
+WHERE slug <> ''
+ON CONFLICT (slug) DO NOTHING;
+INSERT INTO book_genres (book_id, genre_id)
+SELECT books.id, genres.id
+FROM books
+    JOIN genres ON genres.slug = trim(BOTH '-' FROM regexp_replace(lower(trim(books.genre)), '[^a-z0-9]+', '-', 'g'))
+ON CONFLICT DO NOTHING;
@@ -0,0 +1,12 @@
+CREATE TABLE IF NOT EXISTS shelf_entries (
+    user_id INT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    book_id INT NOT NULL REFERENCES books(id) ON DELETE CASCADE,
+    shelf VARCHAR(50) NOT NULL,
+    added_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    read_at DATE,
+    PRIMARY KEY (user_id, book_id, shelf)
+);
+CREATE INDEX IF NOT EXISTS shelf_entries_book_id_idx ON shelf_entries (book_id);
+-- A book is on at most one of the reading status shelves of a user
+CREATE UNIQUE INDEX IF NOT EXISTS shelf_entries_status_idx ON shelf_entries (user_id, book_id)
+WHERE shelf IN ('read', 'currently-reading', 'to-read');
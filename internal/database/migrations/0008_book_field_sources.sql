@@ -0,0 +1,8 @@
+-- Where the current value of a book field came from, fields edited by librarians are kept by later imports
+CREATE TABLE IF NOT EXISTS book_field_sources (
+    book_id INT NOT NULL REFERENCES books(id) ON DELETE CASCADE,
+    field VARCHAR(50) NOT NULL,
+    source VARCHAR(50) NOT NULL,
+    updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (book_id, field)
+);
@@ -0,0 +1,9 @@
+-- Users review a book once, of earlier duplicates the most recently updated review is kept.
+-- updated_at may be NULL, created_at stands in for it then
+DELETE FROM book_reviews AS duplicate
+USING book_reviews AS kept
+WHERE duplicate.user_id = kept.user_id
+    AND duplicate.book_id = kept.book_id
+    AND (COALESCE(duplicate.updated_at, duplicate.created_at, '-infinity'), duplicate.id)
+        < (COALESCE(kept.updated_at, kept.created_at, '-infinity'), kept.id);
+CREATE UNIQUE INDEX IF NOT EXISTS book_reviews_user_id_book_id_idx ON book_reviews (user_id, book_id);
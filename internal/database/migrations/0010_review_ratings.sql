@@ -0,0 +1,9 @@
+-- score was a SMALLSERIAL, it becomes a rating from 1 to 5 stars in half stars
+ALTER TABLE book_reviews ALTER COLUMN score DROP DEFAULT;
+DROP SEQUENCE IF EXISTS book_reviews_score_seq;
+ALTER TABLE book_reviews ALTER COLUMN score TYPE NUMERIC(2, 1) USING LEAST(GREATEST(score, 1), 5);
+ALTER TABLE book_reviews ALTER COLUMN score SET NOT NULL;
+ALTER TABLE book_reviews DROP CONSTRAINT IF EXISTS book_reviews_score_check;
+ALTER TABLE book_reviews ADD CONSTRAINT book_reviews_score_check CHECK (score BETWEEN 1 AND 5 AND score * 2 = trunc(score * 2));
+-- Ratings without a written review have no text
+UPDATE book_reviews SET review = NULL WHERE trim(review) = '';
@@ -0,0 +1,27 @@
+CREATE TABLE IF NOT EXISTS review_likes (
+    review_id INT NOT NULL REFERENCES book_reviews(id) ON DELETE CASCADE,
+    user_id INT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (review_id, user_id)
+);
+CREATE TABLE IF NOT EXISTS review_comments (
+    id SERIAL PRIMARY KEY,
+    review_id INT NOT NULL REFERENCES book_reviews(id) ON DELETE CASCADE,
+    user_id INT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    -- Replies point at the comment they answer, top level comments have none
+    parent_id INT REFERENCES review_comments(id) ON DELETE CASCADE,
+    body TEXT NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    -- Removed comments that still have replies stay as placeholders of their thread
+    deleted_at TIMESTAMP
+);
+CREATE INDEX IF NOT EXISTS review_comments_review_id_idx ON review_comments (review_id);
+CREATE INDEX IF NOT EXISTS review_comments_parent_id_idx ON review_comments (parent_id);
+INSERT INTO roles (name)
+SELECT 'moderator'
+WHERE NOT EXISTS (
+        SELECT 1
+        FROM roles
+        WHERE roles.name = 'moderator'
+    );
@@ -0,0 +1,2 @@
+-- Reviews that give the plot away as a whole, inline [spoiler] spans mark smaller parts of the text
+ALTER TABLE book_reviews ADD COLUMN IF NOT EXISTS spoiler BOOLEAN NOT NULL DEFAULT false;
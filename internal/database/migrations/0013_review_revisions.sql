@@ -0,0 +1,14 @@
+-- Every version of a review that an edit replaced, newest versions stay in book_reviews
+CREATE TABLE IF NOT EXISTS review_revisions (
+    id SERIAL PRIMARY KEY,
+    review_id INT NOT NULL REFERENCES book_reviews(id) ON DELETE CASCADE,
+    score NUMERIC(2, 1) NOT NULL,
+    review TEXT,
+    spoiler BOOLEAN NOT NULL,
+    -- When this version was written
+    written_at TIMESTAMP NOT NULL,
+    -- The user whose edit replaced this version
+    edited_by INT REFERENCES users(id) ON DELETE SET NULL,
+    edited_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+CREATE INDEX IF NOT EXISTS review_revisions_review_id_idx ON review_revisions (review_id, edited_at);
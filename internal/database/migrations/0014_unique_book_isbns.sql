@@ -0,0 +1,10 @@
+-- Books are created once per ISBN, compared without hyphens and spaces. Of earlier duplicates the oldest book
+-- keeps the ISBN and the others have it cleared, books without an ISBN are not constrained.
+UPDATE books AS duplicate
+SET isbn = ''
+FROM books AS kept
+WHERE translate(duplicate.isbn, '- ', '') = translate(kept.isbn, '- ', '')
+    AND translate(duplicate.isbn, '- ', '') <> ''
+    AND kept.id < duplicate.id;
+CREATE UNIQUE INDEX IF NOT EXISTS books_isbn_unique_idx ON books (translate(isbn, '- ', ''))
+WHERE translate(isbn, '- ', '') <> '';
@@ -0,0 +1,32 @@
+package database
+
+import (
+	"errors"
+	"math"
+
+	"gopkg.in/validator.v2"
+)
+
+// Ratings go from 1 to 5 stars in half stars
+const (
+	MinRating = 1.0
+	MaxRating = 5.0
+)
+
+func init() {
+	validator.SetValidationFunc("stars", validateStars)
+}
+
+// validateStars checks the `validate:"stars"` fields hold a rating, 1, 1.5 and so on up to 5
+func validateStars(v interface{}, param string) error {
+	rating, ok := v.(float64)
+	if !ok {
+		return validator.ErrUnsupported
+	}
+
+	if rating < MinRating || rating > MaxRating || rating*2 != math.Trunc(rating*2) {
+		return errors.New("must be a rating from 1 to 5 in steps of 0.5")
+	}
+
+	return nil
+}
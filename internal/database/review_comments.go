@@ -0,0 +1,176 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/kaanserin/go-reads/internal/utils"
+	"github.com/lib/pq"
+)
+
+// ReviewComment is a comment on a review or a reply to another comment of the review
+type ReviewComment struct {
+	ID       int  `json:"id" db:"id"`
+	ReviewID int  `json:"review_id" db:"review_id"`
+	UserID   int  `json:"user_id" db:"user_id"`
+	ParentID *int `json:"parent_id" db:"parent_id"`
+	// Empty once the comment is removed, removed comments are only kept while they have replies
+	Body      string    `json:"body" db:"body"`
+	Deleted   bool      `json:"deleted" db:"deleted"`
+	CreatedAt time.Time `json:"created_at" db:"created_at"`
+	UpdatedAt time.Time `json:"updated_at" db:"updated_at"`
+
+	// Replies, only filled in when the comments are returned as threads
+	Replies []*ReviewComment `json:"replies,omitempty" db:"-"`
+}
+
+const reviewCommentColumns = "id, review_id, user_id, parent_id, body, deleted_at IS NOT NULL AS deleted, created_at, updated_at"
+
+type ReviewCommentDto struct {
+	Body     string `json:"body" validate:"nonzero,max=2000"`
+	ParentID *int   `json:"parent_id"`
+}
+
+// LikeBookReview records that the user likes the review, liking twice changes nothing.
+// It returns sql.ErrNoRows when the review does not exist.
+func (storage *PostgresqlStorage) LikeBookReview(reviewId int, userId int) error {
+	storage, span := storage.startSpan("LikeBookReview")
+	defer span.End()
+
+	_, err := storage.db.ExecContext(storage.context(), `INSERT INTO review_likes (review_id, user_id) VALUES ($1, $2)
+	ON CONFLICT (review_id, user_id) DO NOTHING`, reviewId, userId)
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) && pqErr.Code.Name() == "foreign_key_violation" {
+		return sql.ErrNoRows
+	}
+
+	return err
+}
+
+func (storage *PostgresqlStorage) UnlikeBookReview(reviewId int, userId int) error {
+	storage, span := storage.startSpan("UnlikeBookReview")
+	defer span.End()
+
+	_, err := storage.db.ExecContext(storage.context(), "DELETE FROM review_likes WHERE review_id = $1 AND user_id = $2", reviewId, userId)
+	return err
+}
+
+// GetReviewComments returns the comments of a review, oldest first
+func (storage *PostgresqlStorage) GetReviewComments(reviewId int) ([]*ReviewComment, error) {
+	storage, span := storage.startSpan("GetReviewComments")
+	defer span.End()
+
+	comments := make([]*ReviewComment, 0)
+	err := storage.db.SelectContext(storage.context(), &comments,
+		"SELECT "+reviewCommentColumns+" FROM review_comments WHERE review_id = $1 ORDER BY created_at, id", reviewId)
+	if err != nil {
+		return nil, err
+	}
+
+	return comments, nil
+}
+
+func (storage *PostgresqlStorage) GetReviewCommentById(id int) (*ReviewComment, error) {
+	storage, span := storage.startSpan("GetReviewCommentById")
+	defer span.End()
+
+	var comment *ReviewComment = &ReviewComment{}
+	err := storage.db.GetContext(storage.context(), comment, "SELECT "+reviewCommentColumns+" FROM review_comments WHERE id = $1", id)
+	if err != nil {
+		return nil, err
+	}
+
+	return comment, nil
+}
+
+// CreateReviewComment comments on a review, or replies to a comment of the same review when a parent is given.
+// It returns sql.ErrNoRows when the review does not exist.
+func (storage *PostgresqlStorage) CreateReviewComment(reviewId int, userId int, commentDto *ReviewCommentDto) (*ReviewComment, error) {
+	storage, span := storage.startSpan("CreateReviewComment")
+	defer span.End()
+
+	var id int
+	err := storage.db.QueryRowContext(storage.context(), `INSERT INTO review_comments (review_id, user_id, parent_id, body)
+	SELECT $1, $2, $3, $4
+	WHERE $3::INT IS NULL OR EXISTS (SELECT 1 FROM review_comments WHERE id = $3 AND review_id = $1 AND deleted_at IS NULL)
+	RETURNING id`, reviewId, userId, commentDto.ParentID, commentDto.Body).Scan(&id)
+
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) && pqErr.Code.Name() == "foreign_key_violation" {
+		return nil, sql.ErrNoRows
+	} else if errors.Is(err, sql.ErrNoRows) {
+		return nil, &utils.CustomError{
+			Message: "The comment replied to is not a comment of this review or was removed",
+		}
+	} else if err != nil {
+		return nil, err
+	}
+
+	return storage.GetReviewCommentById(id)
+}
+
+func (storage *PostgresqlStorage) UpdateReviewComment(id int, body string) (*ReviewComment, error) {
+	storage, span := storage.startSpan("UpdateReviewComment")
+	defer span.End()
+
+	result, err := storage.db.ExecContext(storage.context(), "UPDATE review_comments SET body = $1, updated_at = $2 WHERE id = $3 AND deleted_at IS NULL",
+		body, time.Now(), id)
+	if err != nil {
+		return nil, err
+	}
+
+	affectedRows, err := result.RowsAffected()
+	if err != nil {
+		return nil, err
+	}
+
+	if affectedRows == 0 {
+		return nil, &utils.CustomError{
+			Message: "Comment not found",
+		}
+	}
+
+	return storage.GetReviewCommentById(id)
+}
+
+// DeleteReviewComment removes a comment. A comment with replies keeps its place in the thread without its text,
+// and removed comments kept that way go once their last reply is deleted.
+func (storage *PostgresqlStorage) DeleteReviewComment(id int) error {
+	storage, span := storage.startSpan("DeleteReviewComment")
+	defer span.End()
+
+	tx, err := storage.db.BeginTxx(storage.context(), nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	const deleteWithoutReplies = `DELETE FROM review_comments WHERE id = $1 %s
+	AND NOT EXISTS (SELECT 1 FROM review_comments AS replies WHERE replies.parent_id = $1) RETURNING parent_id`
+
+	var parentId *int
+	err = tx.QueryRowContext(storage.context(), fmt.Sprintf(deleteWithoutReplies, ""), id).Scan(&parentId)
+	if errors.Is(err, sql.ErrNoRows) {
+		_, err = tx.ExecContext(storage.context(), "UPDATE review_comments SET body = '', deleted_at = $1 WHERE id = $2 AND deleted_at IS NULL", time.Now(), id)
+		if err != nil {
+			return err
+		}
+
+		return tx.Commit()
+	} else if err != nil {
+		return err
+	}
+
+	for parentId != nil {
+		err = tx.QueryRowContext(storage.context(), fmt.Sprintf(deleteWithoutReplies, "AND deleted_at IS NOT NULL"), *parentId).Scan(&parentId)
+		if errors.Is(err, sql.ErrNoRows) {
+			break
+		} else if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
@@ -0,0 +1,49 @@
+package database
+
+import (
+	"fmt"
+	"time"
+)
+
+// ReviewRevision is a version of a review that an edit replaced
+type ReviewRevision struct {
+	ID       int     `json:"id" db:"id"`
+	ReviewID int     `json:"review_id" db:"review_id"`
+	Score    float64 `json:"score" db:"score"`
+	Review   string  `json:"review" db:"review"`
+	Spoiler  bool    `json:"spoiler" db:"spoiler"`
+	// When this version was written
+	WrittenAt time.Time `json:"written_at" db:"written_at"`
+	// The user whose edit replaced this version, nil once their account is deleted
+	EditedBy *int      `json:"edited_by" db:"edited_by"`
+	EditedAt time.Time `json:"edited_at" db:"edited_at"`
+}
+
+const reviewRevisionColumns = "id, review_id, score, COALESCE(review, '') AS review, spoiler, written_at, edited_by, edited_at"
+
+// keepRevision returns a WITH clause that keeps the current version of the reviews matching where as a revision
+// when the statement it starts changes their score, review or spoiler flag. The clause sees the reviews as they
+// were before the statement, so the revision and the edit are written together.
+// Every argument is SQL spliced into the clause, pass placeholders of the statement and never user input.
+func keepRevision(where string, score string, review string, spoiler string, editor string) string {
+	return fmt.Sprintf(`WITH revision AS (
+		INSERT INTO review_revisions (review_id, score, review, spoiler, written_at, edited_by)
+		SELECT id, score, review, spoiler, COALESCE(updated_at, created_at, CURRENT_TIMESTAMP), %s FROM book_reviews
+		WHERE %s AND (score, review, spoiler) IS DISTINCT FROM (%s, NULLIF(%s, ''), %s)
+	) `, editor, where, score, review, spoiler)
+}
+
+// GetReviewRevisions returns the earlier versions of a review, most recently replaced first
+func (storage *PostgresqlStorage) GetReviewRevisions(reviewId int) ([]*ReviewRevision, error) {
+	storage, span := storage.startSpan("GetReviewRevisions")
+	defer span.End()
+
+	revisions := make([]*ReviewRevision, 0)
+	err := storage.db.SelectContext(storage.context(), &revisions,
+		"SELECT "+reviewRevisionColumns+" FROM review_revisions WHERE review_id = $1 ORDER BY edited_at DESC, id DESC", reviewId)
+	if err != nil {
+		return nil, err
+	}
+
+	return revisions, nil
+}
@@ -0,0 +1,245 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/kaanserin/go-reads/internal/utils"
+	"github.com/lib/pq"
+)
+
+type Series struct {
+	ID          int       `json:"id" db:"id"`
+	Name        string    `json:"name" db:"name"`
+	Description string    `json:"description" db:"description"`
+	CreatedAt   time.Time `json:"created_at" db:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at" db:"updated_at"`
+
+	// Works of the series by position, only filled in when a single series is fetched
+	Entries []*SeriesEntry `json:"entries,omitempty" db:"-"`
+}
+
+const seriesColumns = "id, name, COALESCE(description, '') AS description, created_at, updated_at"
+
+// SeriesEntry is a work at its position in a series
+type SeriesEntry struct {
+	SeriesID int     `json:"-" db:"series_id"`
+	WorkID   int     `json:"work_id" db:"work_id"`
+	Title    string  `json:"title" db:"title"`
+	Position float64 `json:"position" db:"position"`
+	// Lowest id edition of the work, the one clients link to
+	BookID int `json:"book_id" db:"book_id"`
+}
+
+// BookSeries is the place of a book in one of the series its work belongs to
+type BookSeries struct {
+	WorkID   int     `json:"-" db:"work_id"`
+	SeriesID int     `json:"series_id" db:"series_id"`
+	Name     string  `json:"name" db:"name"`
+	Position float64 `json:"position" db:"position"`
+}
+
+const seriesEntryQuery = `SELECT series_works.series_id, series_works.work_id, works.title, series_works.position,
+	(SELECT min(books.id) FROM books WHERE books.work_id = works.id) AS book_id
+	FROM series_works JOIN works ON works.id = series_works.work_id`
+
+func (storage *PostgresqlStorage) GetSeries(r *http.Request) ([]*Series, error) {
+	storage, span := storage.startSpan("GetSeries")
+	defer span.End()
+
+	query := "SELECT " + seriesColumns + " FROM series"
+	if name := r.URL.Query().Get("name"); name != "" {
+		query += fmt.Sprintf(" WHERE name ILIKE %s", pq.QuoteLiteral("%"+name+"%"))
+	}
+
+	return GetLazyPaginatedResponsePG[Series](storage, r, query)
+}
+
+// GetSeriesById returns the series with its works ordered by position
+func (storage *PostgresqlStorage) GetSeriesById(id int) (*Series, error) {
+	storage, span := storage.startSpan("GetSeriesById")
+	defer span.End()
+
+	var series *Series = &Series{}
+	if err := storage.db.GetContext(storage.context(), series, "SELECT "+seriesColumns+" FROM series WHERE id = $1", id); err != nil {
+		return nil, err
+	}
+
+	series.Entries = make([]*SeriesEntry, 0)
+	err := storage.db.SelectContext(storage.context(), &series.Entries,
+		seriesEntryQuery+" WHERE series_works.series_id = $1 ORDER BY series_works.position, works.id", id)
+	if err != nil {
+		return nil, err
+	}
+
+	return series, nil
+}
+
+type SeriesDto struct {
+	Name        string `json:"name" validate:"nonzero,max=200"`
+	Description string `json:"description"`
+}
+
+func (storage *PostgresqlStorage) CreateSeries(seriesDto *SeriesDto) (*Series, error) {
+	storage, span := storage.startSpan("CreateSeries")
+	defer span.End()
+
+	var id int
+	err := storage.db.QueryRowContext(storage.context(),
+		"INSERT INTO series (name, description) VALUES ($1, NULLIF($2, '')) RETURNING id",
+		seriesDto.Name, seriesDto.Description).Scan(&id)
+	if err != nil {
+		return nil, err
+	}
+
+	return storage.GetSeriesById(id)
+}
+
+func (storage *PostgresqlStorage) UpdateSeriesById(id int, seriesDto *SeriesDto) (*Series, error) {
+	storage, span := storage.startSpan("UpdateSeriesById")
+	defer span.End()
+
+	result, err := storage.db.ExecContext(storage.context(),
+		"UPDATE series SET name = $1, description = NULLIF($2, ''), updated_at = $3 WHERE id = $4",
+		seriesDto.Name, seriesDto.Description, time.Now(), id)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := expectSeriesAffected(result, id); err != nil {
+		return nil, err
+	}
+
+	return storage.GetSeriesById(id)
+}
+
+func (storage *PostgresqlStorage) DeleteSeriesById(id int) error {
+	storage, span := storage.startSpan("DeleteSeriesById")
+	defer span.End()
+
+	result, err := storage.db.ExecContext(storage.context(), "DELETE FROM series WHERE id = $1", id)
+	if err != nil {
+		return err
+	}
+
+	return expectSeriesAffected(result, id)
+}
+
+func expectSeriesAffected(result sql.Result, id int) error {
+	affectedRows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if affectedRows == 0 {
+		return &utils.CustomError{
+			Message: fmt.Sprintf("No series found for the given id %d", id),
+		}
+	}
+
+	return nil
+}
+
+// SetSeriesWork places a work in a series or moves it to a new position
+func (storage *PostgresqlStorage) SetSeriesWork(seriesId int, workId int, position float64) (*Series, error) {
+	storage, span := storage.startSpan("SetSeriesWork")
+	defer span.End()
+
+	_, err := storage.db.ExecContext(storage.context(), `INSERT INTO series_works (series_id, work_id, position) VALUES ($1, $2, $3)
+	ON CONFLICT (series_id, work_id) DO UPDATE SET position = EXCLUDED.position`, seriesId, workId, position)
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) && pqErr.Code.Name() == "foreign_key_violation" {
+		return nil, &utils.CustomError{
+			Message: fmt.Sprintf("No series %d or work %d found", seriesId, workId),
+		}
+	} else if err != nil {
+		return nil, err
+	}
+
+	return storage.GetSeriesById(seriesId)
+}
+
+func (storage *PostgresqlStorage) RemoveSeriesWork(seriesId int, workId int) (*Series, error) {
+	storage, span := storage.startSpan("RemoveSeriesWork")
+	defer span.End()
+
+	result, err := storage.db.ExecContext(storage.context(), "DELETE FROM series_works WHERE series_id = $1 AND work_id = $2", seriesId, workId)
+	if err != nil {
+		return nil, err
+	}
+
+	affectedRows, err := result.RowsAffected()
+	if err != nil {
+		return nil, err
+	}
+
+	if affectedRows == 0 {
+		return nil, &utils.CustomError{
+			Message: fmt.Sprintf("Work %d is not part of series %d", workId, seriesId),
+		}
+	}
+
+	return storage.GetSeriesById(seriesId)
+}
+
+// GetNextUnreadInSeries returns the first work after the furthest one the user has read in the series,
+// or the first work when they have read none. A work counts as read once the user reviewed or shelved as read any edition of it.
+// It returns sql.ErrNoRows when nothing is left to read.
+func (storage *PostgresqlStorage) GetNextUnreadInSeries(seriesId int, userId int) (*SeriesEntry, error) {
+	storage, span := storage.startSpan("GetNextUnreadInSeries")
+	defer span.End()
+
+	var entry *SeriesEntry = &SeriesEntry{}
+	err := storage.db.GetContext(storage.context(), entry, seriesEntryQuery+`
+	WHERE series_works.series_id = $1
+	AND series_works.position > COALESCE((
+		SELECT max(read_works.position) FROM series_works AS read_works
+		WHERE read_works.series_id = $1 AND read_works.work_id IN (`+readWorksQuery+`)
+	), -1)
+	AND series_works.work_id NOT IN (`+readWorksQuery+`)
+	ORDER BY series_works.position, works.id
+	LIMIT 1`, seriesId, userId)
+	if err != nil {
+		return nil, err
+	}
+
+	return entry, nil
+}
+
+// readWorksQuery selects the works the user of parameter $2 has read
+const readWorksQuery = `SELECT books.work_id FROM book_reviews JOIN books ON books.id = book_reviews.book_id WHERE book_reviews.user_id = $2
+	UNION SELECT books.work_id FROM shelf_entries JOIN books ON books.id = shelf_entries.book_id WHERE shelf_entries.user_id = $2 AND shelf_entries.shelf = 'read'`
+
+// loadBookSeries fills in the series of every book with a single query
+func (storage *PostgresqlStorage) loadBookSeries(books []*Book) error {
+	if len(books) == 0 {
+		return nil
+	}
+
+	workIds := make([]int64, 0, len(books))
+	byWorkId := make(map[int][]*Book, len(books))
+	for _, book := range books {
+		workIds = append(workIds, int64(book.WorkID))
+		byWorkId[book.WorkID] = append(byWorkId[book.WorkID], book)
+	}
+
+	bookSeries := make([]*BookSeries, 0)
+	err := storage.db.SelectContext(storage.context(), &bookSeries, `SELECT series_works.work_id, series.id AS series_id, series.name, series_works.position
+	FROM series_works JOIN series ON series.id = series_works.series_id
+	WHERE series_works.work_id = ANY($1)
+	ORDER BY series.name`, pq.Array(workIds))
+	if err != nil {
+		return err
+	}
+
+	for _, entry := range bookSeries {
+		for _, book := range byWorkId[entry.WorkID] {
+			book.Series = append(book.Series, entry)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,211 @@
+package database
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/kaanserin/go-reads/internal/utils"
+	"github.com/lib/pq"
+)
+
+// Work groups the editions of a book, such as its hardcover, paperback and translated editions
+type Work struct {
+	ID           int    `json:"id" db:"id"`
+	Title        string `json:"title" db:"title"`
+	EditionCount int    `json:"edition_count" db:"edition_count"`
+	RatingsCount int    `json:"ratings_count" db:"ratings_count"`
+	// Ratings that come with a written review
+	ReviewsCount int       `json:"reviews_count" db:"reviews_count"`
+	AverageScore float64   `json:"average_score" db:"average_score"`
+	CreatedAt    time.Time `json:"created_at" db:"created_at"`
+	UpdatedAt    time.Time `json:"updated_at" db:"updated_at"`
+}
+
+// Columns selected for works, ratings are aggregated over the reviews of every edition and reviews count the ones with text
+const workColumns = `works.id, works.title, works.created_at, works.updated_at,
+	(SELECT count(*) FROM books WHERE books.work_id = works.id) AS edition_count,
+	(SELECT count(*) FROM book_reviews JOIN books ON books.id = book_reviews.book_id WHERE books.work_id = works.id) AS ratings_count,
+	(SELECT count(book_reviews.review) FROM book_reviews JOIN books ON books.id = book_reviews.book_id WHERE books.work_id = works.id) AS reviews_count,
+	(SELECT COALESCE(avg(book_reviews.score), 0) FROM book_reviews JOIN books ON books.id = book_reviews.book_id WHERE books.work_id = works.id) AS average_score`
+
+func (storage *PostgresqlStorage) GetWorkById(id int) (*Work, error) {
+	storage, span := storage.startSpan("GetWorkById")
+	defer span.End()
+
+	var work *Work = &Work{}
+	err := storage.db.GetContext(storage.context(), work, "SELECT "+workColumns+" FROM works WHERE works.id = $1", id)
+	if err != nil {
+		return nil, err
+	}
+
+	return work, nil
+}
+
+type WorkDto struct {
+	Title string `json:"title" validate:"nonzero,max=100"`
+}
+
+func (storage *PostgresqlStorage) UpdateWorkById(id int, workDto *WorkDto) (*Work, error) {
+	storage, span := storage.startSpan("UpdateWorkById")
+	defer span.End()
+
+	result, err := storage.db.ExecContext(storage.context(), "UPDATE works SET title = $1, updated_at = $2 WHERE id = $3", workDto.Title, time.Now(), id)
+	if err != nil {
+		return nil, err
+	}
+
+	affectedRows, err := result.RowsAffected()
+	if err != nil {
+		return nil, err
+	}
+
+	if affectedRows == 0 {
+		return nil, &utils.CustomError{
+			Message: fmt.Sprintf("No work found for the given id %d", id),
+		}
+	}
+
+	return storage.GetWorkById(id)
+}
+
+func (storage *PostgresqlStorage) GetEditionsByWorkId(id int, r *http.Request) ([]*Book, error) {
+	storage, span := storage.startSpan("GetEditionsByWorkId")
+	defer span.End()
+
+	query := fmt.Sprintf("SELECT %s FROM books WHERE work_id = %d", bookColumns, id)
+	books, err := GetLazyPaginatedResponsePG[Book](storage, r, query)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := storage.loadBookRelations(books); err != nil {
+		return nil, err
+	}
+
+	return books, nil
+}
+
+func (storage *PostgresqlStorage) GetBookReviewsByWorkId(id int, r *http.Request) ([]*BookReview, error) {
+	storage, span := storage.startSpan("GetBookReviewsByWorkId")
+	defer span.End()
+
+	query := fmt.Sprintf("SELECT "+bookReviewColumns+" FROM book_reviews WHERE book_id IN (SELECT id FROM books WHERE work_id = %d)", id)
+	if r.URL.Query().Get("written_only") == "true" {
+		query += " AND review IS NOT NULL"
+	}
+
+	return GetLazyPaginatedResponsePG[BookReview](storage, r, query)
+}
+
+// MergeWorks moves every edition of the source works into the target work and deletes the emptied works.
+// The target joins the series of the source works it is not part of yet.
+func (storage *PostgresqlStorage) MergeWorks(targetId int, sourceIds []int) (*Work, error) {
+	storage, span := storage.startSpan("MergeWorks")
+	defer span.End()
+
+	tx, err := storage.db.BeginTxx(storage.context(), nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	ids := pq.Array(sourceIds)
+	var found int
+	if err := tx.GetContext(storage.context(), &found, "SELECT count(*) FROM works WHERE id = $1 OR id = ANY($2)", targetId, ids); err != nil {
+		return nil, err
+	}
+
+	if found != len(sourceIds)+1 {
+		return nil, &utils.CustomError{
+			Message: "Some of the given works do not exist",
+		}
+	}
+
+	if _, err := tx.ExecContext(storage.context(), "UPDATE books SET work_id = $1 WHERE work_id = ANY($2)", targetId, ids); err != nil {
+		return nil, err
+	}
+
+	// Deleting the source works drops their series memberships, the target takes their earliest place in each series
+	_, err = tx.ExecContext(storage.context(), `INSERT INTO series_works (series_id, work_id, position)
+	SELECT series_id, $1, min(position) FROM series_works WHERE work_id = ANY($2) GROUP BY series_id
+	ON CONFLICT (series_id, work_id) DO NOTHING`, targetId, ids)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := tx.ExecContext(storage.context(), "DELETE FROM works WHERE id = ANY($1)", ids); err != nil {
+		return nil, err
+	}
+
+	if _, err := tx.ExecContext(storage.context(), "UPDATE works SET updated_at = $1 WHERE id = $2", time.Now(), targetId); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return storage.GetWorkById(targetId)
+}
+
+// SplitWork moves the given editions out of a work into a new work named after the first of them.
+// The new work keeps the places of the original in its series.
+func (storage *PostgresqlStorage) SplitWork(id int, bookIds []int) (*Work, error) {
+	storage, span := storage.startSpan("SplitWork")
+	defer span.End()
+
+	tx, err := storage.db.BeginTxx(storage.context(), nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	// Lock the editions so a concurrent merge can not move them in the meantime
+	var editionIds []int
+	if err := tx.SelectContext(storage.context(), &editionIds, "SELECT id FROM books WHERE work_id = $1 FOR UPDATE", id); err != nil {
+		return nil, err
+	}
+
+	editions := make(map[int]bool, len(editionIds))
+	for _, editionId := range editionIds {
+		editions[editionId] = true
+	}
+
+	for _, bookId := range bookIds {
+		if !editions[bookId] {
+			return nil, &utils.CustomError{
+				Message: fmt.Sprintf("Book %d is not an edition of work %d", bookId, id),
+			}
+		}
+	}
+
+	if len(bookIds) == len(editionIds) {
+		return nil, &utils.CustomError{
+			Message: "At least one edition has to stay in the work",
+		}
+	}
+
+	var newWorkId int
+	err = tx.GetContext(storage.context(), &newWorkId,
+		"INSERT INTO works (title) SELECT title FROM books WHERE id = $1 RETURNING id", bookIds[0])
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := tx.ExecContext(storage.context(), "UPDATE books SET work_id = $1 WHERE id = ANY($2)", newWorkId, pq.Array(bookIds)); err != nil {
+		return nil, err
+	}
+
+	_, err = tx.ExecContext(storage.context(), `INSERT INTO series_works (series_id, work_id, position)
+	SELECT series_id, $1, position FROM series_works WHERE work_id = $2`, newWorkId, id)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return storage.GetWorkById(newWorkId)
+}
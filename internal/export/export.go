@@ -0,0 +1,153 @@
+package export
+
+import (
+	"archive/zip"
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"reflect"
+	"slices"
+	"strings"
+
+	"github.com/kaanserin/go-reads/internal/database"
+	"github.com/kaanserin/go-reads/internal/render"
+)
+
+// Formats of exported tables
+const (
+	FormatNDJSON = "ndjson"
+	FormatCSV    = "csv"
+)
+
+var Formats = []string{FormatNDJSON, FormatCSV}
+
+// ParseTables reads a comma separated list of tables, "all" and an empty list stand for every table
+func ParseTables(value string) ([]string, error) {
+	if value == "" || value == "all" {
+		return database.ExportTables, nil
+	}
+
+	tables := make([]string, 0)
+	for _, table := range strings.Split(value, ",") {
+		table = strings.TrimSpace(table)
+		if !slices.Contains(database.ExportTables, table) {
+			return nil, fmt.Errorf("unknown table %q, expected %s or all", table, strings.Join(database.ExportTables, ", "))
+		}
+
+		if !slices.Contains(tables, table) {
+			tables = append(tables, table)
+		}
+	}
+
+	return tables, nil
+}
+
+// Exporter writes the rows of an export as NDJSON or CSV. A single table is written as it is,
+// several tables go into a zip archive with a file per table.
+type Exporter struct {
+	w       io.Writer
+	format  string
+	archive *zip.Writer
+
+	buffered *bufio.Writer
+	encoder  *json.Encoder
+	csv      *csv.Writer
+	columns  render.Columns
+}
+
+func New(w io.Writer, format string, tables []string) (*Exporter, error) {
+	if !slices.Contains(Formats, format) {
+		return nil, fmt.Errorf("unknown format %q, expected %s", format, strings.Join(Formats, " or "))
+	}
+
+	exporter := &Exporter{w: w, format: format}
+	if len(tables) > 1 {
+		exporter.archive = zip.NewWriter(w)
+	}
+
+	return exporter, nil
+}
+
+// FileName names the download of the tables
+func FileName(tables []string, format string) string {
+	if len(tables) == 1 {
+		return tables[0] + "." + format
+	}
+
+	return "go_reads_export.zip"
+}
+
+// ContentType is the media type of the download of the tables
+func ContentType(tables []string, format string) string {
+	switch {
+	case len(tables) > 1:
+		return "application/zip"
+	case format == FormatCSV:
+		return "text/csv; charset=utf-8"
+	}
+
+	return "application/x-ndjson"
+}
+
+func (exporter *Exporter) BeginTable(table string, model any) error {
+	if err := exporter.flush(); err != nil {
+		return err
+	}
+
+	w := exporter.w
+	if exporter.archive != nil {
+		entry, err := exporter.archive.Create(table + "." + exporter.format)
+		if err != nil {
+			return err
+		}
+		w = entry
+	}
+
+	exporter.buffered = bufio.NewWriter(w)
+	if exporter.format == FormatNDJSON {
+		exporter.encoder = json.NewEncoder(exporter.buffered)
+		return nil
+	}
+
+	exporter.columns = render.ColumnsOf(reflect.TypeOf(model))
+	exporter.csv = csv.NewWriter(exporter.buffered)
+	return exporter.csv.Write(exporter.columns.Header())
+}
+
+func (exporter *Exporter) WriteRow(row any) error {
+	if exporter.format == FormatNDJSON {
+		return exporter.encoder.Encode(row)
+	}
+
+	return exporter.csv.Write(exporter.columns.Record(reflect.ValueOf(row)))
+}
+
+// Close flushes the last table and finishes the archive
+func (exporter *Exporter) Close() error {
+	if err := exporter.flush(); err != nil {
+		return err
+	}
+
+	if exporter.archive != nil {
+		return exporter.archive.Close()
+	}
+
+	return nil
+}
+
+func (exporter *Exporter) flush() error {
+	if exporter.csv != nil {
+		exporter.csv.Flush()
+		if err := exporter.csv.Error(); err != nil {
+			return err
+		}
+	}
+
+	if exporter.buffered != nil {
+		return exporter.buffered.Flush()
+	}
+
+	return nil
+}
@@ -0,0 +1,61 @@
+package export
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kaanserin/go-reads/internal/config"
+	"github.com/kaanserin/go-reads/internal/database"
+	"github.com/kaanserin/go-reads/internal/logging"
+	"github.com/kaanserin/go-reads/internal/middleware"
+	"github.com/kaanserin/go-reads/internal/utils"
+)
+
+func AddExportRoutes(r *gin.Engine, cfg *config.Config) {
+	admin := r.Group("admin")
+
+	admin.Use(middleware.Authentication(cfg.Auth.AppKey), middleware.AuthorizeAdmin())
+
+	admin.GET("/export", utils.MakeHandlerFunc(exportData))
+}
+
+// exportData streams ?tables=books,reviews,users, every table by default, as ?format=ndjson or csv.
+// Several tables are downloaded as a zip archive.
+func exportData(c *gin.Context) error {
+	tables, err := ParseTables(c.Query("tables"))
+	if err != nil {
+		return err
+	}
+
+	format := c.DefaultQuery("format", FormatNDJSON)
+	exporter, err := New(c.Writer, format, tables)
+	if err != nil {
+		return err
+	}
+
+	storage, err := database.GetPgStorageFromRequest(c.Request)
+	if err != nil {
+		return err
+	}
+
+	c.Header("Content-Type", ContentType(tables, format))
+	c.Header("Content-Disposition", `attachment; filename="`+FileName(tables, format)+`"`)
+	c.Status(http.StatusOK)
+
+	err = storage.Export(tables, exporter)
+	if err == nil {
+		err = exporter.Close()
+	}
+
+	// Once rows went out the status can not change anymore, the download is cut short instead
+	if err != nil && c.Writer.Written() {
+		logging.FromContext(c.Request.Context()).Error("export failed", "error", err)
+		c.Abort()
+		return nil
+	} else if err != nil {
+		c.Writer.Header().Del("Content-Type")
+		c.Writer.Header().Del("Content-Disposition")
+	}
+
+	return err
+}
@@ -0,0 +1,99 @@
+package export
+
+import (
+	"archive/zip"
+	"bytes"
+	"io"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kaanserin/go-reads/internal/database"
+)
+
+func TestParseTables(t *testing.T) {
+	tables, err := ParseTables("")
+	if err != nil || !slices.Equal(tables, database.ExportTables) {
+		t.Errorf("Expected every table, got %v %v", tables, err)
+	}
+
+	tables, err = ParseTables("users, books,users")
+	if err != nil || !slices.Equal(tables, []string{"users", "books"}) {
+		t.Errorf("Expected users and books, got %v %v", tables, err)
+	}
+
+	if _, err := ParseTables("books,passwords"); err == nil {
+		t.Error("Expected an unknown table to be rejected")
+	}
+}
+
+func TestCSVLeavesOutPasswordsAndRelations(t *testing.T) {
+	var out bytes.Buffer
+	exporter, err := New(&out, FormatCSV, []string{"users"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	createdAt := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	user := &database.User{ID: 1, FirstName: "Ada", LastName: "Lovelace, Countess", Email: "ada@mail.com", Password: "hash", RoleId: 1, CreatedAt: createdAt,
+		ProfileImageUrls: map[string]string{"small": "url"}}
+
+	if err := exporter.BeginTable("users", &database.User{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := exporter.WriteRow(user); err != nil {
+		t.Fatal(err)
+	}
+	if err := exporter.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := "id,first_name,last_name,email,role_id,created_at,profile_image_url\n" +
+		"1,Ada,\"Lovelace, Countess\",ada@mail.com,1,2024-01-02T03:04:05Z,\n"
+	if out.String() != expected {
+		t.Errorf("Expected\n%s\ngot\n%s", expected, out.String())
+	}
+}
+
+func TestNDJSONArchive(t *testing.T) {
+	var out bytes.Buffer
+	tables := []string{"books", "reviews"}
+	exporter, err := New(&out, FormatNDJSON, tables)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	exporter.BeginTable("books", &database.Book{})
+	exporter.WriteRow(&database.Book{ID: 1, Title: "Dune"})
+	exporter.WriteRow(&database.Book{ID: 2, Title: "Emma"})
+	exporter.BeginTable("reviews", &database.BookReview{})
+	if err := exporter.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	archive, err := zip.NewReader(bytes.NewReader(out.Bytes()), int64(out.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(archive.File) != 2 || archive.File[0].Name != "books.ndjson" || archive.File[1].Name != "reviews.ndjson" {
+		t.Fatalf("Expected a file per table, got %v", archive.File)
+	}
+
+	books, _ := archive.File[0].Open()
+	content, _ := io.ReadAll(books)
+	if lines := strings.Split(strings.TrimSpace(string(content)), "\n"); len(lines) != 2 || !strings.Contains(lines[1], `"title":"Emma"`) {
+		t.Errorf("Expected a line per book, got %q", content)
+	}
+
+	if FileName(tables, FormatNDJSON) != "go_reads_export.zip" || ContentType(tables, FormatNDJSON) != "application/zip" {
+		t.Error("Expected several tables to be downloaded as a zip archive")
+	}
+}
+
+func TestUnknownFormat(t *testing.T) {
+	if _, err := New(io.Discard, "xlsx", database.ExportTables); err == nil {
+		t.Error("Expected an unknown format to be rejected")
+	}
+}
@@ -0,0 +1,245 @@
+package genres
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kaanserin/go-reads/internal/books"
+	"github.com/kaanserin/go-reads/internal/config"
+	"github.com/kaanserin/go-reads/internal/database"
+	"github.com/kaanserin/go-reads/internal/middleware"
+	"github.com/kaanserin/go-reads/internal/render"
+	"github.com/kaanserin/go-reads/internal/utils"
+	"gopkg.in/validator.v2"
+)
+
+func AddGenresRoutes(r *gin.Engine, cfg *config.Config, covers *books.BookCovers) {
+	genresGroup := r.Group("genres")
+
+	genresGroup.Use(middleware.Authentication(cfg.Auth.AppKey))
+
+	genresGroup.GET("/", utils.MakeHandlerFunc(getGenres))
+	genresGroup.POST("/", middleware.AuthorizeRoles("admin", "librarian"), utils.MakeHandlerFunc(createGenre))
+	genresGroup.GET("/:slug", utils.MakeHandlerFunc(getGenreBySlug))
+	genresGroup.GET("/:slug/books", utils.MakeHandlerFunc(getGenreBooks(covers)))
+	genresGroup.PUT("/:slug", middleware.AuthorizeRoles("admin", "librarian"), utils.MakeHandlerFunc(updateGenreBySlug))
+	genresGroup.DELETE("/:slug", middleware.AuthorizeAdmin(), utils.MakeHandlerFunc(deleteGenreBySlug))
+}
+
+// GenreResponse is a genre with the path of genres above it, for breadcrumbs such as Fiction > Fantasy
+type GenreResponse struct {
+	*database.Genre
+	Ancestors []*database.Genre `json:"ancestors"`
+}
+
+var nonSlugCharacters = regexp.MustCompile(`[^a-z0-9]+`)
+
+// slugify derives the URL slug of a genre name, "Science Fiction & Fantasy" becomes "science-fiction-fantasy".
+// It matches the slugs the genres migration derived from the old free text genres.
+func slugify(name string) string {
+	return strings.Trim(nonSlugCharacters.ReplaceAllString(strings.ToLower(strings.TrimSpace(name)), "-"), "-")
+}
+
+// buildTree nests genres below their parents and returns the top level genres
+func buildTree(genres []*database.Genre) []*database.Genre {
+	byId := make(map[int]*database.Genre, len(genres))
+	for _, genre := range genres {
+		byId[genre.ID] = genre
+	}
+
+	roots := make([]*database.Genre, 0)
+	for _, genre := range genres {
+		var parent *database.Genre
+		if genre.ParentID != nil {
+			parent = byId[*genre.ParentID]
+		}
+
+		if parent != nil {
+			parent.Children = append(parent.Children, genre)
+		} else {
+			roots = append(roots, genre)
+		}
+	}
+
+	return roots
+}
+
+func validateGenreDto(genreDto *database.GenreDto) error {
+	if err := validator.Validate(genreDto); err != nil {
+		return err
+	}
+
+	genreDto.Name = strings.TrimSpace(genreDto.Name)
+	if genreDto.Slug == "" {
+		genreDto.Slug = genreDto.Name
+	}
+
+	genreDto.Slug = slugify(genreDto.Slug)
+	if genreDto.Name == "" || genreDto.Slug == "" {
+		return &utils.CustomError{
+			Message: "Name needs at least one letter or digit",
+		}
+	}
+
+	return nil
+}
+
+// getGenres returns the taxonomy as a tree, ?flat=true returns it as a list ordered by name
+func getGenres(c *gin.Context) error {
+	storage, err := database.GetPgStorageFromRequest(c.Request)
+	if err != nil {
+		return err
+	}
+
+	genres, err := storage.GetGenres()
+	if err != nil {
+		return err
+	}
+
+	if c.Query("flat") == "true" {
+		return render.Respond(c, http.StatusOK, genres)
+	}
+
+	return render.Respond(c, http.StatusOK, buildTree(genres))
+}
+
+// requireGenre answers 404 when the genre of the route does not exist
+func requireGenre(c *gin.Context, storage *database.PostgresqlStorage) (*database.Genre, error) {
+	genre, err := storage.GetGenreBySlug(c.Param("slug"))
+	if errors.Is(err, sql.ErrNoRows) {
+		c.JSON(http.StatusNotFound, utils.CustomError{
+			Message: "Genre not found",
+		})
+
+		return nil, nil
+	}
+
+	return genre, err
+}
+
+func getGenreBySlug(c *gin.Context) error {
+	storage, err := database.GetPgStorageFromRequest(c.Request)
+	if err != nil {
+		return err
+	}
+
+	genre, err := requireGenre(c, storage)
+	if err != nil || genre == nil {
+		return err
+	}
+
+	ancestors, err := storage.GetGenreAncestors(genre.ID)
+	if err != nil {
+		return err
+	}
+
+	return render.Respond(c, http.StatusOK, GenreResponse{
+		Genre:     genre,
+		Ancestors: ancestors,
+	})
+}
+
+func getGenreBooks(covers *books.BookCovers) func(c *gin.Context) error {
+	return func(c *gin.Context) error {
+		storage, err := database.GetPgStorageFromRequest(c.Request)
+		if err != nil {
+			return err
+		}
+
+		genre, err := requireGenre(c, storage)
+		if err != nil || genre == nil {
+			return err
+		}
+
+		genreBooks, err := storage.GetBooksByGenreId(genre.ID, c.Request)
+		if err != nil {
+			return err
+		}
+
+		covers.ResolveAll(c.Request.Context(), genreBooks)
+		return render.Respond(c, http.StatusOK, genreBooks)
+	}
+}
+
+func createGenre(c *gin.Context) error {
+	genreDto := &database.GenreDto{}
+	if err := json.NewDecoder(c.Request.Body).Decode(genreDto); err != nil {
+		return err
+	}
+
+	if err := validateGenreDto(genreDto); err != nil {
+		return err
+	}
+
+	storage, err := database.GetPgStorageFromRequest(c.Request)
+	if err != nil {
+		return err
+	}
+
+	genre, err := storage.CreateGenre(genreDto)
+	if err != nil {
+		return err
+	}
+
+	c.JSON(http.StatusCreated, genre)
+	return nil
+}
+
+func updateGenreBySlug(c *gin.Context) error {
+	genreDto := &database.GenreDto{}
+	if err := json.NewDecoder(c.Request.Body).Decode(genreDto); err != nil {
+		return err
+	}
+
+	if err := validateGenreDto(genreDto); err != nil {
+		return err
+	}
+
+	storage, err := database.GetPgStorageFromRequest(c.Request)
+	if err != nil {
+		return err
+	}
+
+	genre, err := storage.UpdateGenreBySlug(c.Param("slug"), genreDto)
+	if errors.Is(err, sql.ErrNoRows) {
+		c.JSON(http.StatusNotFound, utils.CustomError{
+			Message: "Genre not found",
+		})
+
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	c.JSON(http.StatusOK, genre)
+	return nil
+}
+
+func deleteGenreBySlug(c *gin.Context) error {
+	storage, err := database.GetPgStorageFromRequest(c.Request)
+	if err != nil {
+		return err
+	}
+
+	err = storage.DeleteGenreBySlug(c.Param("slug"))
+	if errors.Is(err, sql.ErrNoRows) {
+		c.JSON(http.StatusNotFound, utils.CustomError{
+			Message: "Genre not found",
+		})
+
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	c.JSON(http.StatusOK, utils.MessageResponse{
+		Message: "Genre deleted successfully",
+	})
+
+	return nil
+}
@@ -0,0 +1,51 @@
+package genres
+
+import (
+	"testing"
+
+	"github.com/kaanserin/go-reads/internal/database"
+)
+
+func TestSlugify(t *testing.T) {
+	tests := map[string]string{
+		"Fantasy":                     "fantasy",
+		"Epic Fantasy":                "epic-fantasy",
+		" Science Fiction & Fantasy ": "science-fiction-fantasy",
+		"Children's":                  "children-s",
+		"--Non-Fiction--":             "non-fiction",
+		"!!!":                         "",
+	}
+
+	for name, expected := range tests {
+		if slug := slugify(name); slug != expected {
+			t.Errorf("Expected slug of %q to be %q, got %q", name, expected, slug)
+		}
+	}
+}
+
+func TestBuildTree(t *testing.T) {
+	parentId := func(id int) *int {
+		return &id
+	}
+
+	genres := []*database.Genre{
+		{ID: 3, Name: "Epic Fantasy", ParentID: parentId(2)},
+		{ID: 2, Name: "Fantasy", ParentID: parentId(1)},
+		{ID: 1, Name: "Fiction"},
+		{ID: 4, Name: "History"},
+	}
+
+	roots := buildTree(genres)
+	if len(roots) != 2 || roots[0].Name != "Fiction" || roots[1].Name != "History" {
+		t.Fatalf("Expected Fiction and History at the top, got %v", roots)
+	}
+
+	fantasy := roots[0].Children
+	if len(fantasy) != 1 || fantasy[0].Name != "Fantasy" {
+		t.Fatalf("Expected Fantasy below Fiction, got %v", fantasy)
+	}
+
+	if len(fantasy[0].Children) != 1 || fantasy[0].Children[0].Name != "Epic Fantasy" {
+		t.Errorf("Expected Epic Fantasy below Fantasy, got %v", fantasy[0].Children)
+	}
+}
@@ -0,0 +1,285 @@
+package goodreads
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/kaanserin/go-reads/internal/bookimport"
+	"github.com/kaanserin/go-reads/internal/database"
+	"github.com/kaanserin/go-reads/internal/reviewtext"
+)
+
+// Columns of the Goodreads library export, in their order
+var columns = []string{
+	"Book Id", "Title", "Author", "Author l-f", "Additional Authors", "ISBN", "ISBN13", "My Rating", "Average Rating",
+	"Publisher", "Binding", "Number of Pages", "Year Published", "Original Publication Year", "Date Read", "Date Added",
+	"Bookshelves", "Bookshelves with positions", "Exclusive Shelf", "My Review", "Spoiler", "Private Notes", "Read Count", "Owned Copies",
+}
+
+const dateLayout = "2006/01/02"
+
+// Longest shelf name, shelf_entries.shelf is a VARCHAR(50)
+const maxShelfLength = 50
+
+// seriesSuffix matches the series Goodreads appends to titles, as in "The Hobbit (Middle-earth, #0)"
+var seriesSuffix = regexp.MustCompile(`\s*\([^()]*#[0-9.\-]+\)$`)
+
+// Row is a parsed library row, Errors lists why it can not be imported
+type Row struct {
+	Line   int
+	Import *database.LibraryImportRow
+	Title  string
+	Author string
+	Errors []string
+}
+
+// Parse reads a Goodreads library export. Rows that can not be parsed are returned with their errors,
+// as are rows with reviews longer than maxReviewLength characters.
+func Parse(r io.Reader, now time.Time, maxReviewLength int) ([]*Row, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+
+	header, err := reader.Read()
+	if errors.Is(err, io.EOF) {
+		return []*Row{}, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	index := make(map[string]int, len(header))
+	for i, name := range header {
+		index[strings.TrimSpace(strings.TrimPrefix(name, "\ufeff"))] = i
+	}
+
+	for _, required := range []string{"Title", "Author"} {
+		if _, ok := index[required]; !ok {
+			return nil, fmt.Errorf("the file has no %s column, is it a Goodreads library export?", required)
+		}
+	}
+
+	rows := make([]*Row, 0)
+	for {
+		fields, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+
+		// FieldPos is only valid after a successful Read
+		var parseErr *csv.ParseError
+		if errors.As(err, &parseErr) {
+			rows = append(rows, &Row{Line: parseErr.Line, Errors: []string{parseErr.Err.Error()}})
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+
+		line, _ := reader.FieldPos(0)
+
+		field := func(name string) string {
+			if i, ok := index[name]; ok && i < len(fields) {
+				return strings.TrimSpace(fields[i])
+			}
+
+			return ""
+		}
+
+		rows = append(rows, newRow(line, field, now, maxReviewLength))
+	}
+
+	return rows, nil
+}
+
+func newRow(line int, field func(name string) string, now time.Time, maxReviewLength int) *Row {
+	row := &Row{Line: line, Title: field("Title"), Author: field("Author")}
+	entry := &database.LibraryEntry{Shelves: []string{}, DateAdded: now}
+	row.Import = &database.LibraryImportRow{Line: line, Author: row.Author, Entry: entry}
+
+	if row.Title == "" {
+		row.Errors = append(row.Errors, "Title is required")
+	}
+
+	if row.Author == "" {
+		row.Errors = append(row.Errors, "Author is required")
+	}
+
+	title := strings.ToLower(row.Title)
+	row.Import.Titles = []string{title}
+	if stripped := seriesSuffix.ReplaceAllString(title, ""); stripped != title {
+		row.Import.Titles = append(row.Import.Titles, stripped)
+	}
+
+	// Goodreads writes ISBNs as spreadsheet formulas, ="0261103571"
+	for _, name := range []string{"ISBN13", "ISBN"} {
+		value := strings.Trim(field(name), `="`)
+		if isbn, err := bookimport.NormalizeISBN(value); err == nil {
+			row.Import.ISBNs = append(row.Import.ISBNs, isbn)
+		}
+	}
+
+	if rating := field("My Rating"); rating != "" {
+		score, err := strconv.Atoi(rating)
+		if err != nil || score < 0 || score > 5 {
+			row.Errors = append(row.Errors, fmt.Sprintf("My Rating %s is not a rating from 0 to 5", rating))
+		}
+		entry.Rating = float64(score)
+	}
+
+	review, err := reviewtext.Sanitize(strings.NewReplacer("<br/>", "\n", "<br />", "\n", "<br>", "\n").Replace(field("My Review")), maxReviewLength)
+	if err != nil {
+		row.Errors = append(row.Errors, fmt.Sprintf("My Review: %s", err))
+	}
+	entry.Review = review
+
+	if value := field("Spoiler"); value != "" {
+		spoiler, err := strconv.ParseBool(value)
+		if err != nil {
+			row.Errors = append(row.Errors, fmt.Sprintf("Spoiler %s is not true or false", value))
+		}
+		entry.Spoiler = spoiler
+	}
+
+	if value := field("Date Added"); value != "" {
+		date, err := time.Parse(dateLayout, value)
+		if err != nil {
+			row.Errors = append(row.Errors, fmt.Sprintf("Date Added %s is not a date such as 2006/01/02", value))
+		}
+		entry.DateAdded = date
+	}
+
+	if value := field("Date Read"); value != "" {
+		date, err := time.Parse(dateLayout, value)
+		if err != nil {
+			row.Errors = append(row.Errors, fmt.Sprintf("Date Read %s is not a date such as 2006/01/02", value))
+		}
+		entry.DateRead = &date
+	}
+
+	// Custom exclusive shelves such as did-not-finish become ordinary shelves
+	shelves := strings.Split(field("Bookshelves"), ",")
+	if exclusive := strings.ToLower(field("Exclusive Shelf")); slices.Contains(database.StatusShelves, exclusive) {
+		entry.Status = exclusive
+	} else {
+		shelves = append(shelves, exclusive)
+	}
+
+	for _, shelf := range shelves {
+		shelf = strings.ToLower(strings.TrimSpace(shelf))
+		if shelf == "" || slices.Contains(database.StatusShelves, shelf) || slices.Contains(entry.Shelves, shelf) {
+			continue
+		}
+
+		if len([]rune(shelf)) > maxShelfLength {
+			row.Errors = append(row.Errors, fmt.Sprintf("shelf %s can be at most %d characters long", shelf, maxShelfLength))
+			continue
+		}
+
+		entry.Shelves = append(entry.Shelves, shelf)
+	}
+
+	return row
+}
+
+// Write writes a library in the Goodreads export format, so it can be imported there or back here
+func Write(w io.Writer, entries []*database.LibraryEntry) error {
+	writer := csv.NewWriter(w)
+	if err := writer.Write(columns); err != nil {
+		return err
+	}
+
+	for _, entry := range entries {
+		if entry.Book == nil {
+			continue
+		}
+
+		if err := writer.Write(record(entry)); err != nil {
+			return err
+		}
+	}
+
+	writer.Flush()
+	return writer.Error()
+}
+
+func record(entry *database.LibraryEntry) []string {
+	book := entry.Book
+
+	isbn, isbn13 := "", ""
+	normalized := strings.NewReplacer("-", "", " ", "").Replace(book.ISBN)
+	if len(normalized) == 13 {
+		isbn13 = normalized
+	} else {
+		isbn = normalized
+	}
+
+	author, additionalAuthors := book.Author, []string{}
+	for _, contributor := range book.Authors {
+		if contributor.Role == database.AuthorRoleAuthor && !strings.EqualFold(contributor.Name, author) {
+			additionalAuthors = append(additionalAuthors, contributor.Name)
+		}
+	}
+
+	dateRead, readCount := "", "0"
+	if entry.DateRead != nil {
+		dateRead = entry.DateRead.Format(dateLayout)
+	}
+
+	if entry.Status == database.ShelfRead {
+		readCount = "1"
+	}
+
+	originalYear := ""
+	if entry.OriginalPublicationDate != nil {
+		originalYear = strconv.Itoa(entry.OriginalPublicationDate.Year())
+	}
+
+	bookshelves := append([]string{}, entry.Shelves...)
+	if entry.Status != "" && entry.Status != database.ShelfRead {
+		bookshelves = append([]string{entry.Status}, bookshelves...)
+	}
+
+	return []string{
+		strconv.Itoa(book.ID),
+		book.Title,
+		author,
+		lastFirst(author),
+		strings.Join(additionalAuthors, ", "),
+		`="` + isbn + `"`,
+		`="` + isbn13 + `"`,
+		// Goodreads ratings are whole stars, half stars round up
+		strconv.Itoa(int(math.Round(entry.Rating))),
+		strconv.FormatFloat(entry.AverageRating, 'f', 2, 64),
+		book.Publisher,
+		book.Format,
+		book.PageCount,
+		strconv.Itoa(book.PublicationDate.Year()),
+		originalYear,
+		dateRead,
+		entry.DateAdded.Format(dateLayout),
+		strings.Join(bookshelves, ", "),
+		"",
+		entry.Status,
+		strings.ReplaceAll(entry.Review, "\n", "<br/>"),
+		strconv.FormatBool(entry.Spoiler),
+		"",
+		readCount,
+		"0",
+	}
+}
+
+// lastFirst turns "J.R.R. Tolkien" into "Tolkien, J.R.R."
+func lastFirst(name string) string {
+	i := strings.LastIndex(name, " ")
+	if i < 0 {
+		return name
+	}
+
+	return name[i+1:] + ", " + name[:i]
+}
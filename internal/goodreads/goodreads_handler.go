@@ -0,0 +1,110 @@
+package goodreads
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kaanserin/go-reads/internal/config"
+	"github.com/kaanserin/go-reads/internal/database"
+	"github.com/kaanserin/go-reads/internal/middleware"
+	"github.com/kaanserin/go-reads/internal/utils"
+)
+
+func AddGoodreadsRoutes(r *gin.Engine, cfg *config.Config) {
+	library := r.Group("library")
+
+	library.Use(middleware.Authentication(cfg.Auth.AppKey))
+
+	library.GET("/goodreads", utils.MakeHandlerFunc(exportLibrary))
+	library.POST("/goodreads", utils.MakeHandlerFunc(importLibrary(cfg)))
+}
+
+// importLibrary adds a Goodreads library export, sent as the "file" form field or as the body, to the library of the user
+func importLibrary(cfg *config.Config) func(c *gin.Context) error {
+	return func(c *gin.Context) error {
+		c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, cfg.Import.MaxUploadBytes)
+
+		var body io.Reader = c.Request.Body
+		if strings.HasPrefix(c.ContentType(), "multipart/") {
+			fileHeader, err := c.FormFile("file")
+			if err != nil {
+				return tooLargeOr(c, err, &utils.CustomError{
+					Message: "Please upload the Goodreads export as the file form field",
+				})
+			}
+
+			file, err := fileHeader.Open()
+			if err != nil {
+				return err
+			}
+			defer file.Close()
+
+			body = file
+		}
+
+		rows, err := Parse(body, time.Now(), cfg.Reviews.MaxLength)
+		if err != nil {
+			return tooLargeOr(c, err, err)
+		}
+
+		if len(rows) == 0 {
+			return &utils.CustomError{
+				Message: "The Goodreads export has no books",
+			}
+		}
+
+		storage, err := database.GetPgStorageFromRequest(c.Request)
+		if err != nil {
+			return err
+		}
+
+		userTmp, _ := c.Get("user")
+		user := userTmp.(*database.User)
+
+		report, err := Run(storage, user.ID, rows)
+		if err != nil {
+			return err
+		}
+
+		c.JSON(http.StatusOK, report)
+		return nil
+	}
+}
+
+// tooLargeOr answers 413 when err comes from an upload over the size limit and returns fallback otherwise
+func tooLargeOr(c *gin.Context, err error, fallback error) error {
+	var maxBytesErr *http.MaxBytesError
+	if !errors.As(err, &maxBytesErr) {
+		return fallback
+	}
+
+	c.JSON(http.StatusRequestEntityTooLarge, utils.CustomError{
+		Message: fmt.Sprintf("Goodreads exports can be at most %d bytes", maxBytesErr.Limit),
+	})
+	return nil
+}
+
+func exportLibrary(c *gin.Context) error {
+	storage, err := database.GetPgStorageFromRequest(c.Request)
+	if err != nil {
+		return err
+	}
+
+	userTmp, _ := c.Get("user")
+	user := userTmp.(*database.User)
+
+	entries, err := storage.GetUserLibrary(user.ID)
+	if err != nil {
+		return err
+	}
+
+	c.Header("Content-Type", "text/csv; charset=utf-8")
+	c.Header("Content-Disposition", `attachment; filename="goodreads_library_export.csv"`)
+	c.Status(http.StatusOK)
+	return Write(c.Writer, entries)
+}
@@ -0,0 +1,182 @@
+package goodreads
+
+import (
+	"bytes"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kaanserin/go-reads/internal/database"
+)
+
+const export = `Book Id,Title,Author,Author l-f,Additional Authors,ISBN,ISBN13,My Rating,Average Rating,Publisher,Binding,Number of Pages,Year Published,Original Publication Year,Date Read,Date Added,Bookshelves,Bookshelves with positions,Exclusive Shelf,My Review,Spoiler,Private Notes,Read Count,Owned Copies
+5907,"The Hobbit (Middle-earth Universe, #0)",J.R.R. Tolkien,"Tolkien, J.R.R.",,"=""0261103571""","=""9780261103573""",5,4.28,HarperCollins,Paperback,310,1999,1937,2023/05/14,2023/04/01,"classics, favourites",,read,Loved it<br/>Again,,,1,0
+11,Dune,Frank Herbert,"Herbert, Frank",,"=""""","=""""",0,4.25,Ace,Paperback,604,1990,1965,,2024/01/02,did-not-finish,,did-not-finish,,,,0,0
+12,,Nobody,,,,,7,,,,,,,,bad date,,,to-read,,,,0,0
+`
+
+func TestParse(t *testing.T) {
+	now := time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)
+	rows, err := Parse(strings.NewReader(export), now, 10000)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(rows) != 3 {
+		t.Fatalf("Expected 3 rows, got %d", len(rows))
+	}
+
+	hobbit := rows[0]
+	if len(hobbit.Errors) != 0 {
+		t.Fatalf("Expected line 2 to be valid, got %v", hobbit.Errors)
+	}
+
+	if !slices.Equal(hobbit.Import.ISBNs, []string{"9780261103573", "0261103571"}) {
+		t.Errorf("Expected both ISBNs, got %v", hobbit.Import.ISBNs)
+	}
+
+	if !slices.Contains(hobbit.Import.Titles, "the hobbit") {
+		t.Errorf("Expected the title without its series, got %v", hobbit.Import.Titles)
+	}
+
+	entry := hobbit.Import.Entry
+	if entry.Status != database.ShelfRead || !slices.Equal(entry.Shelves, []string{"classics", "favourites"}) {
+		t.Errorf("Unexpected shelves %q %v", entry.Status, entry.Shelves)
+	}
+
+	if entry.Rating != 5 || entry.Review != "Loved it\nAgain" || entry.DateRead == nil || entry.DateRead.Year() != 2023 {
+		t.Errorf("Unexpected entry %+v", entry)
+	}
+
+	dune := rows[1].Import.Entry
+	if len(rows[1].Import.ISBNs) != 0 || dune.Status != "" || !slices.Equal(dune.Shelves, []string{"did-not-finish"}) {
+		t.Errorf("Expected a custom exclusive shelf without ISBNs, got %v %q %v", rows[1].Import.ISBNs, dune.Status, dune.Shelves)
+	}
+
+	if len(rows[2].Errors) != 3 {
+		t.Errorf("Expected line 4 to fail on title, rating and date added, got %v", rows[2].Errors)
+	}
+}
+
+type fakeImporter struct{}
+
+func (fakeImporter) ImportLibrary(userId int, rows []*database.LibraryImportRow) ([]*database.LibraryImportResult, error) {
+	results := make([]*database.LibraryImportResult, 0, len(rows))
+	for _, row := range rows {
+		result := &database.LibraryImportResult{Line: row.Line}
+		if len(row.ISBNs) > 0 {
+			result.BookID = 7
+		}
+		results = append(results, result)
+	}
+
+	return results, nil
+}
+
+func TestRun(t *testing.T) {
+	rows, err := Parse(strings.NewReader(export), time.Now(), 10000)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	report, err := Run(fakeImporter{}, 1, rows)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if report.Matched != 1 || report.Unmatched != 1 || report.Failed != 1 {
+		t.Errorf("Unexpected counts %+v", report)
+	}
+
+	if report.Rows[0].BookID != 7 || report.Rows[1].Status != StatusUnmatched || report.Rows[1].Title != "Dune" {
+		t.Errorf("Unexpected rows %+v %+v", report.Rows[0], report.Rows[1])
+	}
+}
+
+func TestWriteRoundTrip(t *testing.T) {
+	dateRead := time.Date(2023, 5, 14, 0, 0, 0, 0, time.UTC)
+	entries := []*database.LibraryEntry{{
+		BookID:    3,
+		Status:    database.ShelfRead,
+		Shelves:   []string{"classics"},
+		Rating:    4,
+		Review:    "Great\nbook",
+		Spoiler:   true,
+		DateAdded: time.Date(2023, 4, 1, 0, 0, 0, 0, time.UTC),
+		DateRead:  &dateRead,
+		Book: &database.Book{
+			ID: 3, Title: "The Hobbit", Author: "J.R.R. Tolkien", ISBN: "978-0-261-10357-3", PageCount: "310",
+			PublicationDate: time.Date(1999, 1, 1, 0, 0, 0, 0, time.UTC),
+		},
+	}}
+
+	var buffer bytes.Buffer
+	if err := Write(&buffer, entries); err != nil {
+		t.Fatal(err)
+	}
+
+	rows, err := Parse(&buffer, time.Now(), 10000)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(rows) != 1 || len(rows[0].Errors) != 0 {
+		t.Fatalf("Expected the export to parse, got %+v", rows)
+	}
+
+	row := rows[0]
+	if !slices.Equal(row.Import.ISBNs, []string{"9780261103573"}) || row.Title != "The Hobbit" || row.Author != "J.R.R. Tolkien" {
+		t.Errorf("Unexpected book %+v", row.Import)
+	}
+
+	entry := row.Import.Entry
+	if entry.Status != database.ShelfRead || entry.Rating != 4 || entry.Review != "Great\nbook" || !entry.Spoiler || !entry.DateRead.Equal(dateRead) {
+		t.Errorf("Unexpected entry %+v", entry)
+	}
+}
+
+func TestParseReviews(t *testing.T) {
+	header := strings.SplitN(export, "\n", 2)[0]
+	rows, err := Parse(strings.NewReader(header+`
+1,Dune,Frank Herbert,,,,,4,,,,,,,,,,,read,It ends [SPOILER]well[/spoiler],true,,1,0
+2,Emma,Jane Austen,,,,,4,,,,,,,,,,,read,It ends [spoiler]well,,,1,0
+3,Ulysses,James Joyce,,,,,4,,,,,,,,,,,read,,maybe,,1,0
+4,Clarissa,Samuel Richardson,,,,,4,,,,,,,,,,,read,Far far too long to read in one sitting or two,,,1,0
+`), time.Now(), 40)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dune := rows[0]
+	if len(dune.Errors) != 0 || dune.Import.Entry.Review != "It ends [spoiler]well[/spoiler]" || !dune.Import.Entry.Spoiler {
+		t.Errorf("Expected the spoiler flag and sanitized tags, got %+v %v", dune.Import.Entry, dune.Errors)
+	}
+
+	if len(rows[1].Errors) != 1 || len(rows[2].Errors) != 1 || len(rows[3].Errors) != 1 {
+		t.Errorf("Expected an unclosed spoiler, a bad Spoiler value and a long review to be reported, got %v %v %v", rows[1].Errors, rows[2].Errors, rows[3].Errors)
+	}
+}
+
+func TestParseMalformedCSV(t *testing.T) {
+	header := strings.SplitN(export, "\n", 2)[0]
+	rows, err := Parse(strings.NewReader(header+`
+1,"a"b,Frank Herbert,,,,,4,,,,,,,,,,,read,,,,1,0
+2,Emma,Jane Austen,,,,,4,,,,,,,,,,,read,,,,1,0
+`), time.Now(), 10000)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(rows) != 2 {
+		t.Fatalf("Expected 2 rows, got %d", len(rows))
+	}
+
+	if rows[0].Line != 2 || len(rows[0].Errors) != 1 {
+		t.Errorf("Expected line 2 to fail on its quote, got line %d with %v", rows[0].Line, rows[0].Errors)
+	}
+
+	if rows[1].Line != 3 || len(rows[1].Errors) != 0 || rows[1].Title != "Emma" {
+		t.Errorf("Expected line 3 to be read after the broken row, got %+v", rows[1])
+	}
+}
@@ -0,0 +1,86 @@
+package goodreads
+
+import (
+	"github.com/kaanserin/go-reads/internal/database"
+)
+
+// Statuses of an imported row
+const (
+	StatusMatched   = "matched"
+	StatusUnmatched = "unmatched"
+	StatusFailed    = "failed"
+)
+
+// LibraryImporter adds matched rows to the library of a user, implemented by the database storage
+type LibraryImporter interface {
+	ImportLibrary(userId int, rows []*database.LibraryImportRow) ([]*database.LibraryImportResult, error)
+}
+
+type RowResult struct {
+	Line   int    `json:"line"`
+	Title  string `json:"title"`
+	Author string `json:"author"`
+	Status string `json:"status"`
+	BookID int    `json:"book_id,omitempty"`
+	// Why a failed row was skipped, or what of a matched row was left out
+	Errors []string `json:"errors,omitempty"`
+}
+
+// Report is the per row outcome of a library import, ordered by line
+type Report struct {
+	Total     int          `json:"total"`
+	Matched   int          `json:"matched"`
+	Unmatched int          `json:"unmatched"`
+	Failed    int          `json:"failed"`
+	Rows      []*RowResult `json:"rows"`
+}
+
+// Run imports the valid rows into the library of the user and reports which rows matched none of our books
+func Run(importer LibraryImporter, userId int, rows []*Row) (*Report, error) {
+	report := &Report{Total: len(rows), Rows: make([]*RowResult, 0, len(rows))}
+	results := make(map[int]*RowResult, len(rows))
+	valid := make([]*database.LibraryImportRow, 0, len(rows))
+	for _, row := range rows {
+		result := &RowResult{Line: row.Line, Title: row.Title, Author: row.Author, Status: StatusFailed, Errors: row.Errors}
+		results[row.Line] = result
+		report.Rows = append(report.Rows, result)
+
+		if len(row.Errors) == 0 {
+			valid = append(valid, row.Import)
+		}
+	}
+
+	imported, err := importer.ImportLibrary(userId, valid)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, match := range imported {
+		result := results[match.Line]
+		result.Status = StatusUnmatched
+		if match.BookID != 0 {
+			result.Status = StatusMatched
+			result.BookID = match.BookID
+		}
+	}
+
+	for _, row := range valid {
+		// book_reviews have a score, Goodreads allows reviews without a rating
+		if row.Entry.Rating == 0 && row.Entry.Review != "" && results[row.Line].Status == StatusMatched {
+			results[row.Line].Errors = []string{"the review was not imported since the book has no rating"}
+		}
+	}
+
+	for _, result := range report.Rows {
+		switch result.Status {
+		case StatusMatched:
+			report.Matched++
+		case StatusUnmatched:
+			report.Unmatched++
+		default:
+			report.Failed++
+		}
+	}
+
+	return report, nil
+}
@@ -0,0 +1,96 @@
+package health
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	StatusOK          = "ok"
+	StatusUnavailable = "unavailable"
+)
+
+// Check verifies that a single dependency is reachable
+type Check struct {
+	Name  string
+	Check func(ctx context.Context) error
+}
+
+type CheckResult struct {
+	Status    string  `json:"status"`
+	LatencyMs float64 `json:"latency_ms"`
+	Error     string  `json:"error,omitempty"`
+}
+
+type Response struct {
+	Status string                 `json:"status"`
+	Checks map[string]CheckResult `json:"checks,omitempty"`
+}
+
+// Register Handlers
+func AddHealthRoutes(r *gin.Engine, timeout time.Duration, checks ...Check) {
+	r.GET("/healthz", livenessHandler)
+	r.GET("/readyz", readinessHandler(timeout, checks))
+}
+
+func livenessHandler(c *gin.Context) {
+	c.JSON(http.StatusOK, Response{Status: StatusOK})
+}
+
+func readinessHandler(timeout time.Duration, checks []Check) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(c.Request.Context(), timeout)
+		defer cancel()
+
+		response := RunChecks(ctx, checks)
+		status := http.StatusOK
+		if response.Status != StatusOK {
+			status = http.StatusServiceUnavailable
+		}
+
+		c.JSON(status, response)
+	}
+}
+
+// RunChecks runs all checks concurrently and reports the status of each one
+func RunChecks(ctx context.Context, checks []Check) Response {
+	response := Response{
+		Status: StatusOK,
+		Checks: make(map[string]CheckResult, len(checks)),
+	}
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for _, check := range checks {
+		wg.Add(1)
+		go func(check Check) {
+			defer wg.Done()
+
+			start := time.Now()
+			err := check.Check(ctx)
+			result := CheckResult{
+				Status:    StatusOK,
+				LatencyMs: float64(time.Since(start).Microseconds()) / 1000,
+			}
+
+			if err != nil {
+				result.Status = StatusUnavailable
+				result.Error = err.Error()
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+			response.Checks[check.Name] = result
+			if err != nil {
+				response.Status = StatusUnavailable
+			}
+		}(check)
+	}
+
+	wg.Wait()
+	return response
+}
@@ -0,0 +1,74 @@
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func newTestRouter(checks ...Check) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	AddHealthRoutes(r, time.Second, checks...)
+	return r
+}
+
+func TestLivenessAlwaysOk(t *testing.T) {
+	r := newTestRouter(Check{Name: "database", Check: func(ctx context.Context) error {
+		return errors.New("down")
+	}})
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+
+	if w.Code != http.StatusOK {
+		t.Errorf("Expected status 200, got %d", w.Code)
+	}
+}
+
+func TestReadinessReportsEachDependency(t *testing.T) {
+	r := newTestRouter(
+		Check{Name: "database", Check: func(ctx context.Context) error { return nil }},
+		Check{Name: "object_store", Check: func(ctx context.Context) error { return errors.New("bucket not found") }},
+	)
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+
+	if w.Code != http.StatusServiceUnavailable {
+		t.Errorf("Expected status 503, got %d", w.Code)
+	}
+
+	var response Response
+	if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+		t.Fatal(err)
+	}
+
+	if response.Checks["database"].Status != StatusOK {
+		t.Errorf("Expected database to be ok, got %s", response.Checks["database"].Status)
+	}
+
+	if response.Checks["object_store"].Error != "bucket not found" {
+		t.Errorf("Expected object store error to be reported, got %q", response.Checks["object_store"].Error)
+	}
+}
+
+func TestReadinessRespectsTimeout(t *testing.T) {
+	r := newTestRouter(Check{Name: "database", Check: func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	}})
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+
+	if w.Code != http.StatusServiceUnavailable {
+		t.Errorf("Expected status 503, got %d", w.Code)
+	}
+}
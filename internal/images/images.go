@@ -0,0 +1,239 @@
+package images
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"net/http"
+
+	"github.com/kaanserin/go-reads/internal/utils"
+	"golang.org/x/image/draw"
+	"golang.org/x/image/webp"
+)
+
+const (
+	// Longest side of the re-encoded original
+	maxOriginalDimension = 2048
+	// Refuse to decode images above this many pixels to avoid decompression bombs
+	maxPixels = 40_000_000
+
+	jpegQuality = 85
+
+	OriginalVariant = "original"
+)
+
+var (
+	ErrTooLarge           = errors.New("image is too large")
+	ErrUnsupportedFormat  = &utils.CustomError{Message: "Only JPEG, PNG and WebP images are allowed"}
+	ErrInvalidImage       = &utils.CustomError{Message: "The uploaded file is not a valid image"}
+	ErrTooManyPixels      = &utils.CustomError{Message: "The uploaded image dimensions are too large"}
+	supportedContentTypes = map[string]bool{
+		"image/jpeg": true,
+		"image/png":  true,
+		"image/webp": true,
+	}
+)
+
+type Options struct {
+	// Maximum size of the uploaded file in bytes
+	MaxBytes int64
+	// Edge lengths of the square thumbnails
+	ThumbnailSizes []int
+	// Widths of the renditions that keep the aspect ratio, named "w<width>"
+	Widths []int
+}
+
+// VariantNames lists the names of the variants rendered besides the original
+func (opts Options) VariantNames() []string {
+	names := make([]string, 0, len(opts.ThumbnailSizes)+len(opts.Widths))
+	for _, size := range opts.ThumbnailSizes {
+		names = append(names, fmt.Sprint(size))
+	}
+
+	for _, width := range opts.Widths {
+		names = append(names, fmt.Sprintf("w%d", width))
+	}
+
+	return names
+}
+
+// Variant is one encoded rendition of an uploaded image
+type Variant struct {
+	// "original", the thumbnail edge length such as "256" or the width such as "w300"
+	Name        string
+	ContentType string
+	Extension   string
+	Width       int
+	Height      int
+	Data        []byte
+}
+
+// Process validates an uploaded image by its content, strips its metadata by re-encoding it
+// and renders the original plus one square thumbnail per configured size and one rendition per width
+func Process(r io.Reader, opts Options) ([]*Variant, error) {
+	data, err := io.ReadAll(io.LimitReader(r, opts.MaxBytes+1))
+	if err != nil {
+		return nil, err
+	}
+
+	if int64(len(data)) > opts.MaxBytes {
+		return nil, ErrTooLarge
+	}
+
+	contentType := http.DetectContentType(data)
+	if !supportedContentTypes[contentType] {
+		return nil, ErrUnsupportedFormat
+	}
+
+	img, err := decode(data, contentType)
+	if err != nil {
+		return nil, err
+	}
+
+	if contentType == "image/jpeg" {
+		img = applyOrientation(img, jpegOrientation(data))
+	}
+
+	// JPEG sources stay JPEG, everything else may carry transparency and is stored as PNG
+	encode := encodePNG
+	if contentType == "image/jpeg" {
+		encode = encodeJPEG
+	}
+
+	variants := make([]*Variant, 0, len(opts.ThumbnailSizes)+len(opts.Widths)+1)
+	original, err := encode(OriginalVariant, fit(img, maxOriginalDimension))
+	if err != nil {
+		return nil, err
+	}
+	variants = append(variants, original)
+
+	for _, size := range opts.ThumbnailSizes {
+		thumbnail, err := encode(fmt.Sprint(size), squareThumbnail(img, size))
+		if err != nil {
+			return nil, err
+		}
+
+		variants = append(variants, thumbnail)
+	}
+
+	for _, width := range opts.Widths {
+		rendition, err := encode(fmt.Sprintf("w%d", width), fitWidth(img, width))
+		if err != nil {
+			return nil, err
+		}
+
+		variants = append(variants, rendition)
+	}
+
+	return variants, nil
+}
+
+func decode(data []byte, contentType string) (image.Image, error) {
+	decodeConfig, decodeImage := jpeg.DecodeConfig, jpeg.Decode
+	switch contentType {
+	case "image/png":
+		decodeConfig, decodeImage = png.DecodeConfig, png.Decode
+	case "image/webp":
+		decodeConfig, decodeImage = webp.DecodeConfig, webp.Decode
+	}
+
+	cfg, err := decodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, ErrInvalidImage
+	}
+
+	if cfg.Width <= 0 || cfg.Height <= 0 {
+		return nil, ErrInvalidImage
+	}
+
+	if cfg.Width*cfg.Height > maxPixels {
+		return nil, ErrTooManyPixels
+	}
+
+	img, err := decodeImage(bytes.NewReader(data))
+	if err != nil {
+		return nil, ErrInvalidImage
+	}
+
+	return img, nil
+}
+
+// fit scales the image down so its longest side is at most maxDimension
+func fit(img image.Image, maxDimension int) image.Image {
+	bounds := img.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+	if width <= maxDimension && height <= maxDimension {
+		return img
+	}
+
+	if width >= height {
+		height = height * maxDimension / width
+		width = maxDimension
+	} else {
+		width = width * maxDimension / height
+		height = maxDimension
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, max(width, 1), max(height, 1)))
+	draw.CatmullRom.Scale(dst, dst.Bounds(), img, bounds, draw.Src, nil)
+	return dst
+}
+
+// fitWidth scales the image down to width keeping its aspect ratio, smaller images are not enlarged
+func fitWidth(img image.Image, width int) image.Image {
+	bounds := img.Bounds()
+	if bounds.Dx() <= width {
+		return img
+	}
+
+	height := max(bounds.Dy()*width/bounds.Dx(), 1)
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+	draw.CatmullRom.Scale(dst, dst.Bounds(), img, bounds, draw.Src, nil)
+	return dst
+}
+
+// squareThumbnail crops the centered square of the image and scales it to size
+func squareThumbnail(img image.Image, size int) image.Image {
+	bounds := img.Bounds()
+	edge := min(bounds.Dx(), bounds.Dy())
+	x0 := bounds.Min.X + (bounds.Dx()-edge)/2
+	y0 := bounds.Min.Y + (bounds.Dy()-edge)/2
+	crop := image.Rect(x0, y0, x0+edge, y0+edge)
+
+	dst := image.NewRGBA(image.Rect(0, 0, size, size))
+	draw.CatmullRom.Scale(dst, dst.Bounds(), img, crop, draw.Src, nil)
+	return dst
+}
+
+func encodeJPEG(name string, img image.Image) (*Variant, error) {
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: jpegQuality}); err != nil {
+		return nil, err
+	}
+
+	return newVariant(name, "image/jpeg", ".jpg", img, buf.Bytes()), nil
+}
+
+func encodePNG(name string, img image.Image) (*Variant, error) {
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		return nil, err
+	}
+
+	return newVariant(name, "image/png", ".png", img, buf.Bytes()), nil
+}
+
+func newVariant(name, contentType, extension string, img image.Image, data []byte) *Variant {
+	return &Variant{
+		Name:        name,
+		ContentType: contentType,
+		Extension:   extension,
+		Width:       img.Bounds().Dx(),
+		Height:      img.Bounds().Dy(),
+		Data:        data,
+	}
+}
@@ -0,0 +1,120 @@
+package images
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"strings"
+	"testing"
+)
+
+func newTestImage(width, height int) image.Image {
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			img.Set(x, y, color.RGBA{R: uint8(x), G: uint8(y), B: 128, A: 255})
+		}
+	}
+
+	return img
+}
+
+// withExifOrientation inserts an APP1 segment carrying only the orientation tag after the SOI marker
+func withExifOrientation(jpegData []byte, orientation uint16) []byte {
+	tiff := []byte("MM\x00\x2a\x00\x00\x00\x08")
+	ifd := make([]byte, 2+12+4)
+	binary.BigEndian.PutUint16(ifd[0:], 1)
+	binary.BigEndian.PutUint16(ifd[2:], exifOrientationTag)
+	binary.BigEndian.PutUint16(ifd[4:], 3)
+	binary.BigEndian.PutUint32(ifd[6:], 1)
+	binary.BigEndian.PutUint16(ifd[10:], orientation)
+	payload := append([]byte("Exif\x00\x00"), append(tiff, ifd...)...)
+
+	segment := []byte{0xFF, 0xE1, 0, 0}
+	binary.BigEndian.PutUint16(segment[2:], uint16(len(payload)+2))
+	segment = append(segment, payload...)
+
+	result := append([]byte{}, jpegData[:2]...)
+	result = append(result, segment...)
+	return append(result, jpegData[2:]...)
+}
+
+func TestProcessRendersSquareThumbnails(t *testing.T) {
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, newTestImage(300, 200)); err != nil {
+		t.Fatal(err)
+	}
+
+	variants, err := Process(&buf, Options{MaxBytes: 1 << 20, ThumbnailSizes: []int{64, 128}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(variants) != 3 {
+		t.Fatalf("Expected 3 variants, got %d", len(variants))
+	}
+
+	if variants[0].Name != OriginalVariant || variants[0].Width != 300 || variants[0].Height != 200 {
+		t.Errorf("Unexpected original variant %s %dx%d", variants[0].Name, variants[0].Width, variants[0].Height)
+	}
+
+	for i, size := range []int{64, 128} {
+		variant := variants[i+1]
+		if variant.Width != size || variant.Height != size {
+			t.Errorf("Expected %dx%d thumbnail, got %dx%d", size, size, variant.Width, variant.Height)
+		}
+
+		if variant.ContentType != "image/png" {
+			t.Errorf("Expected PNG thumbnail, got %s", variant.ContentType)
+		}
+	}
+}
+
+func TestProcessRejectsNonImages(t *testing.T) {
+	_, err := Process(strings.NewReader("<html>not an image</html>"), Options{MaxBytes: 1 << 20})
+	if err != ErrUnsupportedFormat {
+		t.Errorf("Expected ErrUnsupportedFormat, got %v", err)
+	}
+}
+
+func TestProcessRejectsLargeFiles(t *testing.T) {
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, newTestImage(64, 64)); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err := Process(&buf, Options{MaxBytes: 100})
+	if !errors.Is(err, ErrTooLarge) {
+		t.Errorf("Expected ErrTooLarge, got %v", err)
+	}
+}
+
+func TestProcessAppliesAndStripsExifOrientation(t *testing.T) {
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, newTestImage(40, 20), nil); err != nil {
+		t.Fatal(err)
+	}
+
+	data := withExifOrientation(buf.Bytes(), 6)
+	if jpegOrientation(data) != 6 {
+		t.Fatalf("Expected orientation 6 to be read back, got %d", jpegOrientation(data))
+	}
+
+	variants, err := Process(bytes.NewReader(data), Options{MaxBytes: 1 << 20})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	original := variants[0]
+	if original.Width != 20 || original.Height != 40 {
+		t.Errorf("Expected rotated 20x40 image, got %dx%d", original.Width, original.Height)
+	}
+
+	if jpegOrientation(original.Data) != 1 {
+		t.Error("Expected EXIF data to be stripped from the stored image")
+	}
+}
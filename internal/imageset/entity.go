@@ -0,0 +1,61 @@
+package imageset
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/kaanserin/go-reads/internal/blobstore"
+	"github.com/kaanserin/go-reads/internal/config"
+	"github.com/kaanserin/go-reads/internal/images"
+)
+
+// Entity describes the images of one kind of record, such as the covers of books.
+// Records only persist the key of their original.
+type Entity[R any] struct {
+	// Name signed into proxy URLs
+	Kind string
+	// Key prefix and proxy route of the images of a record, formatted with its id
+	PrefixFormat    string
+	ProxyPathFormat string
+	Options         images.Options
+	// Image returns the id of a record and the key of its original
+	Image func(record *R) (id int, originalKey string)
+	// SetURLs fills in the resolved URLs of a record, urls is nil without an image
+	SetURLs func(record *R, urls map[string]string)
+}
+
+// Images stores the images of one kind of record and resolves their URLs on records
+type Images[R any] struct {
+	*Store
+	entity Entity[R]
+}
+
+func NewImages[R any](cfg *config.Config, blobStore blobstore.BlobStore, entity Entity[R]) *Images[R] {
+	return &Images[R]{
+		Store: New(cfg, blobStore, entity.Kind, entity.Options, func(id int) string {
+			return fmt.Sprintf(entity.ProxyPathFormat, id)
+		}),
+		entity: entity,
+	}
+}
+
+// Prefix is the key prefix uploads of the record are stored below
+func (i *Images[R]) Prefix(id int) string {
+	return fmt.Sprintf(i.entity.PrefixFormat, id)
+}
+
+// Resolve fills in the loadable URLs of the record's image
+func (i *Images[R]) Resolve(ctx context.Context, record *R) {
+	if record == nil {
+		return
+	}
+
+	id, originalKey := i.entity.Image(record)
+	i.entity.SetURLs(record, i.URLs(ctx, id, originalKey))
+}
+
+func (i *Images[R]) ResolveAll(ctx context.Context, records []*R) {
+	for _, record := range records {
+		i.Resolve(ctx, record)
+	}
+}
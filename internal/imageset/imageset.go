@@ -0,0 +1,374 @@
+package imageset
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"net/http"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kaanserin/go-reads/internal/blobstore"
+	"github.com/kaanserin/go-reads/internal/config"
+	"github.com/kaanserin/go-reads/internal/images"
+	"github.com/kaanserin/go-reads/internal/logging"
+	"github.com/kaanserin/go-reads/internal/utils"
+)
+
+// Store keeps every rendition of uploaded images, such as profile images or book covers,
+// and resolves the URLs clients load them from.
+// Every upload gets its own version directory so clients never see a cached older image:
+// <prefix>/<version>/original.jpg, <prefix>/<version>/64.jpg, <prefix>/<version>/w300.jpg, ...
+// Owners only persist the key of the original, the keys of the other variants are listed in
+// <prefix>/<version>/variants.json so changing the configured sizes does not orphan earlier uploads.
+type Store struct {
+	blobStore blobstore.BlobStore
+	options   images.Options
+	// Name signed into proxy URLs so a signature for one kind of image can not be used for another
+	kind string
+	// Path of the proxy route serving the images of an owner
+	proxyPath func(ownerId int) string
+	// Objects are linked directly below this URL when set
+	publicBaseURL string
+	// Lifetime of presigned and signed proxy URLs
+	urlTTL     time.Duration
+	signingKey []byte
+
+	// Variant keys by original key, uploads never change so their manifests are cached for good
+	manifestsMu sync.Mutex
+	manifests   map[string]map[string]string
+}
+
+// Name of the manifest listing the variant keys of an upload, next to its original
+const manifestName = "variants.json"
+
+// Manifests cached at most, the cache starts over once it is full
+const maxCachedManifests = 10000
+
+func New(cfg *config.Config, blobStore blobstore.BlobStore, kind string, options images.Options, proxyPath func(ownerId int) string) *Store {
+	return &Store{
+		blobStore:     blobStore,
+		options:       options,
+		kind:          kind,
+		proxyPath:     proxyPath,
+		publicBaseURL: cfg.BlobStore.PublicBaseURL,
+		urlTTL:        cfg.BlobStore.URLTTL,
+		signingKey:    []byte(cfg.Auth.AppKey),
+	}
+}
+
+func (s *Store) Options() images.Options {
+	return s.options
+}
+
+// Upload processes the image, stores every variant below prefix and returns the key of the original
+func (s *Store) Upload(ctx context.Context, prefix string, file io.Reader) (string, error) {
+	variants, err := images.Process(file, s.options)
+	if err != nil {
+		return "", err
+	}
+
+	version, err := newVersion()
+	if err != nil {
+		return "", err
+	}
+
+	keys := make(map[string]string, len(variants))
+	storedKeys := make([]string, 0, len(variants)+1)
+	for _, variant := range variants {
+		key := fmt.Sprintf("%s/%s/%s%s", prefix, version, variant.Name, variant.Extension)
+		if err := s.blobStore.Put(ctx, key, bytes.NewReader(variant.Data), variant.ContentType); err != nil {
+			// Do not leave a partial set of variants behind
+			s.deleteKeys(ctx, storedKeys)
+			return "", err
+		}
+
+		storedKeys = append(storedKeys, key)
+		keys[variant.Name] = key
+	}
+
+	manifest, err := json.Marshal(keys)
+	if err != nil {
+		s.deleteKeys(ctx, storedKeys)
+		return "", err
+	}
+
+	originalKey := keys[images.OriginalVariant]
+	if err := s.blobStore.Put(ctx, manifestKey(originalKey), bytes.NewReader(manifest), "application/json"); err != nil {
+		s.deleteKeys(ctx, storedKeys)
+		return "", err
+	}
+
+	s.cacheManifest(originalKey, keys)
+	return originalKey, nil
+}
+
+// Size allowance for the multipart boundaries and headers around an uploaded file
+const multipartOverhead = 64 << 10
+
+// UploadFromRequest stores the image sent in the "image" form field below prefix.
+// Files above the size limit are answered with 413 directly, the returned key is empty in that case.
+func (s *Store) UploadFromRequest(c *gin.Context, prefix string) (string, error) {
+	tooLarge := func() (string, error) {
+		c.JSON(http.StatusRequestEntityTooLarge, utils.CustomError{
+			Message: fmt.Sprintf("Image must be smaller than %d bytes", s.options.MaxBytes),
+		})
+
+		return "", nil
+	}
+
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, s.options.MaxBytes+multipartOverhead)
+	imageFile, fileHeaders, err := c.Request.FormFile("image")
+	var maxBytesErr *http.MaxBytesError
+	if errors.As(err, &maxBytesErr) || (err == nil && fileHeaders.Size > s.options.MaxBytes) {
+		return tooLarge()
+	}
+
+	if err != nil {
+		return "", err
+	}
+	defer imageFile.Close()
+
+	key, err := s.Upload(c.Request.Context(), prefix, imageFile)
+	if errors.Is(err, images.ErrTooLarge) {
+		return tooLarge()
+	}
+
+	return key, err
+}
+
+// VariantKeys returns the keys of every variant stored for an upload, keyed by variant name.
+// They are read from the manifest of the upload, uploads from before manifests were written derive them
+// from the configured sizes and images uploaded before variants existed only have the original.
+func (s *Store) VariantKeys(ctx context.Context, originalKey string) map[string]string {
+	if originalKey == "" {
+		return map[string]string{}
+	}
+
+	s.manifestsMu.Lock()
+	keys, ok := s.manifests[originalKey]
+	s.manifestsMu.Unlock()
+	if ok {
+		return maps.Clone(keys)
+	}
+
+	keys, err := s.readManifest(ctx, originalKey)
+	if errors.Is(err, blobstore.ErrNotFound) {
+		keys = s.derivedKeys(originalKey)
+	} else if err != nil {
+		// The original is always there, do not cache so the manifest is read again next time
+		logging.FromContext(ctx).Warn("failed to read image manifest", "key", originalKey, "error", err)
+		return map[string]string{images.OriginalVariant: originalKey}
+	}
+
+	s.cacheManifest(originalKey, keys)
+	return maps.Clone(keys)
+}
+
+func (s *Store) readManifest(ctx context.Context, originalKey string) (map[string]string, error) {
+	body, _, err := s.blobStore.Get(ctx, manifestKey(originalKey))
+	if err != nil {
+		return nil, err
+	}
+	defer body.Close()
+
+	keys := make(map[string]string)
+	if err := json.NewDecoder(body).Decode(&keys); err != nil {
+		return nil, err
+	}
+
+	keys[images.OriginalVariant] = originalKey
+	return keys, nil
+}
+
+// derivedKeys guesses the variant keys of uploads without a manifest from the configured sizes,
+// Serve falls back to the original when one of them was never stored
+func (s *Store) derivedKeys(originalKey string) map[string]string {
+	keys := map[string]string{images.OriginalVariant: originalKey}
+	dir, file := path.Split(originalKey)
+	ext := path.Ext(file)
+	if strings.TrimSuffix(file, ext) != images.OriginalVariant {
+		return keys
+	}
+
+	for _, name := range s.options.VariantNames() {
+		keys[name] = dir + name + ext
+	}
+
+	return keys
+}
+
+func (s *Store) cacheManifest(originalKey string, keys map[string]string) {
+	s.manifestsMu.Lock()
+	defer s.manifestsMu.Unlock()
+
+	if s.manifests == nil || len(s.manifests) >= maxCachedManifests {
+		s.manifests = make(map[string]map[string]string)
+	}
+	s.manifests[originalKey] = keys
+}
+
+func manifestKey(originalKey string) string {
+	return path.Dir(originalKey) + "/" + manifestName
+}
+
+// DeleteVariants removes every variant of an upload along with its manifest, failures are only logged
+func (s *Store) DeleteVariants(ctx context.Context, originalKey string) {
+	if originalKey == "" {
+		return
+	}
+
+	keys := make([]string, 0)
+	for _, key := range s.VariantKeys(ctx, originalKey) {
+		keys = append(keys, key)
+	}
+
+	s.deleteKeys(ctx, append(keys, manifestKey(originalKey)))
+
+	s.manifestsMu.Lock()
+	delete(s.manifests, originalKey)
+	s.manifestsMu.Unlock()
+}
+
+func (s *Store) deleteKeys(ctx context.Context, keys []string) {
+	for _, key := range keys {
+		if err := s.blobStore.Delete(ctx, key); err != nil {
+			logging.FromContext(ctx).Warn("failed to delete image", "key", key, "error", err)
+		}
+	}
+}
+
+// URLs resolves the URL of every variant of the image keyed by variant name, nil without an image
+func (s *Store) URLs(ctx context.Context, ownerId int, originalKey string) map[string]string {
+	keys := s.VariantKeys(ctx, originalKey)
+	if len(keys) == 0 {
+		return nil
+	}
+
+	urls := make(map[string]string, len(keys))
+	for variant, key := range keys {
+		resolved, err := s.url(ctx, ownerId, variant, key)
+		if err != nil {
+			logging.FromContext(ctx).Warn("failed to resolve image url", "key", key, "error", err)
+			continue
+		}
+
+		urls[variant] = resolved
+	}
+
+	return urls
+}
+
+// url links the object publicly when a base URL is configured, presigns it when the store supports it
+// and otherwise falls back to a signed URL of the proxy route
+func (s *Store) url(ctx context.Context, ownerId int, variant, key string) (string, error) {
+	if s.publicBaseURL != "" {
+		return strings.TrimSuffix(s.publicBaseURL, "/") + "/" + key, nil
+	}
+
+	if presigner, ok := s.blobStore.(blobstore.Presigner); ok {
+		return presigner.PresignGet(ctx, key, s.urlTTL)
+	}
+
+	return s.proxyURL(ownerId, variant, time.Now()), nil
+}
+
+// proxyURL signs a link to the proxy route.
+// The expiry is rounded to the TTL so the URL stays stable, and cacheable, for a while.
+func (s *Store) proxyURL(ownerId int, variant string, now time.Time) string {
+	expires := now.Truncate(s.urlTTL).Add(2 * s.urlTTL).Unix()
+
+	query := url.Values{}
+	query.Set("variant", variant)
+	query.Set("expires", strconv.FormatInt(expires, 10))
+	query.Set("signature", s.sign(ownerId, variant, expires))
+	return s.proxyPath(ownerId) + "?" + query.Encode()
+}
+
+func (s *Store) sign(ownerId int, variant string, expires int64) string {
+	mac := hmac.New(sha256.New, s.signingKey)
+	fmt.Fprintf(mac, "%s:%d:%s:%d", s.kind, ownerId, variant, expires)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// verify checks the signature of a proxy URL and that it has not expired
+func (s *Store) verify(ownerId int, variant, expiresParam, signature string, now time.Time) bool {
+	expires, err := strconv.ParseInt(expiresParam, 10, 64)
+	if err != nil || now.Unix() > expires {
+		return false
+	}
+
+	expected := s.sign(ownerId, variant, expires)
+	return hmac.Equal([]byte(expected), []byte(signature))
+}
+
+// VerifyRequest checks the signature of a proxy request for the owner's images
+func (s *Store) VerifyRequest(c *gin.Context, ownerId int) bool {
+	variant := c.DefaultQuery("variant", images.OriginalVariant)
+	return s.verify(ownerId, variant, c.Query("expires"), c.Query("signature"), time.Now())
+}
+
+// Serve streams the requested variant of a verified proxy request with caching headers.
+// The original is served in place of a variant that is missing from the store.
+func (s *Store) Serve(c *gin.Context, originalKey string) error {
+	variant := c.DefaultQuery("variant", images.OriginalVariant)
+	key, ok := s.VariantKeys(c.Request.Context(), originalKey)[variant]
+	if !ok {
+		c.JSON(http.StatusNotFound, utils.CustomError{
+			Message: "Image not found",
+		})
+
+		return nil
+	}
+
+	// Keys are versioned, so the content behind a key never changes
+	etag := fmt.Sprintf("%q", key)
+	expires, _ := strconv.ParseInt(c.Query("expires"), 10, 64)
+	c.Header("Cache-Control", fmt.Sprintf("private, max-age=%d", max(expires-time.Now().Unix(), 0)))
+	c.Header("ETag", etag)
+	if c.GetHeader("If-None-Match") == etag {
+		c.Status(http.StatusNotModified)
+		return nil
+	}
+
+	body, info, err := s.blobStore.Get(c.Request.Context(), key)
+	if errors.Is(err, blobstore.ErrNotFound) && key != originalKey {
+		body, info, err = s.blobStore.Get(c.Request.Context(), originalKey)
+	}
+
+	if errors.Is(err, blobstore.ErrNotFound) {
+		c.JSON(http.StatusNotFound, utils.CustomError{
+			Message: "Image not found",
+		})
+
+		return nil
+	} else if err != nil {
+		return err
+	}
+	defer body.Close()
+
+	c.DataFromReader(http.StatusOK, info.Size, info.ContentType, body, nil)
+	return nil
+}
+
+func newVersion() (string, error) {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(b), nil
+}
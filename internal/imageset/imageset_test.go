@@ -0,0 +1,214 @@
+package imageset
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"image"
+	"image/png"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kaanserin/go-reads/internal/blobstore"
+	"github.com/kaanserin/go-reads/internal/config"
+	"github.com/kaanserin/go-reads/internal/images"
+)
+
+func newTestStore(publicBaseURL string) (*Store, *blobstore.MemoryStore) {
+	blobStore := blobstore.NewMemoryStore()
+	return &Store{
+		blobStore: blobStore,
+		options: images.Options{
+			MaxBytes:       1 << 20,
+			ThumbnailSizes: []int{64},
+			Widths:         []int{16},
+		},
+		kind: "cover",
+		proxyPath: func(ownerId int) string {
+			return fmt.Sprintf("/books/%d/cover", ownerId)
+		},
+		publicBaseURL: publicBaseURL,
+		urlTTL:        15 * time.Minute,
+		signingKey:    []byte("test-key"),
+	}, blobStore
+}
+
+func testPNG(t *testing.T) *bytes.Buffer {
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, image.NewRGBA(image.Rect(0, 0, 32, 48))); err != nil {
+		t.Fatal(err)
+	}
+
+	return &buf
+}
+
+func TestUploadStoresEveryVariant(t *testing.T) {
+	store, blobStore := newTestStore("https://cdn.example.com/")
+
+	key, err := store.Upload(context.Background(), "covers/book/7", testPNG(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.HasPrefix(key, "covers/book/7/") || !strings.HasSuffix(key, "/original.png") {
+		t.Errorf("Unexpected original key %s", key)
+	}
+
+	if len(blobStore.Keys()) != 4 {
+		t.Errorf("Expected 3 variants and their manifest, got %v", blobStore.Keys())
+	}
+
+	urls := store.URLs(context.Background(), 7, key)
+	if urls["w16"] != "https://cdn.example.com/"+strings.TrimSuffix(key, "original.png")+"w16.png" {
+		t.Errorf("Unexpected w16 variant URL %s", urls["w16"])
+	}
+
+	store.DeleteVariants(context.Background(), key)
+	if len(blobStore.Keys()) != 0 {
+		t.Errorf("Expected every variant to be deleted, got %v", blobStore.Keys())
+	}
+}
+
+func TestVariantKeysOfLegacyImages(t *testing.T) {
+	store, _ := newTestStore("")
+
+	keys := store.VariantKeys(context.Background(), "profile/user/7/profile_image.png")
+	names := make([]string, 0, len(keys))
+	for name := range keys {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	if len(names) != 1 || names[0] != images.OriginalVariant {
+		t.Errorf("Expected only the original for legacy images, got %v", names)
+	}
+
+	if store.URLs(context.Background(), 7, "") != nil {
+		t.Error("Expected no URLs without an image")
+	}
+}
+
+func TestVariantKeysSurviveConfigChanges(t *testing.T) {
+	store, blobStore := newTestStore("https://cdn.example.com/")
+
+	key, err := store.Upload(context.Background(), "covers/book/7", testPNG(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Another process started with different sizes reads the manifest instead of the configuration
+	restarted, _ := newTestStore("https://cdn.example.com/")
+	restarted.blobStore = blobStore
+	restarted.options.Widths = []int{32}
+
+	urls := restarted.URLs(context.Background(), 7, key)
+	if len(urls) != 3 || urls["w16"] == "" || urls["w32"] != "" {
+		t.Errorf("Expected the stored variants, got %v", urls)
+	}
+
+	restarted.DeleteVariants(context.Background(), key)
+	if len(blobStore.Keys()) != 0 {
+		t.Errorf("Expected every variant and the manifest to be deleted, got %v", blobStore.Keys())
+	}
+}
+
+func TestServeFallsBackToTheOriginal(t *testing.T) {
+	store, blobStore := newTestStore("")
+
+	key := "covers/book/7/0123/original.png"
+	if err := blobStore.Put(context.Background(), key, testPNG(t), "image/png"); err != nil {
+		t.Fatal(err)
+	}
+
+	// Uploads from before manifests derive their variant keys, a variant added to the configuration since was never stored
+	recorder := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(recorder)
+	c.Request = httptest.NewRequest(http.MethodGet, "/books/7/cover?variant=w16", nil)
+	if err := store.Serve(c, key); err != nil {
+		t.Fatal(err)
+	}
+
+	if recorder.Code != http.StatusOK || recorder.Header().Get("Content-Type") != "image/png" {
+		t.Errorf("Expected the original, got %d %s", recorder.Code, recorder.Header().Get("Content-Type"))
+	}
+}
+
+type testRecord struct {
+	id   int
+	key  string
+	urls map[string]string
+}
+
+func TestImagesResolve(t *testing.T) {
+	cfg := &config.Config{
+		BlobStore: config.BlobStoreConfig{URLTTL: time.Minute},
+		Auth:      config.AuthConfig{AppKey: "test-key"},
+	}
+	records := NewImages(cfg, blobstore.NewMemoryStore(), Entity[testRecord]{
+		Kind:            "test",
+		PrefixFormat:    "tests/%d/image",
+		ProxyPathFormat: "/tests/%d/image",
+		Options:         images.Options{MaxBytes: 1 << 20},
+		Image:           func(record *testRecord) (int, string) { return record.id, record.key },
+		SetURLs:         func(record *testRecord, urls map[string]string) { record.urls = urls },
+	})
+
+	if records.Prefix(7) != "tests/7/image" {
+		t.Errorf("Unexpected prefix %s", records.Prefix(7))
+	}
+
+	key, err := records.Upload(context.Background(), records.Prefix(7), testPNG(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	resolved := []*testRecord{{id: 7, key: key}, {id: 8}}
+	records.ResolveAll(context.Background(), append(resolved, nil))
+	if !strings.HasPrefix(resolved[0].urls[images.OriginalVariant], "/tests/7/image?") || resolved[1].urls != nil {
+		t.Errorf("Unexpected URLs %v %v", resolved[0].urls, resolved[1].urls)
+	}
+}
+
+func TestProxyURLSignature(t *testing.T) {
+	store, _ := newTestStore("")
+	now := time.Now()
+
+	proxyURL, err := url.Parse(store.proxyURL(7, "64", now))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if proxyURL.Path != "/books/7/cover" {
+		t.Errorf("Unexpected proxy path %s", proxyURL.Path)
+	}
+
+	query := proxyURL.Query()
+	expires, signature := query.Get("expires"), query.Get("signature")
+	if !store.verify(7, "64", expires, signature, now) {
+		t.Error("Expected signature to be valid")
+	}
+
+	if store.verify(8, "64", expires, signature, now) {
+		t.Error("Expected signature to be bound to the owner")
+	}
+
+	if store.verify(7, "w16", expires, signature, now) {
+		t.Error("Expected signature to be bound to the variant")
+	}
+
+	if store.verify(7, "64", expires, signature, now.Add(time.Hour)) {
+		t.Error("Expected signature to expire")
+	}
+
+	other, _ := newTestStore("")
+	other.kind = "profile_image"
+	if other.verify(7, "64", expires, signature, now) {
+		t.Error("Expected signature to be bound to the kind of image")
+	}
+}
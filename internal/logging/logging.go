@@ -0,0 +1,69 @@
+package logging
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"strings"
+)
+
+type contextKey string
+
+const loggerContextKey contextKey = "logger"
+
+const redactedValue = "[REDACTED]"
+
+// Attribute keys whose values must never reach the logs
+var sensitiveKeys = map[string]bool{
+	"password":      true,
+	"accesstoken":   true,
+	"access_token":  true,
+	"authorization": true,
+	"token":         true,
+	"app_key":       true,
+	"secret":        true,
+	"cookie":        true,
+}
+
+func IsSensitiveKey(key string) bool {
+	return sensitiveKeys[strings.ToLower(key)]
+}
+
+// New creates a JSON logger that redacts sensitive attributes
+func New(w io.Writer, level slog.Leveler) *slog.Logger {
+	return slog.New(slog.NewJSONHandler(w, &slog.HandlerOptions{
+		Level:       level,
+		ReplaceAttr: redactAttr,
+	}))
+}
+
+func redactAttr(groups []string, a slog.Attr) slog.Attr {
+	if IsSensitiveKey(a.Key) {
+		return slog.String(a.Key, redactedValue)
+	}
+
+	return a
+}
+
+// ParseLevel converts a level name such as "debug" or "warn" to a slog.Level, defaulting to info
+func ParseLevel(level string) slog.Level {
+	var l slog.Level
+	if err := l.UnmarshalText([]byte(level)); err != nil {
+		return slog.LevelInfo
+	}
+
+	return l
+}
+
+func WithContext(ctx context.Context, logger *slog.Logger) context.Context {
+	return context.WithValue(ctx, loggerContextKey, logger)
+}
+
+// FromContext returns the request scoped logger, falling back to the default logger
+func FromContext(ctx context.Context) *slog.Logger {
+	if logger, ok := ctx.Value(loggerContextKey).(*slog.Logger); ok && logger != nil {
+		return logger
+	}
+
+	return slog.Default()
+}
@@ -0,0 +1,48 @@
+package logging
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"testing"
+)
+
+func TestLoggerRedactsSensitiveAttributes(t *testing.T) {
+	var buf bytes.Buffer
+	logger := New(&buf, slog.LevelInfo)
+
+	logger.Info("sign in", "email", "reader@mail.com", "password", "hunter2",
+		slog.Group("response", "accessToken", "secret-token"))
+
+	var line map[string]any
+	if err := json.Unmarshal(buf.Bytes(), &line); err != nil {
+		t.Fatal(err)
+	}
+
+	if line["email"] != "reader@mail.com" {
+		t.Errorf("Expected email to be logged, got %v", line["email"])
+	}
+
+	if line["password"] != redactedValue {
+		t.Errorf("Expected password to be redacted, got %v", line["password"])
+	}
+
+	response, _ := line["response"].(map[string]any)
+	if response["accessToken"] != redactedValue {
+		t.Errorf("Expected nested access token to be redacted, got %v", response["accessToken"])
+	}
+}
+
+func TestParseLevel(t *testing.T) {
+	if ParseLevel("debug") != slog.LevelDebug {
+		t.Error("Expected debug level")
+	}
+
+	if ParseLevel("WARN") != slog.LevelWarn {
+		t.Error("Expected warn level")
+	}
+
+	if ParseLevel("nonsense") != slog.LevelInfo {
+		t.Error("Expected info level for unknown names")
+	}
+}
@@ -2,7 +2,7 @@ package middleware
 
 import (
 	"net/http"
-	"os"
+	"slices"
 	"strconv"
 	"strings"
 
@@ -12,7 +12,7 @@ import (
 	"github.com/kaanserin/go-reads/internal/utils"
 )
 
-func Authentication() gin.HandlerFunc {
+func Authentication(appKey string) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		authHeader := c.Request.Header.Get("authorization")
 		if authHeader == "" {
@@ -34,7 +34,7 @@ func Authentication() gin.HandlerFunc {
 
 		tokenString := parts[1]
 		token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
-			return []byte(os.Getenv("APP_KEY")), nil
+			return []byte(appKey), nil
 		})
 
 		if err != nil || !token.Valid {
@@ -70,43 +70,52 @@ func Authentication() gin.HandlerFunc {
 			c.AbortWithStatusJSON(http.StatusUnauthorized, utils.CustomError{
 				Message: "Unauthorized",
 			})
+
+			return
 		}
 
 		c.Set("user", user)
+		withUserLogger(c, user)
 		c.Next()
 	}
 }
 
 func AuthorizeAdmin() gin.HandlerFunc {
+	return AuthorizeRoles("admin")
+}
+
+// AuthorizeRoles only lets authenticated users with one of the given roles through
+func AuthorizeRoles(roles ...string) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		userTmp, exists := c.Get("user")
-		if !exists || userTmp == nil {
+		if !HasRole(c, roles...) {
 			c.AbortWithStatusJSON(http.StatusUnauthorized, utils.CustomError{
 				Message: "Unauthorized",
 			})
-		}
 
-		storage, err := database.GetPgStorageFromRequest(c.Request)
-		if err != nil {
-			c.AbortWithStatusJSON(http.StatusUnauthorized, utils.CustomError{
-				Message: "Unauthorized",
-			})
+			return
 		}
 
-		var user = userTmp.(*database.User)
-		role, err := storage.GetRoleById(user.RoleId)
-		if err != nil {
-			c.AbortWithStatusJSON(http.StatusUnauthorized, utils.CustomError{
-				Message: "Unauthorized",
-			})
-		}
+		c.Next()
+	}
+}
 
-		if role.Name != "admin" {
-			c.AbortWithStatusJSON(http.StatusUnauthorized, utils.CustomError{
-				Message: "Unauthorized",
-			})
-		}
+// HasRole tells whether the authenticated user has one of the given roles, for handlers that let owners through as well
+func HasRole(c *gin.Context, roles ...string) bool {
+	userTmp, exists := c.Get("user")
+	if !exists || userTmp == nil {
+		return false
+	}
 
-		c.Next()
+	storage, err := database.GetPgStorageFromRequest(c.Request)
+	if err != nil {
+		return false
 	}
+
+	var user = userTmp.(*database.User)
+	role, err := storage.GetRoleById(user.RoleId)
+	if err != nil {
+		return false
+	}
+
+	return slices.Contains(roles, role.Name)
 }
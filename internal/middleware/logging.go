@@ -0,0 +1,115 @@
+package middleware
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"log/slog"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kaanserin/go-reads/internal/database"
+	"github.com/kaanserin/go-reads/internal/logging"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const RequestIDHeader = "X-Request-ID"
+
+const maxRequestIDLength = 128
+
+// RequestID propagates the incoming X-Request-ID header or generates a new one,
+// and stores a logger tagged with it in the request context
+func RequestID(logger *slog.Logger) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		requestID := c.Request.Header.Get(RequestIDHeader)
+		if !isValidRequestID(requestID) {
+			requestID = newRequestID()
+		}
+
+		c.Set("requestId", requestID)
+		c.Header(RequestIDHeader, requestID)
+
+		requestLogger := logger.With("request_id", requestID)
+		if spanContext := trace.SpanContextFromContext(c.Request.Context()); spanContext.IsValid() {
+			requestLogger = requestLogger.With("trace_id", spanContext.TraceID().String())
+		}
+
+		c.Request = c.Request.WithContext(logging.WithContext(c.Request.Context(), requestLogger))
+		c.Next()
+	}
+}
+
+// RequestLogger writes a single log line for every request once it has been handled
+func RequestLogger() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		c.Next()
+
+		route := c.FullPath()
+		if route == "" {
+			route = "unmatched"
+		}
+
+		attrs := []any{
+			"method", c.Request.Method,
+			"route", route,
+			"path", c.Request.URL.Path,
+			"status", c.Writer.Status(),
+			"latency_ms", float64(time.Since(start).Microseconds()) / 1000,
+			"client_ip", c.ClientIP(),
+		}
+
+		if len(c.Errors) > 0 {
+			attrs = append(attrs, "errors", c.Errors.String())
+		}
+
+		logger := logging.FromContext(c.Request.Context())
+		status := c.Writer.Status()
+		switch {
+		case status >= 500:
+			logger.Error("request handled", attrs...)
+		case status >= 400:
+			logger.Warn("request handled", attrs...)
+		default:
+			logger.Info("request handled", attrs...)
+		}
+	}
+}
+
+// Recovery logs panics through the request logger and responds with a 500
+func Recovery() gin.HandlerFunc {
+	return gin.CustomRecoveryWithWriter(nil, func(c *gin.Context, err any) {
+		logging.FromContext(c.Request.Context()).Error("panic recovered", "error", err)
+		c.AbortWithStatus(500)
+	})
+}
+
+// withUserLogger attaches the authenticated user's id to the request logger
+func withUserLogger(c *gin.Context, user *database.User) {
+	ctx := c.Request.Context()
+	logger := logging.FromContext(ctx).With("user_id", user.ID)
+	c.Request = c.Request.WithContext(logging.WithContext(ctx, logger))
+}
+
+func isValidRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+
+	for _, r := range id {
+		if r < 0x21 || r > 0x7e {
+			return false
+		}
+	}
+
+	return true
+}
+
+func newRequestID() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return strconv.FormatInt(time.Now().UnixNano(), 16)
+	}
+
+	return hex.EncodeToString(b)
+}
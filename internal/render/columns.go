@@ -0,0 +1,176 @@
+package render
+
+import (
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// field is a field of a model as JSON sees it, the fields of embedded structs count as fields of the model
+type field struct {
+	reflect.StructField
+	name      string
+	index     []int
+	omitEmpty bool
+}
+
+// fieldsOf lists the fields of a model struct with their JSON names, leaving out the ones tagged "-"
+func fieldsOf(model reflect.Type) []field {
+	fields := make([]field, 0, model.NumField())
+	for i := 0; i < model.NumField(); i++ {
+		structField := model.Field(i)
+		tag, options, _ := strings.Cut(structField.Tag.Get("json"), ",")
+
+		embedded := structField.Type
+		if embedded.Kind() == reflect.Pointer {
+			embedded = embedded.Elem()
+		}
+
+		if structField.Anonymous && tag == "" && embedded.Kind() == reflect.Struct {
+			for _, inner := range fieldsOf(embedded) {
+				inner.index = append([]int{i}, inner.index...)
+				fields = append(fields, inner)
+			}
+			continue
+		}
+
+		if !structField.IsExported() || tag == "-" {
+			continue
+		}
+
+		if tag == "" {
+			tag = structField.Name
+		}
+
+		fields = append(fields, field{
+			StructField: structField,
+			name:        tag,
+			index:       []int{i},
+			omitEmpty:   slices.Contains(strings.Split(options, ","), "omitempty"),
+		})
+	}
+
+	return fields
+}
+
+// value is the field of the row, invalid when it sits behind a nil embedded pointer
+func (field field) value(row reflect.Value) reflect.Value {
+	value, err := row.FieldByIndexErr(field.index)
+	if err != nil {
+		return reflect.Value{}
+	}
+
+	return value
+}
+
+// Columns are the CSV columns of a model struct
+type Columns []field
+
+// ColumnsOf derives the CSV columns of a model struct. A csv tag renames or, with "-", drops a column.
+// Fields that do not fit a cell, such as the related records books are loaded with, are left out.
+func ColumnsOf(model reflect.Type) Columns {
+	for model.Kind() == reflect.Pointer {
+		model = model.Elem()
+	}
+
+	if model.Kind() != reflect.Struct || model == timeType {
+		return nil
+	}
+
+	columns := make(Columns, 0, model.NumField())
+	for _, field := range fieldsOf(model) {
+		if !scalar(field.Type) {
+			continue
+		}
+
+		if name, ok := field.Tag.Lookup("csv"); ok {
+			field.name = name
+		}
+
+		if field.name != "-" {
+			columns = append(columns, field)
+		}
+	}
+
+	return columns
+}
+
+// Header names the columns
+func (columns Columns) Header() []string {
+	names := make([]string, len(columns))
+	for i, column := range columns {
+		names[i] = column.name
+	}
+
+	return names
+}
+
+// Record formats the columns of a row, nil pointers and zero times are empty cells
+func (columns Columns) Record(row reflect.Value) []string {
+	for row.Kind() == reflect.Pointer || row.Kind() == reflect.Interface {
+		row = row.Elem()
+	}
+
+	cells := make([]string, len(columns))
+	if !row.IsValid() {
+		return cells
+	}
+
+	for i, column := range columns {
+		cells[i] = cell(column.value(row))
+	}
+
+	return cells
+}
+
+func scalar(t reflect.Type) bool {
+	if t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+
+	switch t.Kind() {
+	case reflect.String, reflect.Bool, reflect.Float32, reflect.Float64,
+		reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return true
+	}
+
+	return t == timeType
+}
+
+func cell(value reflect.Value) string {
+	if value.Kind() == reflect.Pointer {
+		value = value.Elem()
+	}
+
+	if !value.IsValid() {
+		return ""
+	}
+
+	if value.Type() == timeType {
+		t := value.Interface().(time.Time)
+		if t.IsZero() {
+			return ""
+		}
+		return t.Format(time.RFC3339)
+	}
+
+	switch value.Kind() {
+	case reflect.String:
+		return value.String()
+	case reflect.Bool:
+		return strconv.FormatBool(value.Bool())
+	case reflect.Float32, reflect.Float64:
+		return strconv.FormatFloat(value.Float(), 'f', -1, 64)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.FormatInt(value.Int(), 10)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return strconv.FormatUint(value.Uint(), 10)
+	}
+
+	return ""
+}
@@ -0,0 +1,118 @@
+// Package render writes responses as JSON, CSV or XML, whichever the client asked for
+package render
+
+import (
+	"encoding/csv"
+	"fmt"
+	"net/http"
+	"reflect"
+	"slices"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/kaanserin/go-reads/internal/utils"
+)
+
+// Response formats
+const (
+	FormatJSON = "json"
+	FormatCSV  = "csv"
+	FormatXML  = "xml"
+)
+
+var Formats = []string{FormatJSON, FormatCSV, FormatXML}
+
+const mimeCSV = "text/csv"
+
+// Negotiate picks the format from ?format= or else the Accept header, JSON is the default
+func Negotiate(c *gin.Context) (string, error) {
+	if format := c.Query("format"); format != "" {
+		format = strings.ToLower(format)
+		if !slices.Contains(Formats, format) {
+			return "", &utils.CustomError{
+				Message: fmt.Sprintf("Format must be one of %s", strings.Join(Formats, ", ")),
+			}
+		}
+
+		return format, nil
+	}
+
+	switch c.NegotiateFormat(binding.MIMEJSON, mimeCSV, binding.MIMEXML, binding.MIMEXML2) {
+	case mimeCSV:
+		return FormatCSV, nil
+	case binding.MIMEXML, binding.MIMEXML2:
+		return FormatXML, nil
+	}
+
+	return FormatJSON, nil
+}
+
+// Respond writes v in the negotiated format. CSV has a row per element of a list, or a single row,
+// with the columns of the model struct. XML mirrors the JSON fields.
+func Respond(c *gin.Context, status int, v any) error {
+	format, err := Negotiate(c)
+	if err != nil {
+		return err
+	}
+
+	c.Header("Vary", "Accept")
+	switch format {
+	case FormatCSV:
+		c.Header("Content-Type", mimeCSV+"; charset=utf-8")
+		c.Status(status)
+		return writeCSV(c.Writer, v)
+	case FormatXML:
+		c.Header("Content-Type", binding.MIMEXML+"; charset=utf-8")
+		c.Status(status)
+		return writeXML(c.Writer, v)
+	}
+
+	c.JSON(status, v)
+	return nil
+}
+
+func writeCSV(w http.ResponseWriter, v any) error {
+	value := reflect.ValueOf(v)
+	for value.Kind() == reflect.Pointer && !value.IsNil() {
+		value = value.Elem()
+	}
+
+	rows := []reflect.Value{value}
+	model := value.Type()
+	if value.Kind() == reflect.Slice || value.Kind() == reflect.Array {
+		rows = make([]reflect.Value, value.Len())
+		for i := range rows {
+			rows[i] = value.Index(i)
+		}
+		model = model.Elem()
+	}
+
+	writer := csv.NewWriter(w)
+	columns := ColumnsOf(model)
+	if columns == nil {
+		// Lists of plain values, such as tag names, are a single column
+		if err := writer.Write([]string{"value"}); err != nil {
+			return err
+		}
+
+		for _, row := range rows {
+			if err := writer.Write([]string{cell(row)}); err != nil {
+				return err
+			}
+		}
+	} else {
+		if err := writer.Write(columns.Header()); err != nil {
+			return err
+		}
+
+		for _, row := range rows {
+			if err := writer.Write(columns.Record(row)); err != nil {
+				return err
+			}
+		}
+	}
+
+	writer.Flush()
+	return writer.Error()
+}
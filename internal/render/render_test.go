@@ -0,0 +1,137 @@
+package render
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kaanserin/go-reads/internal/database"
+)
+
+func respond(t *testing.T, target string, accept string, v any) *httptest.ResponseRecorder {
+	gin.SetMode(gin.TestMode)
+	recorder := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(recorder)
+	c.Request = httptest.NewRequest(http.MethodGet, target, nil)
+	if accept != "" {
+		c.Request.Header.Set("Accept", accept)
+	}
+
+	if err := Respond(c, http.StatusOK, v); err != nil {
+		t.Fatal(err)
+	}
+
+	return recorder
+}
+
+func TestNegotiate(t *testing.T) {
+	tests := []struct {
+		target, accept, format string
+	}{
+		{"/books", "", FormatJSON},
+		{"/books", "*/*", FormatJSON},
+		{"/books", "text/csv", FormatCSV},
+		{"/books", "application/xml;q=0.9, text/html", FormatXML},
+		{"/books?format=CSV", "application/xml", FormatCSV},
+		{"/books", "image/png", FormatJSON},
+	}
+
+	for _, test := range tests {
+		c, _ := gin.CreateTestContext(httptest.NewRecorder())
+		c.Request = httptest.NewRequest(http.MethodGet, test.target, nil)
+		c.Request.Header.Set("Accept", test.accept)
+
+		format, err := Negotiate(c)
+		if err != nil || format != test.format {
+			t.Errorf("%s with Accept %q: expected %s, got %s %v", test.target, test.accept, test.format, format, err)
+		}
+	}
+
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = httptest.NewRequest(http.MethodGet, "/books?format=yaml", nil)
+	if _, err := Negotiate(c); err == nil {
+		t.Error("Expected an unknown format to be rejected")
+	}
+}
+
+var books = []*database.Book{
+	{ID: 1, Title: "Dune", Author: "Frank Herbert", PublicationDate: time.Date(1965, 8, 1, 0, 0, 0, 0, time.UTC), ISBN: "9780441013593", PageCount: "604", WorkID: 3,
+		Authors:   []*database.BookContributor{{AuthorID: 7, Name: "Frank Herbert", Role: "author"}},
+		CoverUrls: map[string]string{"small": "https://covers/1?a=1&b=2"}},
+	{ID: 2, Title: "Emma, Volume \"1\"", Author: "Jane Austen"},
+}
+
+func TestCSV(t *testing.T) {
+	recorder := respond(t, "/books", "text/csv", books)
+	if recorder.Header().Get("Content-Type") != "text/csv; charset=utf-8" {
+		t.Errorf("Expected a CSV content type, got %q", recorder.Header().Get("Content-Type"))
+	}
+
+	lines := strings.Split(strings.TrimSpace(recorder.Body.String()), "\n")
+	if len(lines) != 3 {
+		t.Fatalf("Expected a header and 2 rows, got %q", recorder.Body.String())
+	}
+
+	if lines[0] != "id,title,author,genre,publicationDate,publisher,isbn,pageCount,language,format,work_id" {
+		t.Errorf("Expected the scalar fields as columns, got %s", lines[0])
+	}
+
+	if lines[1] != "1,Dune,Frank Herbert,,1965-08-01T00:00:00Z,,9780441013593,604,,,3" {
+		t.Errorf("Unexpected row %s", lines[1])
+	}
+
+	if !strings.HasPrefix(lines[2], `2,"Emma, Volume ""1""",Jane Austen,,,`) {
+		t.Errorf("Expected quoted cells and an empty zero date, got %s", lines[2])
+	}
+
+	single := respond(t, "/books/1?format=csv", "", books[0])
+	if rows := strings.Split(strings.TrimSpace(single.Body.String()), "\n"); len(rows) != 2 {
+		t.Errorf("Expected a single row for a single book, got %q", single.Body.String())
+	}
+}
+
+func TestXML(t *testing.T) {
+	recorder := respond(t, "/books?format=xml", "", books)
+	body := recorder.Body.String()
+
+	for _, expected := range []string{
+		`<results><book><id>1</id><title>Dune</title>`,
+		`<authors><book_contributor><author_id>7</author_id><name>Frank Herbert</name><role>author</role></book_contributor></authors>`,
+		`<cover_urls><entry key="small">https://covers/1?a=1&amp;b=2</entry></cover_urls>`,
+		`<title>Emma, Volume &#34;1&#34;</title>`,
+	} {
+		if !strings.Contains(body, expected) {
+			t.Errorf("Expected %s in %s", expected, body)
+		}
+	}
+
+	if strings.Contains(body, "cover_image_key") || strings.Count(body, "<authors>") != 1 {
+		t.Errorf("Expected the fields JSON leaves out to be left out, got %s", body)
+	}
+}
+
+func TestEmbeddedFields(t *testing.T) {
+	type genreResponse struct {
+		*database.Genre
+		Ancestors []*database.Genre `json:"ancestors"`
+	}
+
+	response := genreResponse{Genre: &database.Genre{ID: 4, Name: "Fantasy", Slug: "fantasy"}, Ancestors: []*database.Genre{}}
+	body := respond(t, "/genres/fantasy", "application/xml", response).Body.String()
+	if !strings.Contains(body, "<genre_response><id>4</id><name>Fantasy</name><slug>fantasy</slug><created_at>") {
+		t.Errorf("Expected the embedded genre to be flattened, got %s", body)
+	}
+
+	csv := respond(t, "/genres/fantasy?format=csv", "", response).Body.String()
+	if !strings.HasPrefix(csv, "id,name,slug,parent_id,created_at\n4,Fantasy,fantasy,,\n") {
+		t.Errorf("Expected the embedded genre as columns, got %q", csv)
+	}
+
+	empty := respond(t, "/genres/fantasy?format=csv", "", genreResponse{}).Body.String()
+	if !strings.HasPrefix(empty, "id,name,slug,parent_id,created_at\n,,,,\n") {
+		t.Errorf("Expected a nil embedded genre to be empty cells, got %q", empty)
+	}
+}
@@ -0,0 +1,123 @@
+package render
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"reflect"
+	"slices"
+	"strings"
+	"unicode"
+)
+
+// writeXML writes v with the element names and omissions of its JSON encoding. A struct is an element named
+// after its type, lists are a <results> element, map entries are <entry key="..."> elements.
+func writeXML(w io.Writer, v any) error {
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+
+	value := reflect.ValueOf(v)
+	name := "results"
+	if kind := indirect(value).Kind(); kind == reflect.Struct {
+		name = elementName(value.Type())
+	}
+
+	encoder := xml.NewEncoder(w)
+	if err := encodeElement(encoder, xml.StartElement{Name: xml.Name{Local: name}}, value); err != nil {
+		return err
+	}
+
+	return encoder.Flush()
+}
+
+func encodeElement(encoder *xml.Encoder, start xml.StartElement, value reflect.Value) error {
+	value = indirect(value)
+	if !value.IsValid() {
+		return nil
+	}
+
+	if err := encoder.EncodeToken(start); err != nil {
+		return err
+	}
+
+	switch {
+	case value.Type() == timeType || scalar(value.Type()):
+		if err := encoder.EncodeToken(xml.CharData(cell(value))); err != nil {
+			return err
+		}
+	case value.Kind() == reflect.Struct:
+		for _, field := range fieldsOf(value.Type()) {
+			fieldValue := field.value(value)
+			if !fieldValue.IsValid() || (field.omitEmpty && empty(fieldValue)) {
+				continue
+			}
+
+			if err := encodeElement(encoder, xml.StartElement{Name: xml.Name{Local: field.name}}, fieldValue); err != nil {
+				return err
+			}
+		}
+	case value.Kind() == reflect.Slice || value.Kind() == reflect.Array:
+		item := xml.StartElement{Name: xml.Name{Local: elementName(value.Type().Elem())}}
+		for i := 0; i < value.Len(); i++ {
+			if err := encodeElement(encoder, item, value.Index(i)); err != nil {
+				return err
+			}
+		}
+	case value.Kind() == reflect.Map:
+		keys := value.MapKeys()
+		slices.SortFunc(keys, func(a, b reflect.Value) int { return strings.Compare(fmt.Sprint(a), fmt.Sprint(b)) })
+		for _, key := range keys {
+			entry := xml.StartElement{Name: xml.Name{Local: "entry"}, Attr: []xml.Attr{{Name: xml.Name{Local: "key"}, Value: fmt.Sprint(key)}}}
+			if err := encodeElement(encoder, entry, value.MapIndex(key)); err != nil {
+				return err
+			}
+		}
+	}
+
+	return encoder.EncodeToken(start.End())
+}
+
+func indirect(value reflect.Value) reflect.Value {
+	for value.Kind() == reflect.Pointer || value.Kind() == reflect.Interface {
+		value = value.Elem()
+	}
+
+	return value
+}
+
+// empty tells the values omitempty leaves out of JSON
+func empty(value reflect.Value) bool {
+	switch value.Kind() {
+	case reflect.Slice, reflect.Map, reflect.Array, reflect.String:
+		return value.Len() == 0
+	case reflect.Pointer, reflect.Interface:
+		return value.IsNil()
+	case reflect.Struct:
+		return false
+	}
+
+	return value.IsZero()
+}
+
+// elementName names the elements of a type in snake case, BookReview is book_review, plain values are item
+func elementName(t reflect.Type) string {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+
+	if t.Kind() != reflect.Struct || t == timeType || t.Name() == "" {
+		return "item"
+	}
+
+	var name strings.Builder
+	runes := []rune(t.Name())
+	for i, r := range runes {
+		if i > 0 && unicode.IsUpper(r) && (unicode.IsLower(runes[i-1]) || (i+1 < len(runes) && unicode.IsLower(runes[i+1]))) {
+			name.WriteByte('_')
+		}
+		name.WriteRune(unicode.ToLower(r))
+	}
+
+	return name.String()
+}
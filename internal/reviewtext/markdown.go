@@ -0,0 +1,225 @@
+package reviewtext
+
+import (
+	"bytes"
+	"net/url"
+	"slices"
+	"strings"
+
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/parser"
+	"github.com/yuin/goldmark/renderer"
+	"github.com/yuin/goldmark/renderer/html"
+	"github.com/yuin/goldmark/text"
+	"github.com/yuin/goldmark/util"
+)
+
+// Schemes links in reviews may point to, links anywhere else are shown as their text
+var linkSchemes = []string{"http", "https", "mailto"}
+
+// Links in reviews are written by users, search engines should not count them
+const linkRel = "nofollow ugc"
+
+// markdown parses only paragraphs, lists, quotes, emphasis, links and spoilers. Everything else, raw HTML included,
+// stays text and is escaped, goldmark renders no raw HTML unless it is configured with html.WithUnsafe.
+// Indented lines are parsed as code blocks only so that reviewTransformer can turn them back into paragraphs.
+var markdown = goldmark.New(
+	goldmark.WithParser(parser.NewParser(
+		parser.WithBlockParsers(
+			util.Prioritized(parser.NewListParser(), 300),
+			util.Prioritized(parser.NewListItemParser(), 400),
+			util.Prioritized(parser.NewCodeBlockParser(), 500),
+			util.Prioritized(parser.NewBlockquoteParser(), 800),
+			util.Prioritized(parser.NewParagraphParser(), 1000),
+		),
+		parser.WithInlineParsers(
+			util.Prioritized(spoilerParser{}, 100),
+			util.Prioritized(parser.NewLinkParser(), 200),
+			util.Prioritized(parser.NewEmphasisParser(), 500),
+		),
+		parser.WithASTTransformers(util.Prioritized(reviewTransformer{}, 100)),
+	)),
+	goldmark.WithRendererOptions(
+		html.WithHardWraps(),
+		renderer.WithNodeRenderers(util.Prioritized(spoilerRenderer{}, 100)),
+	),
+)
+
+// RenderMarkdown renders the subset of Markdown reviews are written in: paragraphs, emphasis, lists, quotes and links.
+// The result is safe to show as it is.
+func RenderMarkdown(text string) string {
+	var out bytes.Buffer
+	if err := markdown.Convert([]byte(text), &out); err != nil {
+		// Rendering into a buffer does not fail, the escaped text is the fallback all the same
+		return "<p>" + string(util.EscapeHTML([]byte(text))) + "</p>"
+	}
+
+	return out.String()
+}
+
+var (
+	kindSpoilerTag = ast.NewNodeKind("SpoilerTag")
+	kindSpoiler    = ast.NewNodeKind("Spoiler")
+)
+
+// spoilerTag is a [spoiler] or [/spoiler] tag, reviewTransformer pairs the tags into spoiler nodes
+type spoilerTag struct {
+	ast.BaseInline
+	closing bool
+}
+
+func (n *spoilerTag) Kind() ast.NodeKind { return kindSpoilerTag }
+
+func (n *spoilerTag) Dump(source []byte, level int) { ast.DumpHelper(n, source, level, nil, nil) }
+
+// spoiler holds the revealed text of an inline spoiler
+type spoiler struct {
+	ast.BaseInline
+}
+
+func (n *spoiler) Kind() ast.NodeKind { return kindSpoiler }
+
+func (n *spoiler) Dump(source []byte, level int) { ast.DumpHelper(n, source, level, nil, nil) }
+
+type spoilerParser struct{}
+
+func (spoilerParser) Trigger() []byte { return []byte{'['} }
+
+func (spoilerParser) Parse(parent ast.Node, block text.Reader, pc parser.Context) ast.Node {
+	line, _ := block.PeekLine()
+	for _, tag := range []string{spoilerOpen, spoilerClose} {
+		if bytes.HasPrefix(line, []byte(tag)) {
+			block.Advance(len(tag))
+			return &spoilerTag{closing: tag == spoilerClose}
+		}
+	}
+
+	return nil
+}
+
+// reviewTransformer wraps the text between spoiler tags of the same parent in spoiler nodes, tags it can not pair
+// are shown as text. Links get linkRel or are replaced by their text when they point elsewhere than linkSchemes,
+// images are replaced by their alt text and code blocks by paragraphs of their lines.
+type reviewTransformer struct{}
+
+func (reviewTransformer) Transform(document *ast.Document, reader text.Reader, pc parser.Context) {
+	tagParents := make([]ast.Node, 0)
+	links := make([]ast.Node, 0)
+	codeBlocks := make([]*ast.CodeBlock, 0)
+	ast.Walk(document, func(node ast.Node, entering bool) (ast.WalkStatus, error) {
+		if !entering {
+			return ast.WalkContinue, nil
+		}
+
+		switch node := node.(type) {
+		case *spoilerTag:
+			if parent := node.Parent(); !slices.Contains(tagParents, parent) {
+				tagParents = append(tagParents, parent)
+			}
+		case *ast.Link, *ast.Image:
+			links = append(links, node)
+		case *ast.CodeBlock:
+			codeBlocks = append(codeBlocks, node)
+		}
+
+		return ast.WalkContinue, nil
+	})
+
+	for _, parent := range tagParents {
+		pairSpoilerTags(parent)
+	}
+
+	for _, node := range links {
+		if link, ok := node.(*ast.Link); ok && allowedLink(link.Destination) {
+			link.SetAttributeString("rel", []byte(linkRel))
+			continue
+		}
+
+		unwrap(node)
+	}
+
+	for _, codeBlock := range codeBlocks {
+		paragraph := ast.NewParagraph()
+		lines := codeBlock.Lines()
+		for i := 0; i < lines.Len(); i++ {
+			line := lines.At(i)
+			text := ast.NewTextSegment(line.TrimRightSpace(reader.Source()))
+			text.SetSoftLineBreak(i < lines.Len()-1)
+			paragraph.AppendChild(paragraph, text)
+		}
+
+		codeBlock.Parent().ReplaceChild(codeBlock.Parent(), codeBlock, paragraph)
+	}
+}
+
+func pairSpoilerTags(parent ast.Node) {
+	var open *spoilerTag
+	for child := parent.FirstChild(); child != nil; {
+		next := child.NextSibling()
+		tag, ok := child.(*spoilerTag)
+		switch {
+		case !ok:
+		case !tag.closing && open == nil:
+			open = tag
+		case tag.closing && open != nil:
+			wrapped := &spoiler{}
+			for inner := open.NextSibling(); inner != tag; {
+				after := inner.NextSibling()
+				wrapped.AppendChild(wrapped, inner)
+				inner = after
+			}
+
+			parent.ReplaceChild(parent, open, wrapped)
+			parent.RemoveChild(parent, tag)
+			open = nil
+		default:
+			parent.ReplaceChild(parent, tag, tagText(tag))
+		}
+		child = next
+	}
+
+	if open != nil {
+		parent.ReplaceChild(parent, open, tagText(open))
+	}
+}
+
+func tagText(tag *spoilerTag) ast.Node {
+	if tag.closing {
+		return ast.NewString([]byte(spoilerClose))
+	}
+
+	return ast.NewString([]byte(spoilerOpen))
+}
+
+// allowedLink tells whether a destination points to one of linkSchemes once its entities and escapes are resolved
+func allowedLink(destination []byte) bool {
+	parsed, err := url.Parse(string(util.URLEscape(destination, true)))
+	return err == nil && slices.Contains(linkSchemes, strings.ToLower(parsed.Scheme))
+}
+
+// unwrap replaces a node with its children
+func unwrap(node ast.Node) {
+	parent := node.Parent()
+	for child := node.FirstChild(); child != nil; {
+		next := child.NextSibling()
+		parent.InsertBefore(parent, node, child)
+		child = next
+	}
+
+	parent.RemoveChild(parent, node)
+}
+
+type spoilerRenderer struct{}
+
+func (spoilerRenderer) RegisterFuncs(registerer renderer.NodeRendererFuncRegisterer) {
+	registerer.Register(kindSpoiler, func(w util.BufWriter, source []byte, node ast.Node, entering bool) (ast.WalkStatus, error) {
+		if entering {
+			_, _ = w.WriteString(`<span class="spoiler">`)
+		} else {
+			_, _ = w.WriteString("</span>")
+		}
+
+		return ast.WalkContinue, nil
+	})
+}
@@ -0,0 +1,34 @@
+package reviewtext
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/kaanserin/go-reads/internal/database"
+	"github.com/kaanserin/go-reads/internal/utils"
+)
+
+// Sanitize checks a review text written by a user before it is stored: it may be at most maxLength characters long
+// and its spoiler tags have to be well formed
+func Sanitize(text string, maxLength int) (string, error) {
+	text = strings.TrimSpace(text)
+	if length := utf8.RuneCountInString(text); length > maxLength {
+		return "", &utils.CustomError{
+			Message: fmt.Sprintf("Reviews can be at most %d characters long, this one is %d", maxLength, length),
+		}
+	}
+
+	return SanitizeSpoilers(text)
+}
+
+// Prepare readies reviews for a response, their spoilers are redacted unless revealed and their Markdown is rendered as review_html
+func Prepare(reveal bool, reviews ...*database.BookReview) {
+	for _, review := range reviews {
+		if !reveal {
+			redactSpoilers(review)
+		}
+
+		review.ReviewHTML = RenderMarkdown(review.Review)
+	}
+}
@@ -0,0 +1,164 @@
+package reviewtext
+
+import (
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kaanserin/go-reads/internal/database"
+)
+
+func TestSanitizeSpoilers(t *testing.T) {
+	tests := map[string]string{
+		"No spoilers here":                              "No spoilers here",
+		"It ends [SPOILER]badly[/Spoiler].":             "It ends [spoiler]badly[/spoiler].",
+		"[spoiler]a[/spoiler] and [spoiler]b[/spoiler]": "[spoiler]a[/spoiler] and [spoiler]b[/spoiler]",
+		"Empty [spoiler] [/spoiler]span":                "Empty  span",
+	}
+
+	for text, expected := range tests {
+		sanitized, err := SanitizeSpoilers(text)
+		if err != nil || sanitized != expected {
+			t.Errorf("Expected %q to become %q, got %q %v", text, expected, sanitized, err)
+		}
+	}
+
+	for _, text := range []string{"[spoiler]open", "closed[/spoiler]", "[spoiler]a [spoiler]b[/spoiler][/spoiler]"} {
+		if _, err := SanitizeSpoilers(text); err == nil {
+			t.Errorf("Expected %q to be rejected", text)
+		}
+	}
+}
+
+func TestRedactSpoilers(t *testing.T) {
+	inline := &database.BookReview{Review: "Loved it, [spoiler]Snape[/spoiler] was the best. [spoiler]Dumbledore dies[/spoiler]!"}
+	whole := &database.BookReview{Review: "Everybody dies", Spoiler: true}
+	clean := &database.BookReview{Review: "Loved it"}
+
+	for _, review := range []*database.BookReview{inline, whole, clean} {
+		redactSpoilers(review)
+	}
+
+	if inline.Review != "Loved it, [spoiler hidden] was the best. [spoiler hidden]!" || !inline.SpoilersHidden {
+		t.Errorf("Expected inline spoilers to be hidden, got %q", inline.Review)
+	}
+
+	if whole.Review != "" || !whole.SpoilersHidden {
+		t.Errorf("Expected the whole review to be hidden, got %q", whole.Review)
+	}
+
+	if clean.Review != "Loved it" || clean.SpoilersHidden {
+		t.Errorf("Expected a review without spoilers to be kept, got %q", clean.Review)
+	}
+}
+
+func TestRenderMarkdown(t *testing.T) {
+	tests := map[string]string{
+		"Plain text":                               "<p>Plain text</p>",
+		"**Great** and *moving*, __bold__":         "<p><strong>Great</strong> and <em>moving</em>, <strong>bold</strong></p>",
+		"snake_case_name stays":                    "<p>snake_case_name stays</p>",
+		"line one\nline two\n\nnext":               "<p>line one<br>line two</p><p>next</p>",
+		"- one\n- *two*\n\n1. first\n2. second":    "<ul><li>one</li><li><em>two</em></li></ul><ol><li>first</li><li>second</li></ol>",
+		"> quoted\n> more\n\nafter":                "<blockquote><p>quoted<br>more</p></blockquote><p>after</p>",
+		"[site](https://example.com/a?b=1&c=2)":    `<p><a href="https://example.com/a?b=1&amp;c=2" rel="nofollow ugc">site</a></p>`,
+		"[mail](mailto:me@example.com)":            `<p><a href="mailto:me@example.com" rel="nofollow ugc">mail</a></p>`,
+		"# Not a heading\n\n    not code `either`": "<p># Not a heading</p><p>not code `either`</p>",
+		`\*not emphasis\*`:                         "<p>*not emphasis*</p>",
+		"It ends [spoiler]*badly*[/spoiler]":       `<p>It ends <span class="spoiler"><em>badly</em></span></p>`,
+		"[spoiler]one\n\ntwo[/spoiler]":            "<p>[spoiler]one</p><p>two[/spoiler]</p>",
+	}
+
+	for text, expected := range tests {
+		if rendered := strings.ReplaceAll(RenderMarkdown(text), "\n", ""); rendered != expected {
+			t.Errorf("Expected %q to render as %s, got %s", text, expected, rendered)
+		}
+	}
+}
+
+func TestRenderMarkdownAdversarial(t *testing.T) {
+	tests := map[string]string{
+		"[x](javascript:alert(1))":                       "<p>x</p>",
+		"[x](JaVaScRiPt:alert(1))":                       "<p>x</p>",
+		"[x](jav&#x61;script:alert(1))":                  "<p>x</p>",
+		"[x](&#106;avascript&colon;alert(1))":            "<p>x</p>",
+		"[x](<javascript:alert(1)>)":                     "<p>x</p>",
+		"[x](java\\script:alert(1))":                     "<p>x</p>",
+		"[x](data:text/html;base64,PHNjcmlwdD4=)":        "<p>x</p>",
+		"[x](//evil.example.com)":                        "<p>x</p>",
+		"![x](https://example.com/x.png)":                "<p>x</p>",
+		"<img src=x onerror=alert(1)>":                   "<p>&lt;img src=x onerror=alert(1)&gt;</p>",
+		"<script>alert(1)</script>":                      "<p>&lt;script&gt;alert(1)&lt;/script&gt;</p>",
+		"&lt;script&gt;":                                 "<p>&lt;script&gt;</p>",
+		`[x](https://example.com "a\" onmouseover=\"b")`: `<p><a href="https://example.com" title="a&quot; onmouseover=&quot;b" rel="nofollow ugc">x</a></p>`,
+		"[[spoiler]a[/spoiler]](https://example.com)":    `<p><a href="https://example.com" rel="nofollow ugc"><span class="spoiler">a</span></a></p>`,
+	}
+
+	for text, expected := range tests {
+		if rendered := strings.ReplaceAll(RenderMarkdown(text), "\n", ""); rendered != expected {
+			t.Errorf("Expected %q to render as %s, got %s", text, expected, rendered)
+		}
+	}
+
+	// Unmatched and nested markers up to the maximum review length render in linear time
+	for _, marker := range []string{"[", "*", "_", "**[spoiler]*", "[a](", "> - ", "[spoiler]"} {
+		text := strings.Repeat(marker, 10000/len(marker))
+		start := time.Now()
+		checkRendered(t, text, RenderMarkdown(text))
+		if elapsed := time.Since(start); elapsed > time.Second {
+			t.Errorf("Rendering %d times %q took %s", 10000/len(marker), marker, elapsed)
+		}
+	}
+}
+
+// Tags rendered reviews may contain, attribute values are escaped
+var renderedTag = regexp.MustCompile(`^</?(p|br|em|strong|ul|li|blockquote|span|a)>$|^<ol( start="[0-9]+")?>$|^</ol>$|^<span class="spoiler">$|` +
+	`^<a href="(https?|mailto):[^"<>]*"( title="[^"<>]*")? rel="nofollow ugc">$`)
+
+// checkRendered fails when rendered HTML contains markup a review can not produce
+func checkRendered(t *testing.T, text string, rendered string) {
+	for _, tag := range regexp.MustCompile(`<[^>]*>?`).FindAllString(rendered, -1) {
+		if !renderedTag.MatchString(tag) {
+			t.Errorf("Unexpected %s in %s rendered from %q", tag, rendered, text)
+		}
+	}
+
+	for _, tag := range []string{"span", "em", "strong", "a"} {
+		if opened, closed := strings.Count(rendered, "<"+tag+">")+strings.Count(rendered, "<"+tag+" "), strings.Count(rendered, "</"+tag+">"); opened != closed {
+			t.Errorf("Expected every <%s> to be closed in %s rendered from %q", tag, rendered, text)
+		}
+	}
+}
+
+func FuzzRenderMarkdown(f *testing.F) {
+	for _, seed := range []string{"**a** *b* _c_", "[a](https://example.com)", "[a](javascript:alert(1))", "> - [spoiler]x[/spoiler]", "<b>&amp;</b>"} {
+		f.Add(seed)
+	}
+
+	f.Fuzz(func(t *testing.T, text string) {
+		checkRendered(t, text, RenderMarkdown(text))
+	})
+}
+
+func TestSanitize(t *testing.T) {
+	if text, err := Sanitize("  Çok güzel  ", 10); err != nil || text != "Çok güzel" {
+		t.Errorf("Expected the text to be trimmed and fit, got %q %v", text, err)
+	}
+
+	if _, err := Sanitize("Much too long", 5); err == nil {
+		t.Error("Expected a text over the maximum length to be rejected")
+	}
+
+	if _, err := Sanitize("[spoiler]open", 100); err == nil {
+		t.Error("Expected broken spoiler tags to be rejected")
+	}
+}
+
+func TestPrepare(t *testing.T) {
+	review := &database.BookReview{Review: "**Loved** it, [spoiler]Snape[/spoiler]"}
+	Prepare(false, review)
+
+	if review.ReviewHTML != "<p><strong>Loved</strong> it, [spoiler hidden]</p>\n" || !review.SpoilersHidden {
+		t.Errorf("Expected the redacted review to be rendered, got %s", review.ReviewHTML)
+	}
+}
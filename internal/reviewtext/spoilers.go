@@ -0,0 +1,90 @@
+// Package reviewtext checks the markup of review texts and prepares them for readers
+package reviewtext
+
+import (
+	"errors"
+	"regexp"
+	"strings"
+
+	"github.com/kaanserin/go-reads/internal/database"
+)
+
+// Inline spoilers are written as [spoiler]the butler did it[/spoiler]
+const (
+	spoilerOpen  = "[spoiler]"
+	spoilerClose = "[/spoiler]"
+)
+
+// SpoilerPlaceholder replaces the hidden spoilers of a review
+const SpoilerPlaceholder = "[spoiler hidden]"
+
+var spoilerTags = regexp.MustCompile(`(?i)\[(/?)spoiler\]`)
+
+// SanitizeSpoilers checks that spoiler spans are closed and not nested. Tags are lowercased and empty spans dropped.
+func SanitizeSpoilers(text string) (string, error) {
+	var sanitized strings.Builder
+	open := -1
+	last := 0
+	for _, match := range spoilerTags.FindAllStringSubmatchIndex(text, -1) {
+		closing := match[3] > match[2]
+		switch {
+		case !closing && open >= 0:
+			return "", errors.New("spoilers can not be nested, close the [spoiler] before opening another")
+		case closing && open < 0:
+			return "", errors.New("[/spoiler] closes no [spoiler]")
+		case !closing:
+			sanitized.WriteString(text[last:match[0]])
+			open = match[1]
+		default:
+			if content := text[open:match[0]]; strings.TrimSpace(content) != "" {
+				sanitized.WriteString(spoilerOpen + content + spoilerClose)
+			} else {
+				sanitized.WriteString(content)
+			}
+			open = -1
+		}
+		last = match[1]
+	}
+
+	if open >= 0 {
+		return "", errors.New("a [spoiler] is never closed with [/spoiler]")
+	}
+
+	sanitized.WriteString(text[last:])
+	return sanitized.String(), nil
+}
+
+// redactSpoilers hides the spoilers of a review, the whole text of a review flagged as a spoiler
+func redactSpoilers(review *database.BookReview) {
+	if review.Spoiler {
+		review.SpoilersHidden = review.Review != ""
+		review.Review = ""
+		return
+	}
+
+	redacted := redactSpans(review.Review)
+	review.SpoilersHidden = redacted != review.Review
+	review.Review = redacted
+}
+
+// redactSpans replaces the spoiler spans of a sanitized text with the placeholder
+func redactSpans(text string) string {
+	var redacted strings.Builder
+	for {
+		start := strings.Index(text, spoilerOpen)
+		if start < 0 {
+			break
+		}
+
+		end := strings.Index(text[start:], spoilerClose)
+		if end < 0 {
+			break
+		}
+
+		redacted.WriteString(text[:start] + SpoilerPlaceholder)
+		text = text[start+end+len(spoilerClose):]
+	}
+
+	redacted.WriteString(text)
+	return redacted.String()
+}
@@ -0,0 +1,279 @@
+package series
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"math"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kaanserin/go-reads/internal/config"
+	"github.com/kaanserin/go-reads/internal/database"
+	"github.com/kaanserin/go-reads/internal/middleware"
+	"github.com/kaanserin/go-reads/internal/render"
+	"github.com/kaanserin/go-reads/internal/utils"
+	"gopkg.in/validator.v2"
+)
+
+func AddSeriesRoutes(r *gin.Engine, cfg *config.Config) {
+	seriesGroup := r.Group("series")
+
+	seriesGroup.Use(middleware.Authentication(cfg.Auth.AppKey))
+
+	seriesGroup.GET("/", utils.MakeHandlerFunc(getSeries))
+	seriesGroup.POST("/", middleware.AuthorizeRoles("admin", "librarian"), utils.MakeHandlerFunc(createSeries))
+	seriesGroup.GET("/:id", utils.MakeHandlerFunc(getSeriesById))
+	seriesGroup.GET("/:id/next", utils.MakeHandlerFunc(getNextUnreadInSeries))
+	seriesGroup.PUT("/:id", middleware.AuthorizeRoles("admin", "librarian"), utils.MakeHandlerFunc(updateSeriesById))
+	seriesGroup.DELETE("/:id", middleware.AuthorizeAdmin(), utils.MakeHandlerFunc(deleteSeriesById))
+	seriesGroup.PUT("/:id/works/:work_id", middleware.AuthorizeRoles("admin", "librarian"), utils.MakeHandlerFunc(setSeriesWork))
+	seriesGroup.DELETE("/:id/works/:work_id", middleware.AuthorizeRoles("admin", "librarian"), utils.MakeHandlerFunc(removeSeriesWork))
+}
+
+type SeriesWorkDto struct {
+	// Place of the work in the series, fractional for novellas between two books such as 2.5
+	Position *float64 `json:"position"`
+}
+
+// maxPosition is the first position that does not fit NUMERIC(6, 2)
+const maxPosition = 10000
+
+// validatePosition accepts positions with at most two decimals from 0, for prequels, up to maxPosition
+func validatePosition(position *float64) error {
+	if position == nil {
+		return &utils.CustomError{
+			Message: "Position is required",
+		}
+	}
+
+	if *position < 0 || *position >= maxPosition || math.IsNaN(*position) {
+		return &utils.CustomError{
+			Message: "Position must be between 0 and 9999.99",
+		}
+	}
+
+	hundredths := *position * 100
+	if math.Abs(hundredths-math.Round(hundredths)) > 1e-6 {
+		return &utils.CustomError{
+			Message: "Position can have at most two decimals",
+		}
+	}
+
+	return nil
+}
+
+func parseIdParam(c *gin.Context, name string) (int, error) {
+	id, err := strconv.Atoi(c.Param(name))
+	if err != nil {
+		return 0, &utils.CustomError{
+			Message: "Please enter a valid integer for " + name,
+		}
+	}
+
+	return id, nil
+}
+
+func getSeries(c *gin.Context) error {
+	storage, err := database.GetPgStorageFromRequest(c.Request)
+	if err != nil {
+		return err
+	}
+
+	series, err := storage.GetSeries(c.Request)
+	if err != nil {
+		return err
+	}
+
+	return render.Respond(c, http.StatusOK, series)
+}
+
+func getSeriesById(c *gin.Context) error {
+	storage, err := database.GetPgStorageFromRequest(c.Request)
+	if err != nil {
+		return err
+	}
+
+	id, err := parseIdParam(c, "id")
+	if err != nil {
+		return err
+	}
+
+	series, err := storage.GetSeriesById(id)
+	if errors.Is(err, sql.ErrNoRows) {
+		c.JSON(http.StatusNotFound, utils.CustomError{
+			Message: "Series not found",
+		})
+
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	return render.Respond(c, http.StatusOK, series)
+}
+
+// getNextUnreadInSeries suggests the book of the series the current user should read next
+func getNextUnreadInSeries(c *gin.Context) error {
+	storage, err := database.GetPgStorageFromRequest(c.Request)
+	if err != nil {
+		return err
+	}
+
+	id, err := parseIdParam(c, "id")
+	if err != nil {
+		return err
+	}
+
+	userTmp, _ := c.Get("user")
+	user := userTmp.(*database.User)
+
+	entry, err := storage.GetNextUnreadInSeries(id, user.ID)
+	if errors.Is(err, sql.ErrNoRows) {
+		c.JSON(http.StatusNotFound, utils.CustomError{
+			Message: "No unread book left in the series",
+		})
+
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	c.JSON(http.StatusOK, entry)
+	return nil
+}
+
+func createSeries(c *gin.Context) error {
+	seriesDto := &database.SeriesDto{}
+	if err := json.NewDecoder(c.Request.Body).Decode(seriesDto); err != nil {
+		return err
+	}
+
+	if err := validator.Validate(seriesDto); err != nil {
+		return err
+	}
+
+	storage, err := database.GetPgStorageFromRequest(c.Request)
+	if err != nil {
+		return err
+	}
+
+	series, err := storage.CreateSeries(seriesDto)
+	if err != nil {
+		return err
+	}
+
+	c.JSON(http.StatusCreated, series)
+	return nil
+}
+
+func updateSeriesById(c *gin.Context) error {
+	seriesDto := &database.SeriesDto{}
+	if err := json.NewDecoder(c.Request.Body).Decode(seriesDto); err != nil {
+		return err
+	}
+
+	if err := validator.Validate(seriesDto); err != nil {
+		return err
+	}
+
+	storage, err := database.GetPgStorageFromRequest(c.Request)
+	if err != nil {
+		return err
+	}
+
+	id, err := parseIdParam(c, "id")
+	if err != nil {
+		return err
+	}
+
+	series, err := storage.UpdateSeriesById(id, seriesDto)
+	if err != nil {
+		return err
+	}
+
+	c.JSON(http.StatusOK, series)
+	return nil
+}
+
+func deleteSeriesById(c *gin.Context) error {
+	storage, err := database.GetPgStorageFromRequest(c.Request)
+	if err != nil {
+		return err
+	}
+
+	id, err := parseIdParam(c, "id")
+	if err != nil {
+		return err
+	}
+
+	if err := storage.DeleteSeriesById(id); err != nil {
+		return err
+	}
+
+	c.JSON(http.StatusOK, utils.MessageResponse{
+		Message: "Series deleted successfully",
+	})
+
+	return nil
+}
+
+func setSeriesWork(c *gin.Context) error {
+	seriesWorkDto := &SeriesWorkDto{}
+	if err := json.NewDecoder(c.Request.Body).Decode(seriesWorkDto); err != nil {
+		return err
+	}
+
+	if err := validatePosition(seriesWorkDto.Position); err != nil {
+		return err
+	}
+
+	storage, err := database.GetPgStorageFromRequest(c.Request)
+	if err != nil {
+		return err
+	}
+
+	id, err := parseIdParam(c, "id")
+	if err != nil {
+		return err
+	}
+
+	workId, err := parseIdParam(c, "work_id")
+	if err != nil {
+		return err
+	}
+
+	series, err := storage.SetSeriesWork(id, workId, *seriesWorkDto.Position)
+	if err != nil {
+		return err
+	}
+
+	c.JSON(http.StatusOK, series)
+	return nil
+}
+
+func removeSeriesWork(c *gin.Context) error {
+	storage, err := database.GetPgStorageFromRequest(c.Request)
+	if err != nil {
+		return err
+	}
+
+	id, err := parseIdParam(c, "id")
+	if err != nil {
+		return err
+	}
+
+	workId, err := parseIdParam(c, "work_id")
+	if err != nil {
+		return err
+	}
+
+	series, err := storage.RemoveSeriesWork(id, workId)
+	if err != nil {
+		return err
+	}
+
+	c.JSON(http.StatusOK, series)
+	return nil
+}
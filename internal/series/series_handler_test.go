@@ -0,0 +1,27 @@
+package series
+
+import "testing"
+
+func TestValidatePosition(t *testing.T) {
+	position := func(p float64) *float64 {
+		return &p
+	}
+
+	valid := []float64{0, 0.5, 1, 2.5, 3, 12.25, 9999.99}
+	for _, p := range valid {
+		if err := validatePosition(position(p)); err != nil {
+			t.Errorf("Expected %v to be a valid position, got %v", p, err)
+		}
+	}
+
+	invalid := []float64{-1, 2.555, 10000}
+	for _, p := range invalid {
+		if err := validatePosition(position(p)); err == nil {
+			t.Errorf("Expected %v to be rejected", p)
+		}
+	}
+
+	if err := validatePosition(nil); err == nil {
+		t.Error("Expected a missing position to be rejected")
+	}
+}
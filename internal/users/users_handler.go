@@ -1,19 +1,21 @@
 package users
 
 import (
-	"context"
+	"database/sql"
 	"encoding/json"
-	"fmt"
+	"errors"
 	"net/http"
-	"os"
-	"path/filepath"
 	"strconv"
 
-	"github.com/aws/aws-sdk-go-v2/config"
-	"github.com/aws/aws-sdk-go-v2/service/s3"
 	"github.com/gin-gonic/gin"
+	"github.com/kaanserin/go-reads/internal/blobstore"
+	"github.com/kaanserin/go-reads/internal/config"
 	"github.com/kaanserin/go-reads/internal/database"
+	"github.com/kaanserin/go-reads/internal/images"
+	"github.com/kaanserin/go-reads/internal/imageset"
+	"github.com/kaanserin/go-reads/internal/metrics"
 	"github.com/kaanserin/go-reads/internal/middleware"
+	"github.com/kaanserin/go-reads/internal/render"
 	utils "github.com/kaanserin/go-reads/internal/utils"
 	"gopkg.in/validator.v2"
 )
@@ -21,54 +23,85 @@ import (
 var makeHandlerFunc = utils.MakeHandlerFunc
 
 // Router
-func AddUserRoutes(g *gin.Engine) {
+// ProfileImages stores profile images below profile/user/<id>/ and resolves their URLs on users.
+// The users.profile_image_url column holds the key of the original.
+type ProfileImages = imageset.Images[database.User]
+
+func NewProfileImages(cfg *config.Config, blobStore blobstore.BlobStore) *ProfileImages {
+	return imageset.NewImages(cfg, blobStore, imageset.Entity[database.User]{
+		Kind:            "profile_image",
+		PrefixFormat:    "profile/user/%d",
+		ProxyPathFormat: "/users/%d/profile_image",
+		Options: images.Options{
+			MaxBytes:       cfg.Images.MaxUploadBytes,
+			ThumbnailSizes: cfg.Images.ThumbnailSizes,
+		},
+		Image: func(user *database.User) (int, string) {
+			return user.ID, user.ProfileImageKey
+		},
+		SetURLs: func(user *database.User, urls map[string]string) {
+			user.ProfileImageUrls = urls
+			user.ProfileImageUrl = urls[images.OriginalVariant]
+		},
+	})
+}
+
+func AddUserRoutes(g *gin.Engine, cfg *config.Config, profileImages *ProfileImages) {
+	// Loaded by browsers through signed URLs, so it can not require the authorization header
+	g.GET("/users/:id/profile_image", makeHandlerFunc(getUserProfileImage(profileImages)))
+
 	users := g.Group("/users")
 
-	users.Use(middleware.Authentication())
+	users.Use(middleware.Authentication(cfg.Auth.AppKey))
 
-	users.GET("/", middleware.AuthorizeAdmin(), makeHandlerFunc(getUsers))
-	users.GET("/profile", makeHandlerFunc(getUserProfile))
-	users.PUT("/profile", makeHandlerFunc(updateUserProfile))
-	users.POST("/profile_image", makeHandlerFunc(updateUserProfileImage))
-	users.GET("/:id", makeHandlerFunc(getUserById))
-	users.PUT("/:id", middleware.AuthorizeAdmin(), makeHandlerFunc(updateUser))
+	users.GET("/", middleware.AuthorizeAdmin(), makeHandlerFunc(getUsers(profileImages)))
+	users.GET("/profile", makeHandlerFunc(getUserProfile(profileImages)))
+	users.PUT("/profile", makeHandlerFunc(updateUserProfile(profileImages)))
+	users.POST("/profile_image", makeHandlerFunc(updateUserProfileImage(profileImages)))
+	users.DELETE("/profile_image", makeHandlerFunc(deleteUserProfileImage(profileImages)))
+	users.GET("/:id", makeHandlerFunc(getUserById(profileImages)))
+	users.PUT("/:id", middleware.AuthorizeAdmin(), makeHandlerFunc(updateUser(profileImages)))
 	users.DELETE("/:id", middleware.AuthorizeAdmin(), makeHandlerFunc(deleteUserById))
 }
 
 // Handler Functions
-func getUsers(c *gin.Context) error {
-	storage, err := database.GetPgStorageFromRequest(c.Request)
-	if err != nil {
-		return err
-	}
+func getUsers(profileImages *ProfileImages) func(c *gin.Context) error {
+	return func(c *gin.Context) error {
+		storage, err := database.GetPgStorageFromRequest(c.Request)
+		if err != nil {
+			return err
+		}
 
-	users, err := storage.GetUsers(c.Request)
-	if err != nil {
-		return err
-	}
+		users, err := storage.GetUsers(c.Request)
+		if err != nil {
+			return err
+		}
 
-	c.JSON(200, users)
-	return nil
+		profileImages.ResolveAll(c.Request.Context(), users)
+		return render.Respond(c, http.StatusOK, users)
+	}
 }
 
-func getUserById(c *gin.Context) error {
-	storage, err := database.GetPgStorageFromRequest(c.Request)
-	if err != nil {
-		return err
-	}
+func getUserById(profileImages *ProfileImages) func(c *gin.Context) error {
+	return func(c *gin.Context) error {
+		storage, err := database.GetPgStorageFromRequest(c.Request)
+		if err != nil {
+			return err
+		}
 
-	id, err := strconv.Atoi(c.Param("id"))
-	if err != nil {
-		return err
-	}
+		id, err := strconv.Atoi(c.Param("id"))
+		if err != nil {
+			return err
+		}
 
-	user, err := storage.GetUserById(id)
-	if err != nil {
-		return err
-	}
+		user, err := storage.GetUserById(id)
+		if err != nil {
+			return err
+		}
 
-	c.JSON(200, user)
-	return nil
+		profileImages.Resolve(c.Request.Context(), user)
+		return render.Respond(c, http.StatusOK, user)
+	}
 }
 
 func deleteUserById(c *gin.Context) error {
@@ -118,123 +151,194 @@ func deleteUserById(c *gin.Context) error {
 	return nil
 }
 
-func updateUser(c *gin.Context) error {
-	var updatePayload *database.UpdateUserDto
-	err := json.NewDecoder(c.Request.Body).Decode(&updatePayload)
-	if err != nil {
-		return err
-	}
+func updateUser(profileImages *ProfileImages) func(c *gin.Context) error {
+	return func(c *gin.Context) error {
+		var updatePayload *database.UpdateUserDto
+		err := json.NewDecoder(c.Request.Body).Decode(&updatePayload)
+		if err != nil {
+			return err
+		}
 
-	if err := validator.Validate(updatePayload); err != nil {
-		return err
-	}
+		if err := validator.Validate(updatePayload); err != nil {
+			return err
+		}
 
-	storage, err := database.GetPgStorageFromRequest(c.Request)
-	if err != nil {
-		return err
-	}
+		storage, err := database.GetPgStorageFromRequest(c.Request)
+		if err != nil {
+			return err
+		}
 
-	idParam, _ := c.Params.Get("id")
-	if idParam == "" {
-		return &utils.CustomError{
-			Message: "No id param in given",
+		idParam, _ := c.Params.Get("id")
+		if idParam == "" {
+			return &utils.CustomError{
+				Message: "No id param in given",
+			}
 		}
-	}
 
-	id, err := strconv.Atoi(idParam)
-	if err != nil {
-		c.JSON(http.StatusBadRequest, utils.CustomError{
-			Message: "Id is not a number",
-		})
+		id, err := strconv.Atoi(idParam)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, utils.CustomError{
+				Message: "Id is not a number",
+			})
+
+			return nil
+		}
 
+		user, err := storage.UpdateUserById(id, updatePayload)
+		if err != nil {
+			return err
+		}
+
+		profileImages.Resolve(c.Request.Context(), user)
+		c.JSON(http.StatusOK, user)
 		return nil
 	}
+}
 
-	user, err := storage.UpdateUserById(id, updatePayload)
-	if err != nil {
-		return err
+func getUserProfile(profileImages *ProfileImages) func(c *gin.Context) error {
+	return func(c *gin.Context) error {
+		userTmp, _ := c.Get("user")
+		user := userTmp.(*database.User)
+		profileImages.Resolve(c.Request.Context(), user)
+		c.JSON(http.StatusOK, user)
+		return nil
 	}
-
-	c.JSON(http.StatusOK, user)
-	return nil
 }
 
-func getUserProfile(c *gin.Context) error {
-	user, _ := c.Get("user")
-	c.JSON(http.StatusOK, user)
-	return nil
-}
+func updateUserProfile(profileImages *ProfileImages) func(c *gin.Context) error {
+	return func(c *gin.Context) error {
+		var updatePayload *database.UpdateUserDto
+		err := json.NewDecoder(c.Request.Body).Decode(&updatePayload)
+		if err != nil {
+			return err
+		}
 
-func updateUserProfile(c *gin.Context) error {
-	var updatePayload *database.UpdateUserDto
-	err := json.NewDecoder(c.Request.Body).Decode(&updatePayload)
-	if err != nil {
-		return err
-	}
+		userTmp, _ := c.Get("user")
+		user := userTmp.(*database.User)
+		if user.ID != updatePayload.ID {
+			return &utils.CustomError{
+				Message: "Forbidden",
+			}
+		}
 
-	userTmp, _ := c.Get("user")
-	user := userTmp.(*database.User)
-	if user.ID != updatePayload.ID {
-		return &utils.CustomError{
-			Message: "Forbidden",
+		storage, err := database.GetPgStorageFromRequest(c.Request)
+		if err != nil {
+			return err
 		}
-	}
 
-	storage, err := database.GetPgStorageFromRequest(c.Request)
-	if err != nil {
-		return err
-	}
+		user, err = storage.UpdateUserById(user.ID, updatePayload)
+		if err != nil {
+			return err
+		}
 
-	user, err = storage.UpdateUserById(user.ID, updatePayload)
-	if err != nil {
-		return err
+		profileImages.Resolve(c.Request.Context(), user)
+		c.JSON(http.StatusOK, user)
+		return nil
 	}
-
-	c.JSON(http.StatusOK, user)
-	return nil
 }
 
-func updateUserProfileImage(c *gin.Context) error {
-	storage, err := database.GetPgStorageFromRequest(c.Request)
-	if err != nil {
-		return err
-	}
+func updateUserProfileImage(profileImages *ProfileImages) func(c *gin.Context) error {
+	return func(c *gin.Context) error {
+		storage, err := database.GetPgStorageFromRequest(c.Request)
+		if err != nil {
+			return err
+		}
 
-	userTmp, _ := c.Get("user")
-	user := userTmp.(*database.User)
+		userTmp, _ := c.Get("user")
+		user := userTmp.(*database.User)
 
-	imageFile, fileHeaders, err := c.Request.FormFile("image")
-	if err != nil {
-		return err
-	}
-	defer imageFile.Close()
+		objectKey, err := profileImages.UploadFromRequest(c, profileImages.Prefix(user.ID))
+		if err != nil || objectKey == "" {
+			return err
+		}
 
-	cfg, err := config.LoadDefaultConfig(context.TODO())
-	if err != nil {
-		return err
+		ctx := c.Request.Context()
+		if err := storage.UpdateUserProfileImageUrl(user.ID, objectKey); err != nil {
+			profileImages.DeleteVariants(ctx, objectKey)
+			return err
+		}
+
+		// The previous image is replaced, its variants are no longer referenced
+		if user.ProfileImageKey != "" && user.ProfileImageKey != objectKey {
+			profileImages.DeleteVariants(ctx, user.ProfileImageKey)
+		}
+
+		metrics.ProfileImageUploadsTotal.Inc()
+		user.ProfileImageKey = objectKey
+		profileImages.Resolve(ctx, user)
+		c.JSON(http.StatusOK, user)
+
+		return nil
 	}
+}
 
-	client := s3.NewFromConfig(cfg)
+func deleteUserProfileImage(profileImages *ProfileImages) func(c *gin.Context) error {
+	return func(c *gin.Context) error {
+		storage, err := database.GetPgStorageFromRequest(c.Request)
+		if err != nil {
+			return err
+		}
 
-	bucketName := os.Getenv("AWS_BUCKET_NAME")
-	objectKey := fmt.Sprintf("profile/user/%d/profile_image%s", user.ID, filepath.Ext(fileHeaders.Filename))
+		userTmp, _ := c.Get("user")
+		user := userTmp.(*database.User)
+		if user.ProfileImageKey == "" {
+			c.JSON(http.StatusNotFound, utils.CustomError{
+				Message: "User has no profile image",
+			})
 
-	_, err = client.PutObject(context.TODO(), &s3.PutObjectInput{
-		Bucket: &bucketName,
-		Key:    &objectKey,
-		Body:   imageFile,
-	})
+			return nil
+		}
 
-	if err != nil {
-		return err
-	}
+		if err := storage.UpdateUserProfileImageUrl(user.ID, ""); err != nil {
+			return err
+		}
 
-	if err := storage.UpdateUserProfileImageUrl(user.ID, objectKey); err != nil {
-		return err
+		ctx := c.Request.Context()
+		profileImages.DeleteVariants(ctx, user.ProfileImageKey)
+
+		user.ProfileImageKey = ""
+		profileImages.Resolve(ctx, user)
+		c.JSON(http.StatusOK, user)
+		return nil
 	}
+}
 
-	user.ProfileImageUrl = objectKey
-	c.JSON(http.StatusOK, user)
+// getUserProfileImage serves a profile image variant through a signed, time limited URL
+func getUserProfileImage(profileImages *ProfileImages) func(c *gin.Context) error {
+	return func(c *gin.Context) error {
+		id, err := strconv.Atoi(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, utils.CustomError{
+				Message: "Id is not a number",
+			})
 
-	return nil
+			return nil
+		}
+
+		if !profileImages.VerifyRequest(c, id) {
+			c.JSON(http.StatusForbidden, utils.CustomError{
+				Message: "Invalid or expired signature",
+			})
+
+			return nil
+		}
+
+		storage, err := database.GetPgStorageFromRequest(c.Request)
+		if err != nil {
+			return err
+		}
+
+		user, err := storage.GetUserById(id)
+		if errors.Is(err, sql.ErrNoRows) {
+			c.JSON(http.StatusNotFound, utils.CustomError{
+				Message: "User not found",
+			})
+
+			return nil
+		} else if err != nil {
+			return err
+		}
+
+		return profileImages.Serve(c, user.ProfileImageKey)
+	}
 }
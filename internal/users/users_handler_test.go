@@ -0,0 +1,53 @@
+package users
+
+import (
+	"bytes"
+	"context"
+	"image"
+	"image/png"
+	"strings"
+	"testing"
+
+	"github.com/kaanserin/go-reads/internal/blobstore"
+	"github.com/kaanserin/go-reads/internal/config"
+	"github.com/kaanserin/go-reads/internal/database"
+	"github.com/kaanserin/go-reads/internal/images"
+)
+
+func TestResolveProfileImageUrls(t *testing.T) {
+	cfg := &config.Config{
+		BlobStore: config.BlobStoreConfig{URLTTL: 1},
+		Images:    config.ImagesConfig{MaxUploadBytes: 1 << 20, ThumbnailSizes: []int{64, 256}},
+		Auth:      config.AuthConfig{AppKey: "test-key"},
+	}
+	profileImages := NewProfileImages(cfg, blobstore.NewMemoryStore())
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, image.NewRGBA(image.Rect(0, 0, 32, 32))); err != nil {
+		t.Fatal(err)
+	}
+
+	key, err := profileImages.Upload(context.Background(), profileImages.Prefix(7), &buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	user := &database.User{ID: 7, ProfileImageKey: key}
+	profileImages.Resolve(context.Background(), user)
+
+	if !strings.HasPrefix(user.ProfileImageUrl, "/users/7/profile_image?") {
+		t.Errorf("Expected a signed proxy URL, got %s", user.ProfileImageUrl)
+	}
+
+	for _, variant := range []string{images.OriginalVariant, "64", "256"} {
+		if user.ProfileImageUrls[variant] == "" {
+			t.Errorf("Expected a URL for the %s variant", variant)
+		}
+	}
+
+	user.ProfileImageKey = ""
+	profileImages.Resolve(context.Background(), user)
+	if user.ProfileImageUrl != "" || user.ProfileImageUrls != nil {
+		t.Errorf("Expected no URLs, got %q %v", user.ProfileImageUrl, user.ProfileImageUrls)
+	}
+}
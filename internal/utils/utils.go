@@ -5,6 +5,8 @@ import (
 	"net/http"
 
 	"github.com/gin-gonic/gin"
+	"github.com/kaanserin/go-reads/internal/logging"
+	"github.com/kaanserin/go-reads/internal/tracing"
 )
 
 func JSONResponse(w http.ResponseWriter, statusCode int, v any) error {
@@ -19,6 +21,8 @@ func MakeHandlerFunc(fn functionWithError) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		err := fn(c)
 		if err != nil {
+			logging.FromContext(c.Request.Context()).Warn("handler returned error", "error", err)
+			tracing.RecordError(c.Request.Context(), err)
 			c.JSON(400, CustomError{Message: err.Error()})
 		}
 	}
@@ -0,0 +1,266 @@
+package works
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kaanserin/go-reads/internal/books"
+	"github.com/kaanserin/go-reads/internal/config"
+	"github.com/kaanserin/go-reads/internal/database"
+	"github.com/kaanserin/go-reads/internal/middleware"
+	"github.com/kaanserin/go-reads/internal/render"
+	"github.com/kaanserin/go-reads/internal/reviewtext"
+	"github.com/kaanserin/go-reads/internal/utils"
+	"gopkg.in/validator.v2"
+)
+
+func AddWorksRoutes(r *gin.Engine, cfg *config.Config, covers *books.BookCovers) {
+	worksGroup := r.Group("works")
+
+	worksGroup.Use(middleware.Authentication(cfg.Auth.AppKey))
+
+	worksGroup.GET("/:id", utils.MakeHandlerFunc(getWorkById))
+	worksGroup.GET("/:id/editions", utils.MakeHandlerFunc(getWorkEditions(covers)))
+	worksGroup.GET("/:id/reviews", utils.MakeHandlerFunc(getWorkReviews))
+	worksGroup.PUT("/:id", middleware.AuthorizeRoles("admin", "librarian"), utils.MakeHandlerFunc(updateWorkById))
+	worksGroup.POST("/:id/merge", middleware.AuthorizeAdmin(), utils.MakeHandlerFunc(mergeWorks))
+	worksGroup.POST("/:id/split", middleware.AuthorizeAdmin(), utils.MakeHandlerFunc(splitWork))
+}
+
+type MergeWorksDto struct {
+	// Works whose editions are moved into the work of the route
+	WorkIDs []int `json:"work_ids"`
+}
+
+type SplitWorkDto struct {
+	// Editions moved out of the work of the route into a new work
+	BookIDs []int `json:"book_ids"`
+}
+
+// uniqueIds validates the ids of a merge or split request and drops duplicates, keeping their order
+func uniqueIds(ids []int, field string, exclude int) ([]int, error) {
+	if len(ids) == 0 {
+		return nil, &utils.CustomError{
+			Message: fmt.Sprintf("%s can not be empty", field),
+		}
+	}
+
+	seen := make(map[int]bool, len(ids))
+	unique := make([]int, 0, len(ids))
+	for _, id := range ids {
+		if id <= 0 {
+			return nil, &utils.CustomError{
+				Message: fmt.Sprintf("%s contains the invalid id %d", field, id),
+			}
+		}
+
+		if id == exclude {
+			return nil, &utils.CustomError{
+				Message: fmt.Sprintf("%s can not contain %d itself", field, id),
+			}
+		}
+
+		if !seen[id] {
+			seen[id] = true
+			unique = append(unique, id)
+		}
+	}
+
+	return unique, nil
+}
+
+func parseWorkId(c *gin.Context) (int, error) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return 0, &utils.CustomError{
+			Message: "Please enter a valid integer for id",
+		}
+	}
+
+	return id, nil
+}
+
+// requireWork answers 404 when the work of the route does not exist
+func requireWork(c *gin.Context, storage *database.PostgresqlStorage, id int) (*database.Work, error) {
+	work, err := storage.GetWorkById(id)
+	if errors.Is(err, sql.ErrNoRows) {
+		c.JSON(http.StatusNotFound, utils.CustomError{
+			Message: "Work not found",
+		})
+
+		return nil, nil
+	}
+
+	return work, err
+}
+
+func getWorkById(c *gin.Context) error {
+	storage, err := database.GetPgStorageFromRequest(c.Request)
+	if err != nil {
+		return err
+	}
+
+	id, err := parseWorkId(c)
+	if err != nil {
+		return err
+	}
+
+	work, err := requireWork(c, storage, id)
+	if err != nil || work == nil {
+		return err
+	}
+
+	return render.Respond(c, http.StatusOK, work)
+}
+
+func getWorkEditions(covers *books.BookCovers) func(c *gin.Context) error {
+	return func(c *gin.Context) error {
+		storage, err := database.GetPgStorageFromRequest(c.Request)
+		if err != nil {
+			return err
+		}
+
+		id, err := parseWorkId(c)
+		if err != nil {
+			return err
+		}
+
+		work, err := requireWork(c, storage, id)
+		if err != nil || work == nil {
+			return err
+		}
+
+		editions, err := storage.GetEditionsByWorkId(id, c.Request)
+		if err != nil {
+			return err
+		}
+
+		covers.ResolveAll(c.Request.Context(), editions)
+		return render.Respond(c, http.StatusOK, editions)
+	}
+}
+
+func getWorkReviews(c *gin.Context) error {
+	storage, err := database.GetPgStorageFromRequest(c.Request)
+	if err != nil {
+		return err
+	}
+
+	id, err := parseWorkId(c)
+	if err != nil {
+		return err
+	}
+
+	work, err := requireWork(c, storage, id)
+	if err != nil || work == nil {
+		return err
+	}
+
+	bookReviews, err := storage.GetBookReviewsByWorkId(id, c.Request)
+	if err != nil {
+		return err
+	}
+
+	reviewtext.Prepare(c.Query("reveal_spoilers") == "true", bookReviews...)
+
+	return render.Respond(c, http.StatusOK, bookReviews)
+}
+
+func updateWorkById(c *gin.Context) error {
+	workDto := &database.WorkDto{}
+	if err := json.NewDecoder(c.Request.Body).Decode(workDto); err != nil {
+		return err
+	}
+
+	if err := validator.Validate(workDto); err != nil {
+		return err
+	}
+
+	storage, err := database.GetPgStorageFromRequest(c.Request)
+	if err != nil {
+		return err
+	}
+
+	id, err := parseWorkId(c)
+	if err != nil {
+		return err
+	}
+
+	work, err := storage.UpdateWorkById(id, workDto)
+	if err != nil {
+		return err
+	}
+
+	c.JSON(http.StatusOK, work)
+	return nil
+}
+
+func mergeWorks(c *gin.Context) error {
+	mergeWorksDto := &MergeWorksDto{}
+	if err := json.NewDecoder(c.Request.Body).Decode(mergeWorksDto); err != nil {
+		return err
+	}
+
+	id, err := parseWorkId(c)
+	if err != nil {
+		return err
+	}
+
+	workIds, err := uniqueIds(mergeWorksDto.WorkIDs, "work_ids", id)
+	if err != nil {
+		return err
+	}
+
+	storage, err := database.GetPgStorageFromRequest(c.Request)
+	if err != nil {
+		return err
+	}
+
+	work, err := storage.MergeWorks(id, workIds)
+	if err != nil {
+		return err
+	}
+
+	c.JSON(http.StatusOK, work)
+	return nil
+}
+
+func splitWork(c *gin.Context) error {
+	splitWorkDto := &SplitWorkDto{}
+	if err := json.NewDecoder(c.Request.Body).Decode(splitWorkDto); err != nil {
+		return err
+	}
+
+	id, err := parseWorkId(c)
+	if err != nil {
+		return err
+	}
+
+	bookIds, err := uniqueIds(splitWorkDto.BookIDs, "book_ids", 0)
+	if err != nil {
+		return err
+	}
+
+	storage, err := database.GetPgStorageFromRequest(c.Request)
+	if err != nil {
+		return err
+	}
+
+	work, err := requireWork(c, storage, id)
+	if err != nil || work == nil {
+		return err
+	}
+
+	newWork, err := storage.SplitWork(id, bookIds)
+	if err != nil {
+		return err
+	}
+
+	c.JSON(http.StatusCreated, newWork)
+	return nil
+}
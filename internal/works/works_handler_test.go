@@ -0,0 +1,30 @@
+package works
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestUniqueIds(t *testing.T) {
+	ids, err := uniqueIds([]int{4, 2, 4, 9, 2}, "work_ids", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !slices.Equal(ids, []int{4, 2, 9}) {
+		t.Errorf("Expected duplicates to be dropped in order, got %v", ids)
+	}
+
+	invalid := map[string][]int{
+		"empty":             {},
+		"zero id":           {3, 0},
+		"negative id":       {-5},
+		"contains the work": {3, 1},
+	}
+
+	for name, ids := range invalid {
+		if _, err := uniqueIds(ids, "work_ids", 1); err == nil {
+			t.Errorf("Expected %s to be rejected", name)
+		}
+	}
+}